@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// ==========================================
+// 瀏覽器啟動 (v31)
+// ==========================================
+
+// openBrowser 以各作業系統的預設方式開啟網址
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// 不等待瀏覽器結束，只回收子程序避免殭屍程序
+	go cmd.Wait()
+	return nil
+}
+
+// hasDisplay 判斷是否有桌面環境可開啟瀏覽器 (Linux/BSD 需要 X11 或 Wayland)
+func hasDisplay() bool {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// listenAddr 組出 host:port (IPv6 位址會加上中括號)
+func listenAddr(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// browseURL 為本機瀏覽器使用的網址；本機或所有介面 (含空白) 一律連 localhost (與既有 OAuth 重新導向網址一致)
+func browseURL(host string, port int) string {
+	if host == "" || isLocalHost(host) || net.ParseIP(host).IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + listenAddr(host, port)
+}
+
+// isLocalHost 判斷監聽位址是否只接受本機連線
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestListenAndBrowseURL(t *testing.T) {
+	tests := []struct {
+		host   string
+		local  bool
+		listen string
+		browse string
+	}{
+		{"127.0.0.1", true, "127.0.0.1:9999", "http://localhost:9999"},
+		{"localhost", true, "localhost:9999", "http://localhost:9999"},
+		{"::1", true, "[::1]:9999", "http://localhost:9999"},
+		{"0.0.0.0", false, "0.0.0.0:9999", "http://localhost:9999"},
+		{"::", false, "[::]:9999", "http://localhost:9999"},
+		{"", false, ":9999", "http://localhost:9999"},
+		{"192.168.1.20", false, "192.168.1.20:9999", "http://192.168.1.20:9999"},
+		{"fe80::1", false, "[fe80::1]:9999", "http://[fe80::1]:9999"},
+		{"studio.lan", false, "studio.lan:9999", "http://studio.lan:9999"},
+	}
+	for _, tt := range tests {
+		if got := isLocalHost(tt.host); got != tt.local {
+			t.Errorf("isLocalHost(%q) = %v", tt.host, got)
+		}
+		if got := listenAddr(tt.host, 9999); got != tt.listen {
+			t.Errorf("listenAddr(%q) = %q，應為 %q", tt.host, got, tt.listen)
+		}
+		if got := browseURL(tt.host, 9999); got != tt.browse {
+			t.Errorf("browseURL(%q) = %q，應為 %q", tt.host, got, tt.browse)
+		}
+	}
+}
+
+func TestValidateListen(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "0.0.0.0", "::", "::1", "fe80::1", "localhost", "studio.lan", ""} {
+		if msg := validateListen(host); msg != "" {
+			t.Errorf("%q 應為有效位址: %s", host, msg)
+		}
+	}
+	for _, host := range []string{"127.0.0.1:9999", "[::1]:9999", "localhost:80", "http://localhost", "my host"} {
+		if validateListen(host) == "" {
+			t.Errorf("%q 應被拒絕", host)
+		}
+	}
+}
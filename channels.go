@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"SoraYT_Studio/storygen"
+)
+
+// ==========================================
+// 多頻道設定 (v31)
+// ==========================================
+
+// DefaultChannelID 為 env.json 未設定 Channels 時的隱含頻道
+const DefaultChannelID = "default"
+
+// ChannelProfile 描述一個 YouTube 頻道：各自的 OAuth token、排程與歸檔資料夾，
+// 以及上傳時套用的預設 metadata。未填的欄位沿用 env.json 的全域設定。
+type ChannelProfile struct {
+	ID                string         `json:"ID"`
+	Name              string         `json:"Name"`
+	TokenFile         string         `json:"TokenFile"`
+	ClientSecretFile  string         `json:"ClientSecretFile"`
+	ScheduleSlots     []string       `json:"ScheduleSlots"`
+	Schedule          *ScheduleRules `json:"Schedule,omitempty"`
+	Timezone          string         `json:"Timezone,omitempty"`
+	ArchiveFolder     string         `json:"ArchiveFolder"`
+	DefaultTags       []string       `json:"DefaultTags,omitempty"`
+	DefaultCategoryID string         `json:"DefaultCategoryID,omitempty"`
+	DescriptionFooter string         `json:"DescriptionFooter,omitempty"`
+
+	loc     *time.Location
+	primary bool // 未指定頻道的影片歸屬此頻道
+}
+
+// ChannelStatus 提供前端顯示各頻道的下一個排程時段
+type ChannelStatus struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	NextSchedule string `json:"next_schedule"`
+}
+
+// buildChannels 複製 env.json 的頻道設定並補齊預設值；未設定 Channels 時回傳隱含的預設頻道
+func buildChannels(g *GlobalConfig, loc *time.Location) ([]*ChannelProfile, error) {
+	if len(g.Channels) == 0 {
+		ch := buildDefaultChannel(g, loc)
+		ch.primary = true
+		return []*ChannelProfile{ch}, nil
+	}
+
+	seen := map[string]bool{}
+	list := make([]*ChannelProfile, 0, len(g.Channels))
+	for i := range g.Channels {
+		ch := g.Channels[i]
+		ch.ID = strings.TrimSpace(ch.ID)
+		if ch.ID == "" {
+			return nil, fmt.Errorf("Channels[%d] 缺少 ID", i)
+		}
+		if seen[ch.ID] {
+			return nil, fmt.Errorf("頻道 ID 重複: %s", ch.ID)
+		}
+		seen[ch.ID] = true
+
+		if ch.Name == "" {
+			ch.Name = ch.ID
+		}
+		if ch.TokenFile == "" {
+			ch.TokenFile = "token_" + ch.ID + ".json"
+		}
+		if ch.ClientSecretFile == "" {
+			ch.ClientSecretFile = "client_secret.json"
+		}
+		if len(ch.ScheduleSlots) == 0 {
+			ch.ScheduleSlots = g.ScheduleSlots
+		}
+		if ch.Schedule == nil {
+			ch.Schedule = g.Schedule
+		}
+		if ch.ArchiveFolder == "" {
+			ch.ArchiveFolder = g.ArchiveFolder
+		}
+		ch.loc = loc
+		if ch.Timezone != "" {
+			chLoc, err := time.LoadLocation(ch.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("頻道 %s 的 Timezone %q 無效: %w", ch.ID, ch.Timezone, err)
+			}
+			ch.loc = chLoc
+		}
+		list = append(list, &ch)
+	}
+	list[0].primary = true
+	return list, nil
+}
+
+// buildDefaultChannel 以 env.json 的全域設定組出隱含的單一頻道
+func buildDefaultChannel(g *GlobalConfig, loc *time.Location) *ChannelProfile {
+	return &ChannelProfile{
+		ID:               DefaultChannelID,
+		Name:             "預設頻道",
+		TokenFile:        TokenFile,
+		ClientSecretFile: "client_secret.json",
+		ScheduleSlots:    g.ScheduleSlots,
+		Schedule:         g.Schedule,
+		ArchiveFolder:    g.ArchiveFolder,
+		loc:              loc,
+	}
+}
+
+// resolveChannel 依 ID 找頻道，空字串代表主頻道；找不到回傳 nil
+func (rc *RuntimeConfig) resolveChannel(id string) *ChannelProfile {
+	if id == "" {
+		return rc.channels[0]
+	}
+	for _, ch := range rc.channels {
+		if ch.ID == id {
+			return ch
+		}
+	}
+	return nil
+}
+
+// ensureArchiveFolders 建立所有頻道的歸檔資料夾
+func (rc *RuntimeConfig) ensureArchiveFolders() {
+	for _, ch := range rc.channels {
+		os.MkdirAll(ch.ArchiveFolder, 0755)
+	}
+}
+
+func (ch *ChannelProfile) location() *time.Location {
+	if ch.loc == nil {
+		return time.Local
+	}
+	return ch.loc
+}
+
+// owns 判斷影片是否屬於此頻道
+func (ch *ChannelProfile) owns(v VideoConfig) bool {
+	if v.Channel == "" {
+		return ch.primary
+	}
+	return v.Channel == ch.ID
+}
+
+// applyDefaults 以頻道預設值補齊影片 metadata (僅補空欄位，頁尾不重複附加)
+func (ch *ChannelProfile) applyDefaults(v *VideoConfig) {
+	if len(v.Tags) == 0 && len(ch.DefaultTags) > 0 {
+		v.Tags = append([]string{}, ch.DefaultTags...)
+	}
+	if v.CategoryID == "" {
+		v.CategoryID = ch.DefaultCategoryID
+	}
+	if ch.DescriptionFooter != "" && !strings.Contains(v.Description, ch.DescriptionFooter) {
+		if v.Description != "" {
+			v.Description += "\n\n"
+		}
+		v.Description += ch.DescriptionFooter
+	}
+	// v31: 翻譯的說明也附上頁尾 (複製 map，避免修改共用的資料)
+	if ch.DescriptionFooter != "" && len(v.Localizations) > 0 {
+		locs := make(map[string]storygen.Localization, len(v.Localizations))
+		for code, l := range v.Localizations {
+			if !strings.Contains(l.Description, ch.DescriptionFooter) {
+				if l.Description != "" {
+					l.Description += "\n\n"
+				}
+				l.Description += ch.DescriptionFooter
+			}
+			locs[code] = l
+		}
+		v.Localizations = locs
+	}
+}
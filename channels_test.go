@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"SoraYT_Studio/storygen"
+)
+
+func TestBuildChannelsAndOwnership(t *testing.T) {
+	g := defaultGlobalConfig()
+	utc := time.UTC
+
+	// 沒有設定 Channels 時只有隱含的預設頻道，沒有指定頻道的影片都屬於它
+	list, err := buildChannels(&g, utc)
+	if err != nil || len(list) != 1 || list[0].ID != DefaultChannelID || !list[0].primary {
+		t.Fatalf("應建立預設頻道: %+v %v", list, err)
+	}
+	if !list[0].owns(VideoConfig{}) || list[0].owns(VideoConfig{Channel: "other"}) {
+		t.Fatal("預設頻道只擁有沒有指定頻道的影片")
+	}
+
+	g.Channels = []ChannelProfile{{ID: " main ", Name: "Main"}, {ID: "kids", Timezone: "Asia/Taipei", ScheduleSlots: []string{"07:00"}}}
+	list, err = buildChannels(&g, utc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := &RuntimeConfig{channels: list}
+	primary, kids := rc.resolveChannel("main"), rc.resolveChannel("kids")
+	if primary == nil || kids == nil || rc.resolveChannel("") != primary || rc.resolveChannel("nope") != nil {
+		t.Fatal("resolveChannel: 空字串為第一個頻道，未知 ID 回傳 nil")
+	}
+	if kids.Name != "kids" || kids.TokenFile != "token_kids.json" || kids.location().String() != "Asia/Taipei" || primary.location() != utc {
+		t.Fatalf("頻道預設值錯誤: %+v", kids)
+	}
+	if strings.Join(primary.ScheduleSlots, ",") != strings.Join(g.ScheduleSlots, ",") {
+		t.Fatalf("未設定時段的頻道應沿用全域時段: %v", primary.ScheduleSlots)
+	}
+
+	tests := []struct {
+		video         VideoConfig
+		primary, kids bool
+	}{
+		{VideoConfig{}, true, false},
+		{VideoConfig{Channel: "main"}, true, false},
+		{VideoConfig{Channel: "kids"}, false, true},
+		{VideoConfig{Channel: "deleted"}, false, false}, // 已移除的頻道不屬於任何頻道
+	}
+	for _, tt := range tests {
+		if primary.owns(tt.video) != tt.primary || kids.owns(tt.video) != tt.kids {
+			t.Errorf("頻道 %q 的歸屬錯誤", tt.video.Channel)
+		}
+	}
+
+	for _, bad := range [][]ChannelProfile{{{ID: ""}}, {{ID: "a"}, {ID: "a"}}, {{ID: "a", Timezone: "Mars/Base"}}} {
+		g.Channels = bad
+		if _, err := buildChannels(&g, utc); err == nil {
+			t.Errorf("應拒絕無效的頻道設定: %+v", bad)
+		}
+	}
+}
+
+func TestChannelApplyDefaults(t *testing.T) {
+	ch := &ChannelProfile{DefaultTags: []string{"Kids"}, DefaultCategoryID: "24", DescriptionFooter: "#shorts"}
+
+	v := VideoConfig{Description: "Story", Localizations: map[string]storygen.Localization{"ja": {Title: "物語", Description: "説明"}}}
+	shared := v.Localizations
+	ch.applyDefaults(&v)
+	if strings.Join(v.Tags, ",") != "Kids" || v.CategoryID != "24" || v.Description != "Story\n\n#shorts" {
+		t.Fatalf("應補齊預設 metadata: %+v", v)
+	}
+	if v.Localizations["ja"].Description != "説明\n\n#shorts" || shared["ja"].Description != "説明" {
+		t.Fatalf("翻譯說明應附上頁尾且不修改原本的 map: %+v / %+v", v.Localizations, shared)
+	}
+	v.Tags[0] = "changed"
+	if ch.DefaultTags[0] != "Kids" {
+		t.Fatal("預設標籤應複製，不可共用")
+	}
+	ch.applyDefaults(&v)
+	if strings.Count(v.Description, "#shorts") != 1 || strings.Count(v.Localizations["ja"].Description, "#shorts") != 1 {
+		t.Fatalf("頁尾不應重複附加: %q", v.Description)
+	}
+
+	// 已有的欄位不覆蓋
+	v = VideoConfig{Tags: []string{"Own"}, CategoryID: "22"}
+	ch.applyDefaults(&v)
+	if strings.Join(v.Tags, ",") != "Own" || v.CategoryID != "22" || v.Description != "#shorts" {
+		t.Fatalf("不應覆蓋已有的欄位: %+v", v)
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ==========================================
+// 命令列介面 (v31)
+// ==========================================
+
+// cliCommand 為一個子命令；run 收到子命令之後的參數並回傳 exit code
+type cliCommand struct {
+	name, summary string
+	run           func(args []string) int
+}
+
+var cliCommands []cliCommand
+
+func init() {
+	// 在 init 中指定，避免 printUsage 參照 cliCommands 造成初始化循環
+	cliCommands = []cliCommand{
+		{"serve", "啟動網頁介面 (預設)", runServe},
+		{"generate-story", "以 AI 產生新故事 (或多個候選) 並存入故事庫", runGenerateStoryCommand},
+		{"promote-story", "採用故事庫中的故事並寫入 story.json", runPromoteStoryCommand},
+		{"stories", "搜尋故事庫 (或以 -set-status 更新狀態)", runStoriesCommand},
+		{"create", "送出 Sora 任務 (預設使用 story.json)", runCreateCommand},
+		{"poll", "查詢 Sora 任務狀態", runPollCommand},
+		{"sync-mailbox", "將 Sora mailbox 的影片同步到 videos.json", runSyncMailboxCommand},
+		{"download", "下載影片並寫入 metadata (或補檔)", runDownloadCommand},
+		{"schedule", "重新分配待上傳影片的排程", runScheduleCommand},
+		{"upload", "依排程上傳影片到 YouTube", runUploadCommand},
+		{"status", "顯示待上傳影片與下一個排程時段", runStatusCommand},
+		{"doctor", "檢查設定、憑證與資料夾", func([]string) int { return runDoctor() }},
+		{"vault", "管理加密憑證庫 (執行 `vault` 查看子命令)", runVaultCommand},
+	}
+}
+
+// runCLI 依第一個參數分派子命令；沒有參數或第一個參數為旗標時視為 serve
+func runCLI(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "--help" {
+		return runServe(args)
+	}
+	name, rest := args[0], args[1:]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return 0
+	}
+	for _, c := range cliCommands {
+		if c.name == name {
+			return c.run(rest)
+		}
+	}
+	fmt.Printf("❌ 未知的命令: %s\n\n", name)
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Println("用法: SoraYT_Studio [命令] [選項]")
+	fmt.Println()
+	for _, c := range cliCommands {
+		fmt.Printf("  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Println()
+	fmt.Println("執行 `<命令> -h` 查看各命令的選項")
+}
+
+func newFlagSet(name, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: SoraYT_Studio %s [選項]\n  %s\n\n", name, summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags 解析旗標；ok 為 false 時呼叫端應直接回傳 code (-h 為 0，格式錯誤為 2)
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0, false
+		}
+		return 2, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "❌ 多餘的參數: %v\n", fs.Args())
+		fs.Usage()
+		return 2, false
+	}
+	return 0, true
+}
+
+// cliInit 載入執行期狀態，失敗時印出錯誤並提示 doctor
+func cliInit() bool {
+	if _, err := initRuntime(); err != nil {
+		fmt.Printf("❌ %v\n(可執行 `doctor` 取得完整檢查報告)\n", err)
+		return false
+	}
+	return true
+}
+
+// cliLoadConfig 只載入 env.json，不解鎖憑證庫、不讀取帳號與故事庫，也不輸出初始化訊息
+func cliLoadConfig() bool {
+	cfg, err := readGlobalConfig()
+	if err == nil {
+		_, err = app.SetConfig(cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n(可執行 `doctor` 取得完整檢查報告)\n", err)
+		return false
+	}
+	return true
+}
+
+func runGenerateStoryCommand(args []string) int {
+	fs := newFlagSet("generate-story", "以 AI 產生新故事並存入故事庫；只產生一個時同時寫入 story.json")
+	var sr StoryRequest
+	fs.StringVar(&sr.Provider, "provider", "", "LLM 提供者名稱 (env.json 的 LLM.Providers，預設為 LLM.Provider)")
+	fs.StringVar(&sr.Template, "template", "", "提示詞模板名稱 (LLM.PromptDir 中的 <名稱>.tmpl，預設為 LLM.Template)")
+	fs.StringVar(&sr.Vars.Role, "role", "", "角色 handle (預設為角色登錄第一個；已登錄的角色會帶入角色設定與預設標籤)")
+	fs.StringVar(&sr.Vars.Characters, "characters", "", "登場角色描述")
+	fs.StringVar(&sr.Vars.Theme, "theme", "", "題材 (預設 trending topics)")
+	topics := fs.String("topics", "", "主題清單 (逗號分隔)，每個候選抽一個")
+	fs.StringVar(&sr.Vars.Brief, "brief", "", "自由填寫的創作簡介")
+	localizations := fs.String("localizations", "", "翻譯語言代碼 (逗號分隔，預設為 LLM.Localizations，none 代表不翻譯)")
+	fs.StringVar(&sr.Vars.Month, "month", "", "月份 (預設本月，例如 \"November 2025\")")
+	fs.StringVar(&sr.Vars.Language, "language", "", "主要語言名稱或代碼 (預設 English)")
+	fs.IntVar(&sr.Vars.SceneCount, "scenes", 0, "場景數 (預設 3)")
+	fs.IntVar(&sr.Vars.Duration, "duration", 0, "影片秒數 (預設 15)")
+	fs.IntVar(&sr.Count, "count", 1, fmt.Sprintf("候選故事數 (1-%d)，大於 1 時需再以 promote-story 採用其中一個", MaxStoryVariants))
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if !cliInit() {
+		return 1
+	}
+	if _, ok := app.Config().llmProvider(sr.Provider); sr.Provider != "" && !ok {
+		fmt.Printf("❌ 找不到 LLM 提供者 %q (可用: %s)\n", sr.Provider, providerNames(app.Config()))
+		return 2
+	}
+	sr.Topics = splitList(*topics)
+	sr.Vars.Localizations = parseLocalizations(*localizations)
+	if sr.Count < 1 || sr.Count > MaxStoryVariants {
+		fmt.Printf("❌ -count 必須介於 1 到 %d\n", MaxStoryVariants)
+		return 2
+	}
+	records, err := app.generateStories(context.Background(), sr)
+	if err != nil {
+		return 1
+	}
+	for _, rec := range records {
+		fmt.Printf("📄 %s: %s\n", rec.ID, rec.Story.Metadata.Title)
+		if rec.Story.Metadata.Topic != "" {
+			fmt.Printf("   主題: %s\n", rec.Story.Metadata.Topic)
+		}
+	}
+	if len(records) > 1 {
+		fmt.Printf("👉 執行 `promote-story -id <ID>` 採用其中一個\n")
+	}
+	return 0
+}
+
+func runPromoteStoryCommand(args []string) int {
+	fs := newFlagSet("promote-story", "採用故事庫中的故事並寫入 story.json (供 create 與網頁讀取)")
+	id := fs.String("id", "", "故事 ID (必填)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *id == "" {
+		fmt.Println("❌ 請指定 -id")
+		return 2
+	}
+	if !cliInit() {
+		return 1
+	}
+	rec, err := app.promoteStory(*id)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("📄 %s: %s\n", rec.Story.Metadata.FileName, rec.Story.Metadata.Title)
+	return 0
+}
+
+func runStoriesCommand(args []string) int {
+	fs := newFlagSet("stories", "搜尋故事庫；指定 -id 與 -set-status 時更新該故事的狀態")
+	var f StoryFilter
+	fs.StringVar(&f.Query, "q", "", "搜尋標題、標籤或 ID")
+	fs.StringVar(&f.Status, "status", "", "只列出此狀態 ("+strings.Join(storyStatuses, ", ")+")")
+	id := fs.String("id", "", "要更新的故事 ID")
+	setStatus := fs.String("set-status", "", "新的狀態")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if (*id == "") != (*setStatus == "") {
+		fmt.Println("❌ -id 與 -set-status 必須同時指定")
+		return 2
+	}
+	for _, status := range []string{f.Status, *setStatus} {
+		if status != "" && !validStoryStatus(status) {
+			fmt.Printf("❌ 未知的狀態 %q (可用: %s)\n", status, strings.Join(storyStatuses, ", "))
+			return 2
+		}
+	}
+	if !cliInit() {
+		return 1
+	}
+	if *id != "" {
+		rec, err := app.stories.setStatus(*id, *setStatus)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ %s → %s\n", rec.ID, rec.Status)
+		return 0
+	}
+	list := app.stories.list(f)
+	fmt.Printf("\n故事庫: %d 個\n", len(list))
+	for _, rec := range list {
+		fmt.Printf("  %-9s %s  %s  %s\n", rec.Status, rec.CreatedAt.Local().Format("2006-01-02 15:04"), rec.ID, rec.Story.Metadata.Title)
+	}
+	return 0
+}
+
+func runCreateCommand(args []string) int {
+	fs := newFlagSet("create", "送出 Sora 任務；未指定 -prompt 時使用故事檔的提示詞與 metadata")
+	prompt := fs.String("prompt", "", "提示詞")
+	storyFile := fs.String("story", StoryFile, "故事檔 (含 prompt 與 metadata)")
+	wait := fs.Bool("wait", false, "等待生成完成並下載歸檔 (同網頁流水線)")
+	interval := fs.Duration("interval", 5*time.Second, "等待時的查詢間隔")
+	timeout := fs.Duration("timeout", 50*time.Minute, "等待的最長時間")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if !cliInit() {
+		return 1
+	}
+
+	var meta *VideoConfig
+	if *prompt == "" {
+		story, err := readStoryFile(*storyFile)
+		if err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		*prompt, meta = story.Prompt, &story.Metadata
+	}
+	if strings.TrimSpace(*prompt) == "" {
+		fmt.Println("❌ 提示詞是空的")
+		return 1
+	}
+	if *wait && (meta == nil || meta.FileName == "") {
+		fmt.Println("❌ -wait 需要故事檔的 metadata.file_name")
+		return 1
+	}
+
+	resp, err := app.createSoraTask(*prompt)
+	if err != nil {
+		fmt.Println("❌", err)
+		return 1
+	}
+	taskID, _ := resp["id"].(string)
+	account, _ := resp["account"].(string)
+	fmt.Printf("✅ 任務 ID: %s (帳號: %s)\n", taskID, account)
+	if !*wait {
+		return 0
+	}
+
+	links, err := waitSoraTask(taskID, account, *interval, *timeout)
+	if err != nil {
+		fmt.Println("❌", err)
+		return 1
+	}
+	meta.SoraAccount = account
+	metaJSON, _ := json.Marshal(meta)
+	req := SoraDownloadRequest{Filename: meta.FileName, MetaJSON: string(metaJSON), Account: account}
+	if len(links) > 0 {
+		req.URL = links[0]
+	} else {
+		fmt.Println("⚠️ 任務完成但沒抓到連結，先強制存檔...")
+	}
+	filename, msg := app.downloadVideo(req)
+	if req.URL == "" {
+		fmt.Println("🔄 3秒後自動嘗試補檔下載...")
+		time.Sleep(3 * time.Second)
+		filename, msg = app.downloadVideo(SoraDownloadRequest{Filename: meta.FileName, UniqueIDLookup: meta.UniqueID, Account: account})
+	}
+	return printDownloadResult(filename, msg)
+}
+
+func runPollCommand(args []string) int {
+	fs := newFlagSet("poll", "查詢 Sora 任務狀態")
+	taskID := fs.String("task", "", "任務 ID (必填)")
+	account := fs.String("account", "", "送出任務的帳號 (預設依任務紀錄判斷)")
+	wait := fs.Bool("wait", false, "持續查詢直到完成")
+	interval := fs.Duration("interval", 5*time.Second, "等待時的查詢間隔")
+	timeout := fs.Duration("timeout", 50*time.Minute, "等待的最長時間")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *taskID == "" {
+		fmt.Println("❌ 請指定 -task")
+		return 2
+	}
+	if !cliInit() {
+		return 1
+	}
+
+	var links []string
+	if *wait {
+		var err error
+		if links, err = waitSoraTask(*taskID, *account, *interval, *timeout); err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+	} else {
+		l, done, err := app.pollSoraTask(*taskID, *account)
+		if err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		if !done {
+			fmt.Println("⏳ running")
+			return 0
+		}
+		links = l
+	}
+	fmt.Println("✅ done")
+	for _, l := range links {
+		fmt.Println(l)
+	}
+	return 0
+}
+
+// waitSoraTask 定期查詢任務直到完成或超時
+func waitSoraTask(taskID, account string, interval, timeout time.Duration) ([]string, error) {
+	deadline := time.Now().Add(timeout)
+	for attempts := 1; ; attempts++ {
+		links, done, err := app.pollSoraTask(taskID, account)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return links, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("任務超時: %s", taskID)
+		}
+		if attempts%10 == 0 {
+			fmt.Printf("⏳ %s 生成中...\n", taskID)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func runSyncMailboxCommand(args []string) int {
+	fs := newFlagSet("sync-mailbox", "將 Sora mailbox 的影片同步到 videos.json")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if !cliInit() {
+		return 1
+	}
+	n, err := app.syncMailbox()
+	if err != nil {
+		fmt.Println("❌", err)
+		return 1
+	}
+	fmt.Printf("✅ 已同步 %d 部影片\n", n)
+	return 0
+}
+
+func runDownloadCommand(args []string) int {
+	fs := newFlagSet("download", "下載影片並寫入 metadata；只給 -file 或 -id 時從 videos.json / mailbox 補找連結")
+	var req SoraDownloadRequest
+	fs.StringVar(&req.URL, "url", "", "下載連結")
+	fs.StringVar(&req.Filename, "file", "", "存檔名稱")
+	fs.StringVar(&req.UniqueIDLookup, "id", "", "以 unique_id 搜尋 mailbox")
+	fs.StringVar(&req.Account, "account", "", "Sora 帳號")
+	metaFile := fs.String("meta", "", "metadata JSON 檔 (VideoConfig 格式)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if req.URL == "" && req.Filename == "" && req.UniqueIDLookup == "" && *metaFile == "" {
+		fmt.Println("❌ 請指定 -url、-file、-id 或 -meta")
+		return 2
+	}
+	if *metaFile != "" {
+		data, err := os.ReadFile(*metaFile)
+		if err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		req.MetaJSON = string(data)
+	}
+	if !cliInit() {
+		return 1
+	}
+	return printDownloadResult(app.downloadVideo(req))
+}
+
+func printDownloadResult(filename, msg string) int {
+	if strings.HasPrefix(msg, "下載失敗") {
+		fmt.Printf("❌ %s: %s\n", filename, msg)
+		return 1
+	}
+	fmt.Printf("🎉 %s: %s\n", filename, msg)
+	return 0
+}
+
+func runScheduleCommand(args []string) int {
+	fs := newFlagSet("schedule", "將待上傳的自動排程影片重新分配到現在之後的空時段")
+	dryRun := fs.Bool("dry-run", false, "只顯示分配結果，不寫回 videos.json")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if !cliInit() {
+		return 1
+	}
+	plan := app.rebalanceSchedule(*dryRun)
+	if len(plan) == 0 {
+		fmt.Println("沒有需要重新分配的影片")
+		return 0
+	}
+	for _, e := range plan {
+		fmt.Printf("%s  [%s] %s\n", e.PublishAt, e.Channel, e.FileName)
+	}
+	if *dryRun {
+		fmt.Printf("(dry-run) 共 %d 部影片，未寫入 %s\n", len(plan), ConfigFile)
+	}
+	return 0
+}
+
+func runUploadCommand(args []string) int {
+	fs := newFlagSet("upload", "依排程上傳影片到 YouTube")
+	limit := fs.Int("limit", 0, "最多上傳幾部 (0 為不限)")
+	dateStr := fs.String("date", "", "從此日期開始排程 (YYYY-MM-DD，頻道時區)")
+	channelID := fs.String("channel", "", "只處理此頻道 (預設所有頻道)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if !cliInit() {
+		return 1
+	}
+	var startDate time.Time
+	if *dateStr != "" {
+		var err error
+		if startDate, err = time.ParseInLocation("2006-01-02", *dateStr, app.Config().Loc); err != nil {
+			fmt.Printf("❌ -date 格式錯誤: %v\n", err)
+			return 2
+		}
+	}
+	logger := func(msg string) { fmt.Println(msg) }
+	logger(fmt.Sprintf("🚀 開始上傳任務 (Limit: %d)", *limit))
+	if err := app.processScheduleAndUpload(startDate, *limit, *channelID, logger); err != nil {
+		logger(fmt.Sprintf("❌ 錯誤: %v", err))
+		return 1
+	}
+	logger("🎉 任務完成")
+	return 0
+}
+
+func runStatusCommand(args []string) int {
+	fs := newFlagSet("status", "顯示待上傳影片與下一個排程時段")
+	asJSON := fs.Bool("json", false, "以 JSON 輸出 (同 /api/status)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	// 狀態只需要 env.json 與 videos.json，不做完整初始化，stdout 只有查詢結果 (JSON 可直接交給 jq 等工具)
+	if !cliLoadConfig() {
+		return 1
+	}
+	status := app.buildStatus()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(status)
+		return 0
+	}
+
+	fmt.Printf("\n待上傳: %d 部 (時區 %s)\n", status.PendingCount, status.Timezone)
+	for _, ch := range status.Channels {
+		fmt.Printf("  [%s] %s 下一個時段: %s\n", ch.ID, ch.Name, ch.NextSchedule)
+	}
+	printVideoList := func(title string, list []VideoStatus) {
+		if len(list) == 0 {
+			return
+		}
+		fmt.Printf("\n%s\n", title)
+		for _, v := range list {
+			mark := "✅"
+			if v.Status != "Available" {
+				mark = "❌"
+			}
+			fmt.Printf("  %s %s  %s\n", mark, v.FileName, v.Title)
+		}
+	}
+	printVideoList("自動排程", status.StatusData)
+	printVideoList("手動 / 同步", status.ManualData)
+	for _, r := range status.Reauth {
+		fmt.Printf("\n⚠️ [%s] 需要重新授權 YouTube: %s\n", r.ChannelName, r.Reason)
+	}
+	return 0
+}
+
+// readStoryFile 讀取 AI 生成的故事檔
+func readStoryFile(path string) (StoryContent, error) {
+	var story StoryContent
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return story, fmt.Errorf("找不到 %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &story); err != nil {
+		return story, describeJSONError(path, data, err)
+	}
+	return story, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"SoraYT_Studio/vault"
+)
+
+// runCLICaptured 執行命令並回傳 exit code 與 stdout / stderr 的合併輸出
+func runCLICaptured(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	code := runCLI(args)
+	os.Stdout, os.Stderr = stdout, stderr
+	w.Close()
+	return code, <-out
+}
+
+// cliTestDir 切換到空的暫存資料夾，並確保不會使用到真實的憑證庫
+func cliTestDir(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(vault.EnvPassphrase, "")
+	t.Setenv(vault.EnvKeyFile, "")
+	old := secretVault
+	secretVault = nil
+	t.Cleanup(func() { secretVault = old })
+}
+
+func TestRunCLIDispatch(t *testing.T) {
+	cliTestDir(t)
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"help"}, 0, "generate-story"},
+		{[]string{"--help"}, 0, "用法"},
+		{[]string{"nope"}, 2, "未知的命令: nope"},
+		{[]string{"status", "-h"}, 0, "-json"},
+		{[]string{"status", "extra"}, 2, "多餘的參數"},
+		{[]string{"upload", "-limit", "x"}, 2, "invalid value"},
+		{[]string{"upload", "-date", "2026/01/02"}, 2, "-date 格式錯誤"},
+		{[]string{"serve", "-addr", "0.0.0.0:80"}, 2, "-addr"},
+		{[]string{"-port", "70000"}, 2, "-port"},
+	}
+	for _, tt := range tests {
+		code, out := runCLICaptured(t, tt.args...)
+		if code != tt.code || !strings.Contains(out, tt.want) {
+			t.Errorf("%v: exit %d (應為 %d)，輸出應含 %q:\n%s", tt.args, code, tt.code, tt.want, out)
+		}
+	}
+
+	// 設定錯誤時回傳 1 並提示 doctor
+	os.WriteFile(EnvFile, []byte(`{"Timezone": "Mars/Olympus_Mons"}`), 0644)
+	if code, out := runCLICaptured(t, "status"); code != 1 || !strings.Contains(out, "doctor") {
+		t.Errorf("設定錯誤時應回傳 1: %d\n%s", code, out)
+	}
+	os.Remove(EnvFile)
+
+	// status -json 的 stdout 只有 JSON
+	code, out := runCLICaptured(t, "status", "-json")
+	var status map[string]interface{}
+	if code != 0 || json.Unmarshal([]byte(out), &status) != nil {
+		t.Errorf("status -json 應只輸出 JSON: %d\n%s", code, out)
+	}
+}
+
+func TestUploadCommandReportsEachChannel(t *testing.T) {
+	cliTestDir(t)
+	os.WriteFile(EnvFile, []byte(`{"ScheduleSlots": ["10:00"], "Timezone": "UTC", "Channels": [{"ID": "a", "Name": "A"}, {"ID": "b", "Name": "B", "ClientSecretFile": "b_secret.json"}]}`), 0644)
+	saveConfig(ConfigFile, []VideoConfig{{FileName: "1.mp4"}, {FileName: "2.mp4", Channel: "b"}})
+
+	// 兩個頻道都缺 client secret：各自回報錯誤，exit code 為 1
+	code, out := runCLICaptured(t, "upload")
+	if code != 1 || !strings.Contains(out, "[A]") || !strings.Contains(out, "[B]") || !strings.Contains(out, "b_secret.json") {
+		t.Fatalf("應回報每個頻道的錯誤: %d\n%s", code, out)
+	}
+	code, out = runCLICaptured(t, "upload", "-channel", "b")
+	if code != 1 || strings.Contains(out, "[A]") || !strings.Contains(out, "[B]") {
+		t.Fatalf("-channel 只處理指定頻道: %d\n%s", code, out)
+	}
+}
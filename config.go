@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"SoraYT_Studio/storygen"
+)
+
+// ==========================================
+// 設定熱重載 (v31)
+// ==========================================
+
+// configPollInterval 為檢查 env.json / Role.txt 是否變更的間隔
+const configPollInterval = 2 * time.Second
+
+// maskedSecret 為 /api/config 回傳的遮罩值；POST 時收到此值代表不修改
+const maskedSecret = "********"
+
+// LLMConfig 為 env.json 的 LLM 區塊 (gemini_gen.go 共用)
+type LLMConfig struct {
+	ApiKey    string                    `json:"ApiKey"`
+	Provider  string                    `json:"Provider,omitempty"`  // v31: 預設使用的提供者名稱
+	Providers []storygen.ProviderConfig `json:"Providers,omitempty"` // v31: 可選的 LLM 提供者，未設定時只有 gemini
+	PromptDir string                    `json:"PromptDir,omitempty"` // v31: 提示詞模板資料夾，預設 prompts
+	Template  string                    `json:"Template,omitempty"`  // v31: 預設模板名稱，預設 default
+	// v31: 輸出不符合格式時最多嘗試幾次 (含第一次)，預設 3，設為 1 代表不重試
+	MaxAttempts int `json:"MaxAttempts,omitempty"`
+	// v31: 本機趨勢檔 (CSV 或 JSON 的關鍵字與權重)；請求沒有指定主題、題材與簡介時從中抽樣
+	TrendsFile string `json:"TrendsFile,omitempty"`
+	// v31: 另外產生標題、說明與標籤翻譯的語言代碼 (例如 ["zh-TW", "ja"])，上傳時設定為 YouTube localizations
+	Localizations []string `json:"Localizations,omitempty"`
+}
+
+// ConfigView 為 /api/config 的內容：GET 回傳目前生效的設定，POST 以相同格式更新
+type ConfigView struct {
+	Config   GlobalConfig     `json:"config"`
+	Roles    []RoleProfile    `json:"roles"`              // v31: 角色登錄 (POST 也接受舊版的 handle 字串清單)
+	Channels []ChannelProfile `json:"channels,omitempty"` // 補齊預設值後的頻道 (唯讀)
+	Timezone string           `json:"timezone,omitempty"` // 唯讀
+	LoadedAt string           `json:"loaded_at,omitempty"`
+}
+
+var configWatcher sync.Once
+
+// ConfigError 彙整設定中的所有問題，一次回報
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "設定檢查失敗:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// readGlobalConfig 讀取 env.json，未設定的欄位保留預設值；檔案不存在時回傳預設設定
+func readGlobalConfig() (GlobalConfig, error) {
+	cfg := defaultGlobalConfig()
+	data, err := os.ReadFile(EnvFile)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, describeJSONError(EnvFile, data, err)
+	}
+	return cfg, nil
+}
+
+// describeJSONError 將 JSON 錯誤轉成含行號或欄位名稱的訊息
+func describeJSONError(file string, data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, col := offsetToLineCol(data, syntaxErr.Offset)
+		return fmt.Errorf("%s 第 %d 行第 %d 字附近 JSON 語法錯誤: %v", file, line, col, syntaxErr)
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "(根節點)"
+		}
+		return fmt.Errorf("%s 欄位 %s 型別錯誤: 需要 %s，實際為 JSON %s", file, field, typeErr.Type, typeErr.Value)
+	}
+	return fmt.Errorf("%s 格式錯誤: %w", file, err)
+}
+
+func offsetToLineCol(data []byte, offset int64) (int, int) {
+	line, col := 1, 1
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// withDefaults 補齊空白欄位
+func (g GlobalConfig) withDefaults() GlobalConfig {
+	def := defaultGlobalConfig()
+	if strings.TrimSpace(g.Timezone) == "" {
+		g.Timezone = def.Timezone
+	}
+	if strings.TrimSpace(g.ArchiveFolder) == "" {
+		g.ArchiveFolder = def.ArchiveFolder
+	}
+	if g.Port == 0 {
+		g.Port = def.Port
+	}
+	if strings.TrimSpace(g.Listen) == "" {
+		g.Listen = def.Listen
+	}
+	if strings.TrimSpace(g.LLM.PromptDir) == "" {
+		g.LLM.PromptDir = def.LLM.PromptDir
+	}
+	if strings.TrimSpace(g.LLM.Template) == "" {
+		g.LLM.Template = storygen.DefaultTemplate
+	}
+	if g.LLM.MaxAttempts == 0 {
+		g.LLM.MaxAttempts = storygen.DefaultMaxAttempts
+	}
+	return g
+}
+
+// validateGlobalConfig 檢查 env.json 的所有欄位，回傳 *ConfigError (無問題時為 nil)
+func validateGlobalConfig(g GlobalConfig) error {
+	var problems []string
+	if len(g.ScheduleSlots) == 0 && (g.Schedule == nil || len(g.Schedule.Weekdays) == 0) {
+		problems = append(problems, "ScheduleSlots 不可為空 (或改用 Schedule.Weekdays 指定各日時段)")
+	}
+	problems = append(problems, validateSlots("ScheduleSlots", g.ScheduleSlots)...)
+	problems = append(problems, g.Schedule.validate("Schedule")...)
+	if _, err := time.LoadLocation(g.Timezone); err != nil {
+		problems = append(problems, fmt.Sprintf("Timezone: 無法載入 %q (應為 IANA 名稱，例如 Asia/Taipei)", g.Timezone))
+	}
+	if g.Port < 1 || g.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("Port: %d 超出範圍 (1-65535)", g.Port))
+	}
+	if msg := validateListen(g.Listen); msg != "" {
+		problems = append(problems, "Listen: "+msg)
+	}
+	problems = append(problems, validateLLMConfig(g.LLM)...)
+
+	seen := map[string]bool{}
+	for i, ch := range g.Channels {
+		field := fmt.Sprintf("Channels[%d]", i)
+		id := strings.TrimSpace(ch.ID)
+		switch {
+		case id == "":
+			problems = append(problems, field+".ID 不可為空")
+		case strings.ContainsAny(id, `/\:*?"<>| `):
+			problems = append(problems, fmt.Sprintf("%s.ID %q 含有不可用於檔名的字元", field, id))
+		case seen[id]:
+			problems = append(problems, fmt.Sprintf("%s.ID 重複: %s", field, id))
+		}
+		seen[id] = true
+		problems = append(problems, validateSlots(field+".ScheduleSlots", ch.ScheduleSlots)...)
+		problems = append(problems, ch.Schedule.validate(field+".Schedule")...)
+		if ch.Timezone != "" {
+			if _, err := time.LoadLocation(ch.Timezone); err != nil {
+				problems = append(problems, fmt.Sprintf("%s.Timezone: 無法載入 %q", field, ch.Timezone))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// validateListen 檢查監聽位址只含主機部分 (IP 或主機名稱)，埠號應填在 Port
+func validateListen(host string) string {
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	if strings.ContainsAny(host, ":/ ") {
+		return fmt.Sprintf("%q 不是有效的位址 (只填 IP 或主機名稱，埠號請填在 Port)", host)
+	}
+	return ""
+}
+
+// llmAPIKey 回傳 LLM API Key；啟用憑證庫時以憑證庫為準
+func (rc *RuntimeConfig) llmAPIKey() string {
+	if secretVault != nil {
+		if k, ok := secretVault.Get(SecretGeminiKey); ok && k != "" {
+			return k
+		}
+	}
+	return rc.LLM.ApiKey
+}
+
+// reloadConfig 重新讀取 env.json，驗證通過才替換並記錄差異
+func (st *AppState) reloadConfig() error {
+	cfg, err := readGlobalConfig()
+	if err != nil {
+		return err
+	}
+	return st.applyConfig(cfg)
+}
+
+func (st *AppState) applyConfig(cfg GlobalConfig) error {
+	old := st.Config()
+	rc, err := st.SetConfig(cfg)
+	if err != nil {
+		return err
+	}
+	rc.ensureArchiveFolders()
+	changes := diffGlobalConfig(old.GlobalConfig, rc.GlobalConfig)
+	if len(changes) == 0 {
+		fmt.Println("🔄 env.json 已重新載入 (無變更)")
+	}
+	for _, c := range changes {
+		fmt.Println("🔄 設定變更:", c)
+	}
+	return nil
+}
+
+// diffGlobalConfig 逐欄比較新舊設定，LLM 區塊只提示有變更不顯示內容
+func diffGlobalConfig(old, cur GlobalConfig) []string {
+	var changes []string
+	ov, cv := reflect.ValueOf(old), reflect.ValueOf(cur)
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		a, _ := json.Marshal(ov.Field(i).Interface())
+		b, _ := json.Marshal(cv.Field(i).Interface())
+		if string(a) == string(b) {
+			continue
+		}
+		name := t.Field(i).Name
+		if name == "LLM" {
+			changes = append(changes, "LLM 設定已更新 (內容不顯示)")
+			continue
+		}
+		msg := fmt.Sprintf("%s: %s → %s", name, a, b)
+		if name == "Port" || name == "Listen" {
+			msg += " (重新啟動後生效)"
+		}
+		changes = append(changes, msg)
+	}
+	return changes
+}
+
+// fileStamp 用修改時間與大小判斷檔案是否變更
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{info.ModTime(), info.Size()}
+}
+
+// startConfigWatcher 定期檢查 env.json 與角色登錄 (roles.json / Role.txt)，變更時重新載入
+func (st *AppState) startConfigWatcher() {
+	configWatcher.Do(func() {
+		go func() {
+			envStamp, roleStamp, legacyStamp := statFile(EnvFile), statFile(RolesFile), statFile(RoleFile)
+			for {
+				time.Sleep(configPollInterval)
+				if s := statFile(EnvFile); s != envStamp {
+					envStamp = s
+					if err := st.reloadConfig(); err != nil {
+						fmt.Printf("⚠️ %v，保留目前設定\n", err)
+					}
+				}
+				if s, l := statFile(RolesFile), statFile(RoleFile); s != roleStamp || l != legacyStamp {
+					roleStamp, legacyStamp = s, l
+					st.reloadRoles()
+				}
+			}
+		}()
+	})
+}
+
+func (st *AppState) configView() ConfigView {
+	rc := st.Config()
+	view := ConfigView{
+		Config:   rc.GlobalConfig,
+		Roles:    st.Roles(),
+		Timezone: rc.Loc.String(),
+		LoadedAt: rc.LoadedAt.In(rc.Loc).Format("2006-01-02 15:04:05"),
+	}
+	if view.Config.LLM.ApiKey != "" {
+		view.Config.LLM.ApiKey = maskedSecret
+	}
+	// 複製一份再遮罩，不可修改快照共用的 slice
+	view.Config.LLM.Providers = append([]storygen.ProviderConfig(nil), rc.LLM.Providers...)
+	for i := range view.Config.LLM.Providers {
+		if view.Config.LLM.Providers[i].ApiKey != "" {
+			view.Config.LLM.Providers[i].ApiKey = maskedSecret
+		}
+	}
+	for _, ch := range rc.channels {
+		view.Channels = append(view.Channels, *ch)
+	}
+	if view.Roles == nil {
+		view.Roles = []RoleProfile{}
+	}
+	return view
+}
+
+// handleConfig GET 檢視目前設定；POST 驗證後寫回 env.json / roles.json 並立即生效
+func (st *AppState) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		// v31: 可改寫 API Key 與 BaseURL，只接受同源的 JSON 請求 (擋掉跨站表單與 simple request)
+		if err := checkJSONRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var req ConfigView
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "JSON 格式錯誤: "+err.Error(), 400)
+			return
+		}
+		if req.Config.LLM.ApiKey == maskedSecret {
+			req.Config.LLM.ApiKey = st.Config().LLM.ApiKey
+		}
+		for i, p := range req.Config.LLM.Providers {
+			if p.ApiKey == maskedSecret {
+				req.Config.LLM.Providers[i].ApiKey = ""
+				if old, ok := st.Config().llmProvider(p.Name); ok {
+					req.Config.LLM.Providers[i].ApiKey = old.ApiKey
+				}
+			}
+		}
+
+		// 先驗證整份設定與角色，全部通過才寫入任何東西
+		rc, err := buildRuntimeConfig(req.Config)
+		if err != nil {
+			http.Error(w, "設定無效: "+err.Error(), 400)
+			return
+		}
+		if req.Roles != nil {
+			normalizeRoles(req.Roles)
+			if problems := validateRoles(req.Roles, rc); len(problems) > 0 {
+				http.Error(w, "角色設定無效: "+(&ConfigError{Problems: problems}).Error(), 400)
+				return
+			}
+		}
+
+		// 啟用憑證庫時 API Key 不寫回明文 env.json
+		if secretVault != nil && req.Config.LLM.ApiKey != "" {
+			if err := secretVault.Set(SecretGeminiKey, req.Config.LLM.ApiKey); err != nil {
+				jsonError(w, err.Error())
+				return
+			}
+			req.Config.LLM.ApiKey = ""
+		}
+		if err := writeEnvFile(req.Config); err != nil {
+			jsonError(w, err.Error())
+			return
+		}
+		if err := st.applyConfig(req.Config); err != nil {
+			jsonError(w, err.Error())
+			return
+		}
+		if req.Roles != nil {
+			if err := st.writeRoles(req.Roles); err != nil {
+				jsonError(w, err.Error())
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st.configView())
+}
+
+// checkJSONRequest 要求 Content-Type 為 application/json，且瀏覽器帶的 Origin 必須與 Host 相同
+func checkJSONRequest(r *http.Request) error {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+		return errors.New("Content-Type 必須為 application/json")
+	}
+	return checkSameOrigin(r)
+}
+
+// checkSameOrigin 拒絕瀏覽器送出的跨來源請求 (沒有 body 的 DELETE 等使用)
+func checkSameOrigin(r *http.Request) error {
+	// 非瀏覽器 (curl、腳本) 不帶 Origin；瀏覽器跨站 POST 一定會帶
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return fmt.Errorf("拒絕跨來源請求: %s", origin)
+		}
+	}
+	return nil
+}
+
+// writeEnvFile 寫回 env.json，保留 GlobalConfig 以外的欄位
+func writeEnvFile(cfg GlobalConfig) error {
+	env := map[string]interface{}{}
+	if data, err := os.ReadFile(EnvFile); err == nil {
+		if err := json.Unmarshal(data, &env); err != nil {
+			return fmt.Errorf("%s 格式錯誤，無法寫回: %w", EnvFile, err)
+		}
+	}
+	// 先移除所有 GlobalConfig 欄位，避免 omitempty 欄位 (例如清空 Channels) 殘留舊值
+	t := reflect.TypeOf(cfg)
+	for i := 0; i < t.NumField(); i++ {
+		delete(env, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+	b, _ := json.Marshal(cfg)
+	var fields map[string]interface{}
+	json.Unmarshal(b, &fields)
+	for k, v := range fields {
+		env[k] = v
+	}
+	out, _ := json.MarshalIndent(env, "", "  ")
+	return writeFileAtomic(EnvFile, out, 0644)
+}
+
+// writeFileAtomic 以暫存檔 + rename 寫入，避免當機或監看端讀到寫到一半的檔案
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
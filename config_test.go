@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"SoraYT_Studio/storygen"
+)
+
+func TestHandleConfigPost(t *testing.T) {
+	t.Chdir(t.TempDir())
+	st := newAppState("", "")
+	post := func(body string, header map[string]string) int {
+		req := httptest.NewRequest("POST", "http://localhost:9999/api/config", strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		st.handleConfig(rec, req)
+		return rec.Code
+	}
+	valid := `{"config": {"Timezone": "UTC", "ScheduleSlots": ["10:00"], "Port": 9999}}`
+	jsonHeader := map[string]string{"Content-Type": "application/json"}
+
+	// 跨站表單與跨來源請求一律拒絕
+	if code := post(valid, map[string]string{"Content-Type": "text/plain"}); code != 403 {
+		t.Fatalf("非 JSON 請求應被拒絕: %d", code)
+	}
+	if code := post(valid, map[string]string{"Content-Type": "application/json", "Origin": "http://evil.example"}); code != 403 {
+		t.Fatalf("跨來源請求應被拒絕: %d", code)
+	}
+
+	// 角色無效時整份設定都不寫入
+	if code := post(`{"config": {"Timezone": "UTC", "ScheduleSlots": ["10:00"]}, "roles": [{"Handle": "@a", "Channel": "nope"}]}`, jsonHeader); code != 400 {
+		t.Fatalf("無效角色應回傳 400: %d", code)
+	}
+	if _, err := os.Stat(EnvFile); !os.IsNotExist(err) {
+		t.Fatal("驗證失敗時不應寫入 env.json")
+	}
+
+	if code := post(valid, map[string]string{"Content-Type": "application/json; charset=utf-8", "Origin": "http://localhost:9999"}); code != 200 {
+		t.Fatalf("同源 JSON 請求應成功: %d", code)
+	}
+	if st.Config().Loc.String() != "UTC" {
+		t.Fatalf("設定未生效: %s", st.Config().Loc)
+	}
+}
+
+func TestValidateGlobalConfig(t *testing.T) {
+	if err := validateGlobalConfig(defaultGlobalConfig()); err != nil {
+		t.Fatalf("預設設定應通過驗證: %v", err)
+	}
+	weekdaysOnly := defaultGlobalConfig()
+	weekdaysOnly.ScheduleSlots = nil
+	weekdaysOnly.Schedule = &ScheduleRules{Weekdays: map[string][]string{"Mon": {"10:00"}}}
+	if err := validateGlobalConfig(weekdaysOnly); err != nil {
+		t.Fatalf("只設定 Schedule.Weekdays 時應通過驗證: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*GlobalConfig)
+		want   string
+	}{
+		{"沒有任何時段", func(g *GlobalConfig) { g.ScheduleSlots = nil }, "ScheduleSlots 不可為空"},
+		{"時段格式", func(g *GlobalConfig) { g.ScheduleSlots = []string{"25:00"} }, "ScheduleSlots[0]"},
+		{"排程規則", func(g *GlobalConfig) { g.Schedule = &ScheduleRules{Weekdays: map[string][]string{"Funday": nil}} }, "Schedule"},
+		{"時區", func(g *GlobalConfig) { g.Timezone = "Mars/Olympus_Mons" }, "Timezone"},
+		{"埠號", func(g *GlobalConfig) { g.Port = 70000 }, "Port"},
+		{"監聽位址含埠號", func(g *GlobalConfig) { g.Listen = "0.0.0.0:9999" }, "Listen"},
+		{"未知的 LLM 提供者", func(g *GlobalConfig) { g.LLM.Provider = "nope" }, "LLM.Provider"},
+		{"LLM 提供者設定", func(g *GlobalConfig) { g.LLM.Providers = []storygen.ProviderConfig{{Name: "x", Type: "bad"}} }, "LLM.Providers[0]"},
+		{"翻譯語言代碼", func(g *GlobalConfig) { g.LLM.Localizations = []string{"english!"} }, "LLM.Localizations"},
+		{"重試次數", func(g *GlobalConfig) { g.LLM.MaxAttempts = 11 }, "LLM.MaxAttempts"},
+		{"頻道 ID 空白", func(g *GlobalConfig) { g.Channels = []ChannelProfile{{ID: " "}} }, "Channels[0].ID 不可為空"},
+		{"頻道 ID 含路徑字元", func(g *GlobalConfig) { g.Channels = []ChannelProfile{{ID: "a/b"}} }, "不可用於檔名"},
+		{"頻道 ID 重複", func(g *GlobalConfig) { g.Channels = []ChannelProfile{{ID: "a"}, {ID: "a"}} }, "Channels[1].ID 重複"},
+		{"頻道時段", func(g *GlobalConfig) { g.Channels = []ChannelProfile{{ID: "a", ScheduleSlots: []string{"9"}}} }, "Channels[0].ScheduleSlots[0]"},
+		{"頻道排程規則", func(g *GlobalConfig) {
+			g.Channels = []ChannelProfile{{ID: "a", Schedule: &ScheduleRules{Blackouts: []DateRange{{From: "someday"}}}}}
+		}, "Channels[0].Schedule"},
+		{"頻道時區", func(g *GlobalConfig) { g.Channels = []ChannelProfile{{ID: "a", Timezone: "Nowhere/City"}} }, "Channels[0].Timezone"},
+	}
+	for _, tt := range tests {
+		g := defaultGlobalConfig()
+		tt.modify(&g)
+		err := validateGlobalConfig(g)
+		var cfgErr *ConfigError
+		if !errors.As(err, &cfgErr) || len(cfgErr.Problems) != 1 || !strings.Contains(cfgErr.Problems[0], tt.want) {
+			t.Errorf("%s: 應只回報一個含 %q 的問題，實際為 %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestDoctorChecks(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// 拼錯的欄位只警告；設定無效時回報每個問題並以預設設定繼續
+	os.WriteFile(EnvFile, []byte(`{"ScheduleSlots": ["10:00"], "Timezone": "UTC", "Port": 70000, "Listen": "localhost:80", "OpenBrowsr": true}`), 0644)
+	r := &doctorReport{}
+	rc := doctorConfig(r)
+	if r.errors != 2 || r.warnings != 1 || rc == nil || len(rc.channels) != 1 {
+		t.Fatalf("doctorConfig: %d 個錯誤、%d 個警告 (應為 2、1)", r.errors, r.warnings)
+	}
+
+	os.WriteFile(EnvFile, []byte(`{"ScheduleSlots": ["10:00"], "Timezone": "UTC"`), 0644)
+	r = &doctorReport{}
+	doctorConfig(r)
+	if r.errors != 1 {
+		t.Fatalf("JSON 格式錯誤應回報錯誤: %d", r.errors)
+	}
+
+	// 缺 client secret 為錯誤、尚未授權為警告、沒有 refresh token 為警告
+	ch := rc.channels[0]
+	r = &doctorReport{}
+	doctorYouTube(r, rc)
+	if r.errors != 1 || r.warnings != 1 {
+		t.Fatalf("doctorYouTube: %d 個錯誤、%d 個警告 (應為 1、1)", r.errors, r.warnings)
+	}
+	os.WriteFile(ch.TokenFile, []byte(`{"access_token": "a"}`), 0600)
+	r = &doctorReport{}
+	doctorYouTube(r, rc)
+	if r.errors != 1 || r.warnings != 1 {
+		t.Fatalf("沒有 refresh token 應警告: %d 個錯誤、%d 個警告", r.errors, r.warnings)
+	}
+	os.WriteFile(ch.TokenFile, []byte(`{"access_token": "a"`), 0600)
+	r = &doctorReport{}
+	doctorYouTube(r, rc)
+	if r.errors != 2 {
+		t.Fatalf("token 檔格式錯誤應回報錯誤: %d", r.errors)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"SoraYT_Studio/storygen"
+	"SoraYT_Studio/vault"
+)
+
+// ==========================================
+// doctor 健康檢查 (v31)
+// ==========================================
+
+// doctorReport 累計檢查結果並輸出
+type doctorReport struct {
+	errors, warnings int
+}
+
+func (r *doctorReport) section(title string) {
+	fmt.Printf("\n[%s]\n", title)
+}
+
+func (r *doctorReport) ok(format string, a ...interface{}) {
+	fmt.Printf("  ✅ "+format+"\n", a...)
+}
+
+func (r *doctorReport) warn(format string, a ...interface{}) {
+	r.warnings++
+	fmt.Printf("  ⚠️ "+format+"\n", a...)
+}
+
+func (r *doctorReport) fail(format string, a ...interface{}) {
+	r.errors++
+	fmt.Printf("  ❌ "+format+"\n", a...)
+}
+
+// runDoctor 檢查設定、憑證、資料夾與授權檔，有錯誤時回傳 1
+func runDoctor() int {
+	r := &doctorReport{}
+	fmt.Println("🩺 SkyForge 健康檢查")
+
+	r.section("憑證庫")
+	doctorVault(r)
+
+	r.section("設定檔 " + EnvFile)
+	rc := doctorConfig(r)
+
+	r.section("AI 生成")
+	doctorLLM(r, rc)
+
+	r.section("Sora 憑證")
+	doctorSora(r)
+
+	r.section("資料夾")
+	doctorFolders(r, rc)
+
+	r.section("YouTube 授權")
+	doctorYouTube(r, rc)
+
+	r.section("其他")
+	doctorMisc(r, rc)
+
+	fmt.Printf("\n結果: %d 個錯誤、%d 個警告\n", r.errors, r.warnings)
+	if r.errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func doctorVault(r *doctorReport) {
+	if !vault.Exists(vault.DefaultPath) {
+		if vault.Available() {
+			r.warn("已有金鑰但尚未建立 %s (執行 `vault init`)", vault.DefaultPath)
+		} else {
+			r.warn("未啟用加密憑證庫，憑證以明文儲存 (執行 `vault init` 與 `vault migrate`)")
+		}
+		return
+	}
+	v, err := vault.Open(vault.DefaultPath)
+	if err != nil {
+		r.fail("無法解鎖 %s: %v", vault.DefaultPath, err)
+		return
+	}
+	secretVault = v
+	r.ok("%s 已解鎖 (%d 筆憑證)", vault.DefaultPath, len(v.Names()))
+}
+
+// doctorConfig 檢查 env.json；設定無效時以預設設定繼續後續檢查
+func doctorConfig(r *doctorReport) *RuntimeConfig {
+	fallback, _ := buildRuntimeConfig(defaultGlobalConfig())
+
+	data, err := os.ReadFile(EnvFile)
+	if os.IsNotExist(err) {
+		r.warn("找不到 %s，使用預設設定", EnvFile)
+		return fallback
+	}
+	cfg, err := readGlobalConfig()
+	if err != nil {
+		r.fail("%v", err)
+		return fallback
+	}
+
+	// 不認得的欄位多半是拼錯字
+	known := map[string]bool{}
+	t := reflect.TypeOf(cfg)
+	for i := 0; i < t.NumField(); i++ {
+		known[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	var raw map[string]json.RawMessage
+	json.Unmarshal(data, &raw)
+	for k := range raw {
+		if !known[k] {
+			r.warn("未知的欄位 %q (拼錯字？)", k)
+		}
+	}
+
+	rc, err := buildRuntimeConfig(cfg)
+	if err != nil {
+		var cfgErr *ConfigError
+		if errors.As(err, &cfgErr) {
+			for _, p := range cfgErr.Problems {
+				r.fail("%s", p)
+			}
+		} else {
+			r.fail("%v", err)
+		}
+		return fallback
+	}
+	r.ok("時區 %s、%d 個預設時段、%d 個頻道、埠號 %d", rc.Loc, len(rc.ScheduleSlots), len(rc.channels), rc.Port)
+
+	return rc
+}
+
+func doctorLLM(r *doctorReport, rc *RuntimeConfig) {
+	def := rc.defaultLLMProvider()
+	for _, p := range rc.llmProviders() {
+		label := p.Name
+		if p.Name == def {
+			label += " (預設)"
+		}
+		switch {
+		case p.Type == storygen.TypeGemini && rc.providerAPIKey(p) == "":
+			r.warn("LLM %s: 未設定 API Key (LLM.ApiKey)，無法使用", label)
+		case p.Type == storygen.TypeOpenAI:
+			r.ok("LLM %s: %s @ %s", label, p.Model, p.BaseURL)
+		default:
+			r.ok("LLM %s: %s", label, p.Type)
+		}
+	}
+	if _, _, err := storygen.RenderPrompt(rc.LLM.PromptDir, rc.LLM.Template, storygen.PromptVars{}, time.Now()); err != nil {
+		r.fail("%v", err)
+	} else if list, err := storygen.ListTemplates(rc.LLM.PromptDir); err == nil {
+		r.ok("提示詞模板: 預設 %s，共 %d 個 (%s)", rc.LLM.Template, len(list), rc.LLM.PromptDir)
+	}
+	if rc.LLM.TrendsFile != "" {
+		if trends, err := storygen.LoadTrends(rc.LLM.TrendsFile); err != nil {
+			r.warn("%v (生成時改用預設主題)", err)
+		} else {
+			r.ok("趨勢檔: %s，共 %d 個關鍵字", rc.LLM.TrendsFile, len(trends))
+		}
+	}
+}
+
+func doctorSora(r *doctorReport) {
+	pool := newSoraAccountPool(SoraAccountsFile)
+	list, err := pool.readStored()
+	if err != nil {
+		r.fail("%v", err)
+	}
+	if len(list) == 0 {
+		creds := initSoraCredentials()
+		if creds == nil {
+			r.fail("沒有任何 Sora 憑證，請啟動後在網頁貼上 cURL")
+			return
+		}
+		r.warn("使用舊版單一憑證，啟動時會移轉為 %s 帳號", DefaultSoraAccount)
+		list = []*SoraAccount{{Name: DefaultSoraAccount, Creds: creds, Remaining: -1}}
+	}
+
+	usable := 0
+	for _, a := range list {
+		st := pool.sessionStatus(*a)
+		label := a.Name
+		if a.Remaining >= 0 {
+			label += fmt.Sprintf(" (剩餘 %d 次)", a.Remaining)
+		}
+		switch {
+		case a.Disabled:
+			r.warn("%s: 已停用", label)
+		case st.State == "ok":
+			usable++
+			r.ok("%s: 有效至 %s", label, st.ExpiresAt)
+		case st.State == "expiring" || st.State == "unknown":
+			usable++
+			r.warn("%s: %s", label, st.Message)
+		default:
+			r.warn("%s: %s", label, st.Message)
+		}
+	}
+	if usable == 0 {
+		r.fail("沒有可用的 Sora 帳號")
+	}
+}
+
+func doctorFolders(r *doctorReport, rc *RuntimeConfig) {
+	dirs := []string{DownloadDir}
+	seen := map[string]bool{DownloadDir: true}
+	for _, ch := range rc.channels {
+		if !seen[ch.ArchiveFolder] {
+			seen[ch.ArchiveFolder] = true
+			dirs = append(dirs, ch.ArchiveFolder)
+		}
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			r.warn("%s 不存在 (啟動時會自動建立)", dir)
+			continue
+		}
+		if err != nil || !info.IsDir() {
+			r.fail("%s 不是資料夾", dir)
+			continue
+		}
+		f, err := os.CreateTemp(dir, ".doctor-*")
+		if err != nil {
+			r.fail("%s 無法寫入: %v", dir, err)
+			continue
+		}
+		f.Close()
+		os.Remove(f.Name())
+		r.ok("%s 可寫入", dir)
+	}
+}
+
+func doctorYouTube(r *doctorReport, rc *RuntimeConfig) {
+	for _, ch := range rc.channels {
+		prefix := fmt.Sprintf("[%s] ", ch.ID)
+		if _, err := oauthConfig(ch); err != nil {
+			r.fail("%s%v (請從 Google Cloud Console 下載 OAuth 用戶端密鑰)", prefix, err)
+		} else {
+			r.ok("%s%s 格式正確", prefix, ch.ClientSecretFile)
+		}
+
+		tok, err := tokenFromFile(ch.TokenFile)
+		switch {
+		case os.IsNotExist(err):
+			r.warn("%s尚未授權 (%s 不存在)，啟動後請在網頁點選「連結 YouTube」", prefix, ch.TokenFile)
+		case err != nil:
+			r.fail("%s%s 格式錯誤: %v", prefix, ch.TokenFile, err)
+		case tok.RefreshToken == "":
+			r.warn("%s%s 沒有 refresh token，過期後需要重新授權", prefix, ch.TokenFile)
+		default:
+			r.ok("%s%s 已授權", prefix, ch.TokenFile)
+		}
+	}
+}
+
+func doctorMisc(r *doctorReport, rc *RuntimeConfig) {
+	if roles, file, err := readRoles(); err != nil {
+		r.warn("無法讀取 %s，將使用內建角色: %v", file, err)
+	} else if len(roles) == 0 {
+		r.warn("%s 是空的", file)
+	} else {
+		r.ok("%s: %d 個角色", file, len(roles))
+		for _, p := range validateRoles(roles, rc) {
+			r.fail("%s: %s", file, p)
+		}
+	}
+
+	if data, err := os.ReadFile(ConfigFile); err == nil {
+		var videos []VideoConfig
+		if err := json.Unmarshal(data, &videos); err != nil {
+			r.fail("%v", describeJSONError(ConfigFile, data, err))
+		} else {
+			r.ok("%s: %d 部影片", ConfigFile, len(videos))
+		}
+	}
+
+	addr := listenAddr(rc.Listen, rc.Port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		r.warn("%s 無法監聽 (伺服器可能已在執行): %v", addr, err)
+	} else {
+		ln.Close()
+		r.ok("%s 可用", addr)
+	}
+	if !hasDisplay() && rc.OpenBrowser {
+		r.warn("偵測不到桌面環境，OpenBrowser 不會生效 (伺服器請使用 --headless)")
+	}
+}
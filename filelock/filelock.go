@@ -0,0 +1,45 @@
+// Package filelock 以鎖檔 (<path>.lock) 提供跨行程的互斥鎖，
+// 讓 serve 與 CLI 同時修改同一個資料檔時不會互相覆蓋。
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	retryInterval = 20 * time.Millisecond
+	waitTimeout   = 10 * time.Second
+	// 超過 staleAfter 的鎖檔視為行程當機遺留，直接移除 (持有鎖的操作都只是讀寫一個小檔案)
+	staleAfter = 30 * time.Second
+)
+
+// ErrTimeout 表示等待其他行程釋放鎖逾時
+var ErrTimeout = errors.New("等待檔案鎖逾時")
+
+// Lock 建立 path 的鎖檔，已被其他行程持有時等待；回傳的 unlock 釋放鎖
+func Lock(path string) (unlock func(), err error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleAfter {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrTimeout, lockPath)
+		}
+		time.Sleep(retryInterval)
+	}
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 package main
 
 import (
@@ -6,17 +8,17 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
 	"time"
 
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+	"SoraYT_Studio/storygen"
+	"SoraYT_Studio/vault"
 )
 
 // v30.1 Fix: 改名以避免與 main.go 衝突
 type GeminiConfig struct {
 	LLM struct {
-		ApiKey string `json:"ApiKey"`
+		ApiKey      string `json:"ApiKey"`
+		MaxAttempts int    `json:"MaxAttempts"`
 	} `json:"LLM"`
 }
 
@@ -34,129 +36,44 @@ func loadGeminiConfig(path string) (*GeminiConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("解析設定檔失敗: %w", err)
 	}
+
+	// v31: 啟用加密憑證庫時，API Key 以憑證庫為準
+	if vault.Exists(vault.DefaultPath) {
+		v, err := vault.Open(vault.DefaultPath)
+		if err != nil {
+			return nil, fmt.Errorf("無法解鎖憑證庫: %w", err)
+		}
+		if key, ok := v.Get(vault.SecretGeminiKey); ok && key != "" {
+			config.LLM.ApiKey = key
+		}
+	}
 	return config, nil
 }
 
+// 獨立執行版：go run gemini_gen.go (伺服器已直接呼叫 storygen，不再需要這支程式)
 func main() {
-	// 1. 讀取設定
 	config, err := loadGeminiConfig("env.json")
 	if err != nil {
 		log.Fatalf("載入設定檔失敗: %v", err)
 	}
 
-	if config.LLM.ApiKey == "" {
-		log.Fatal("錯誤: env.json 中未設定 LLM.ApiKey")
+	// 可指定模板名稱：go run gemini_gen.go [模板]
+	template := ""
+	if len(os.Args) > 1 {
+		template = os.Args[1]
 	}
-
-	// 2. 初始化 Gemini 客戶端
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(config.LLM.ApiKey))
+	req, err := storygen.NewRequest("prompts", template, storygen.PromptVars{}, time.Now())
 	if err != nil {
-		log.Fatalf("初始化失敗: %v", err)
+		log.Fatalf("%v", err)
 	}
-	defer client.Close()
-
-	// 3. 設定模型 (gemini-2.5-flash)
-	model := client.GenerativeModel("gemini-2.5-flash")
-	model.SetTemperature(0.7)
-	model.ResponseMIMEType = "application/json"
-
-	// 4. ★★★ 強制生成唯一 ID (由 Go 決定，不讓 AI 亂猜) ★★★
-	now := time.Now()
-	// 格式：S2_YYYYMMDD_HH_MM_SS (例如: S2_20251127_14_30_05)
-	// 這樣保證每次按下去都是當下的最新時間
-	fixedID := fmt.Sprintf("S2_%s_%s", now.Format("20060102"), now.Format("15_04_05"))
-
-	sysPrompt := fmt.Sprintf(`
-    【Role】
-    You are a professional Sora2 Video Prompt Generator.
-    Characters: Sir Whiskers (Cat Chef) & Sunny Bun (Rabbit Assistant).
-    Style: Cheerful, Kind, Positive, Disney Pixar, 8k.
-    Forbidden: Violence, Sadness, Darkness, Anger.
-
-    【Task】
-    1. Create ONE (1) new story based on "November 2025" trending topics.
-    2. Use "Viral Logic" for titles and content.
-    3. Output strictly in the specified Single JSON Object format.
-    4. All content must be in ENGLISH.
-
-    【Constraint: ID Assignment】
-    You MUST use this EXACT unique_id for this task: "%s"
-    Do NOT generate your own date or time. Use the provided ID.
 
-    【Prompt Text Format (Strict Cinematic Timeline)】
-    The 'prompt' field must be a single multi-line string using this exact structure:
-    Line 1: @jeremy202.whiskbunbu
-    Line 2: %s [Title]
-    Line 3: [Overall Style Description]
-    Line 4: With Camera Timeline + Music Cues
-    Line 5: 🎬 English Version
-    
-    Scene 1 — [Scene Title]
-    00:00–00:08 — [Camera Shot]
-    [Action Description...]
-    Music: [Music Description]
-    [Character Dialogue if any]
-    Camera: [Camera Movement]
-
-    Scene 2 — [Scene Title]
-    00:08–00:18 — [Camera Shot]
-    [Action Description...]
-    ...
-    END — [Ending Description]
-
-    【JSON Structure Example (Single Object Only)】
-    {
-      "prompt": "@jeremy202.whiskbunbu\n%s Title\nA Sora2 Cinematic Style...\nWith Camera Timeline + Music Cues\n🎬 English Version\n\nScene 1 — The Beginning\n00:00–00:08 — Wide Shot\n...",
-      "metadata": {
-        "unique_id": "%s",
-        "file_name": "%s_FileName.mp4",
-        "title": "Sora AI: Viral Title! 🚀",
-        "description": "Viral description...",
-        "tags": ["Sora", "SoraAI", "Viral", "Cute"],
-        "category_id": "24",
-        "privacy": "private"
-      }
-    }
-
-    Please output ONLY the Single JSON Object. Do NOT output a List/Array.
-    Generate now.
-    `, fixedID, fixedID, fixedID, fixedID, fixedID)
-
-	fmt.Println("正在請求 Gemini 生成故事 (使用強制 ID: " + fixedID + ")...")
-
-	// 5. 發送請求
-	resp, err := model.GenerateContent(
-		ctx,
-		genai.Text(sysPrompt),
-	)
+	gen := &storygen.Gemini{APIKey: config.LLM.ApiKey}
+	story, err := storygen.GenerateWithRepair(context.Background(), gen, req, config.LLM.MaxAttempts)
 	if err != nil {
-		log.Fatalf("生成失敗: %v", err)
+		log.Fatalf("%v", err)
 	}
-
-	// 6. 處理回傳結果並存檔
-	if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
-		var jsonOutput string
-		for _, part := range resp.Candidates[0].Content.Parts {
-			if txt, ok := part.(genai.Text); ok {
-				jsonOutput += string(txt)
-			}
-		}
-
-		jsonOutput = strings.TrimSpace(jsonOutput)
-		jsonOutput = strings.ReplaceAll(jsonOutput, "```json", "")
-		jsonOutput = strings.ReplaceAll(jsonOutput, "```", "")
-		jsonOutput = strings.TrimSpace(jsonOutput)
-
-		fileName := "story.json"
-		err := os.WriteFile(fileName, []byte(jsonOutput), 0644)
-		if err != nil {
-			log.Fatalf("無法寫入檔案 %s: %v", fileName, err)
-		}
-		fmt.Printf("SUCCESS")
-
-	} else {
-		fmt.Println("沒有收到回應。")
-		os.Exit(1)
+	if err := story.WriteFile("story.json"); err != nil {
+		log.Fatalf("無法寫入檔案 story.json: %v", err)
 	}
+	fmt.Printf("SUCCESS")
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"SoraYT_Studio/storygen"
+)
+
+// ==========================================
+// LLM 提供者 (v31)
+// ==========================================
+
+// secretLLMKeyPrefix 為各提供者在憑證庫中的 API Key 名稱前綴 (llm/<名稱>/api_key)
+const secretLLMKeyPrefix = "llm/"
+
+// LLMProviderInfo 為 /api/ai/providers 回傳的提供者摘要 (不含 API Key)
+type LLMProviderInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Model   string `json:"model,omitempty"`
+	Default bool   `json:"default"`
+}
+
+// validateLLMConfig 檢查提供者設定、名稱不重複，且預設提供者存在
+func validateLLMConfig(llm LLMConfig) []string {
+	var problems []string
+	seen := map[string]bool{}
+	for i, p := range llm.Providers {
+		field := fmt.Sprintf("LLM.Providers[%d]", i)
+		for _, msg := range p.Validate() {
+			problems = append(problems, field+": "+msg)
+		}
+		if seen[p.Name] {
+			problems = append(problems, fmt.Sprintf("%s.Name 重複: %s", field, p.Name))
+		}
+		seen[p.Name] = true
+	}
+	if llm.Provider != "" && !seen[llm.Provider] && !isBuiltinProvider(llm.Provider, llm.Providers) {
+		problems = append(problems, fmt.Sprintf("LLM.Provider: 找不到提供者 %q", llm.Provider))
+	}
+	for _, code := range llm.Localizations {
+		if !storygen.ValidLanguageCode(code) {
+			problems = append(problems, fmt.Sprintf("LLM.Localizations: %q 不是有效的語言代碼 (例如 en、ja、zh-TW)", code))
+		}
+	}
+	if llm.MaxAttempts < 0 || llm.MaxAttempts > 10 {
+		problems = append(problems, fmt.Sprintf("LLM.MaxAttempts 必須介於 1 到 10: %d", llm.MaxAttempts))
+	}
+	return problems
+}
+
+// isBuiltinProvider 判斷名稱是否為自動補上的 gemini / fixture
+func isBuiltinProvider(name string, configured []storygen.ProviderConfig) bool {
+	for _, p := range builtinProviders(configured) {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinProviders 回傳自動補上的提供者：沒有任何設定時提供 gemini (使用 LLM.ApiKey)，
+// 並且一律提供離線用的 fixture (除非已有同名設定)
+func builtinProviders(configured []storygen.ProviderConfig) []storygen.ProviderConfig {
+	var list []storygen.ProviderConfig
+	if len(configured) == 0 {
+		list = append(list, storygen.ProviderConfig{Name: storygen.TypeGemini, Type: storygen.TypeGemini})
+	}
+	for _, p := range configured {
+		if p.Name == storygen.TypeFixture {
+			return list
+		}
+	}
+	return append(list, storygen.ProviderConfig{Name: storygen.TypeFixture, Type: storygen.TypeFixture})
+}
+
+// llmProviders 回傳所有可用的提供者，第一個為未指定 LLM.Provider 時的預設
+func (rc *RuntimeConfig) llmProviders() []storygen.ProviderConfig {
+	return append(append([]storygen.ProviderConfig(nil), rc.LLM.Providers...), builtinProviders(rc.LLM.Providers)...)
+}
+
+// llmProvider 依名稱找提供者設定
+func (rc *RuntimeConfig) llmProvider(name string) (storygen.ProviderConfig, bool) {
+	for _, p := range rc.llmProviders() {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return storygen.ProviderConfig{}, false
+}
+
+// defaultLLMProvider 為 LLM.Provider 指定的提供者，未指定時為第一個
+func (rc *RuntimeConfig) defaultLLMProvider() string {
+	if rc.LLM.Provider != "" {
+		return rc.LLM.Provider
+	}
+	return rc.llmProviders()[0].Name
+}
+
+// providerAPIKey 依序取自憑證庫 (llm/<名稱>/api_key)、提供者設定，gemini 類型最後再沿用 LLM.ApiKey
+func (rc *RuntimeConfig) providerAPIKey(p storygen.ProviderConfig) string {
+	if secretVault != nil {
+		if k, ok := secretVault.Get(secretLLMKeyPrefix + p.Name + "/api_key"); ok && k != "" {
+			return k
+		}
+	}
+	if p.ApiKey == "" && p.Type == storygen.TypeGemini {
+		return rc.llmAPIKey()
+	}
+	return p.ApiKey
+}
+
+// storyGenerator 建立指定的提供者 (空字串為預設)
+func (rc *RuntimeConfig) storyGenerator(name string) (storygen.StoryGenerator, string, error) {
+	if name == "" {
+		name = rc.defaultLLMProvider()
+	}
+	p, ok := rc.llmProvider(name)
+	if !ok {
+		return nil, name, fmt.Errorf("找不到 LLM 提供者 %q", name)
+	}
+	p.ApiKey = rc.providerAPIKey(p)
+	gen, err := storygen.New(p)
+	return gen, name, err
+}
+
+// handleLLMProviders 列出可選的提供者，供前端下拉選單使用
+func (st *AppState) handleLLMProviders(w http.ResponseWriter, r *http.Request) {
+	rc := st.Config()
+	def := rc.defaultLLMProvider()
+	list := []LLMProviderInfo{}
+	for _, p := range rc.llmProviders() {
+		list = append(list, LLMProviderInfo{Name: p.Name, Type: p.Type, Model: p.Model, Default: p.Name == def})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// MaxStoryVariants 為一次生成的候選故事上限
+const MaxStoryVariants = 5
+
+// StoryRequest 為一次故事生成的選項：提供者、模板、模板變數與候選數 (空白皆使用預設)
+type StoryRequest struct {
+	Provider string
+	Template string
+	Vars     storygen.PromptVars
+	Count    int                   // 候選數，0 或 1 代表只產生一個並直接寫入 story.json
+	Topics   []string              // 主題清單，每個候選抽一個 (Vars.Topic 由 storyTopics 填入)
+	Progress storygen.ProgressFunc // 接收生成進度 (網頁串流使用，可為 nil)
+}
+
+// splitList 將逗號分隔的字串拆成清單，略過空白項目
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// storyRequestFromQuery 從 /api/ai/generate_story 的查詢參數讀取選項
+func storyRequestFromQuery(q url.Values) StoryRequest {
+	scenes, _ := strconv.Atoi(q.Get("scenes"))
+	duration, _ := strconv.Atoi(q.Get("duration"))
+	count, _ := strconv.Atoi(q.Get("count"))
+	// 主題可用 topics=a,b 或重複的 topic= 傳入
+	var topics []string
+	for _, v := range append(q["topic"], q.Get("topics")) {
+		topics = append(topics, splitList(v)...)
+	}
+	return StoryRequest{
+		Count:    count,
+		Topics:   topics,
+		Provider: q.Get("provider"),
+		Template: q.Get("template"),
+		Vars: storygen.PromptVars{
+			Role:          q.Get("role"),
+			Characters:    q.Get("characters"),
+			Theme:         q.Get("theme"),
+			Brief:         q.Get("brief"),
+			Localizations: parseLocalizations(q.Get("localizations")),
+			Month:         q.Get("month"),
+			Language:      q.Get("language"),
+			SceneCount:    scenes,
+			Duration:      duration,
+		},
+	}
+}
+
+// parseLocalizations 解析翻譯語言代碼清單：空白回傳 nil (使用 LLM.Localizations)，none 代表不翻譯
+func parseLocalizations(s string) []string {
+	list := splitList(s)
+	if len(list) == 1 && list[0] == "none" {
+		return []string{}
+	}
+	return list
+}
+
+// storyTopics 決定每個候選的主題：優先從請求的主題清單抽樣；沒有指定主題、題材與簡介時，
+// 若有設定 LLM.TrendsFile 則依權重從趨勢檔抽樣；都沒有時回傳 nil (模板使用 Month + Theme)
+func storyTopics(rc *RuntimeConfig, sr StoryRequest, n int) []string {
+	if pool := storygen.Topics(sr.Topics); len(pool) > 0 {
+		return storygen.SampleTopics(pool, n, nil)
+	}
+	if sr.Vars.Topic != "" {
+		return nil
+	}
+	if rc.LLM.TrendsFile == "" || sr.Vars.Theme != "" || sr.Vars.Brief != "" {
+		return nil
+	}
+	trends, err := storygen.LoadTrends(rc.LLM.TrendsFile)
+	if err != nil {
+		fmt.Printf("⚠️ 無法使用趨勢檔，改用預設主題: %v\n", err)
+		return nil
+	}
+	topics := storygen.SampleTopics(trends, n, nil)
+	fmt.Printf("📈 從趨勢檔 %s 抽出主題: %s\n", rc.LLM.TrendsFile, strings.Join(topics, ", "))
+	return topics
+}
+
+// handlePromptTemplates 列出提示詞模板 (模板資料夾 + 內建)，預設模板標記 default
+func (st *AppState) handlePromptTemplates(w http.ResponseWriter, r *http.Request) {
+	rc := st.Config()
+	list, err := storygen.ListTemplates(rc.LLM.PromptDir)
+	if err != nil {
+		jsonError(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"default": rc.LLM.Template, "dir": rc.LLM.PromptDir, "templates": list})
+}
+
+// providerNames 供 CLI 說明文字列出可用名稱
+func providerNames(rc *RuntimeConfig) string {
+	var names []string
+	for _, p := range rc.llmProviders() {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ", ")
+}
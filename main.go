@@ -1,26 +1,32 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
+
+	"SoraYT_Studio/storygen"
 )
 
 // ==========================================
@@ -45,10 +51,11 @@ const (
 )
 
 type SoraCredentials struct {
-	BearerToken string
-	Cookie      string
-	DeviceID    string
-	UserAgent   string
+	BearerToken  string
+	Cookie       string
+	DeviceID     string
+	UserAgent    string
+	ExtraHeaders map[string]string `json:",omitempty"` // v31: 匯入時保存的其他 oai-/openai- header
 }
 
 type SoraCreatePayload struct {
@@ -61,8 +68,15 @@ type SoraCreatePayload struct {
 }
 
 type GlobalConfig struct {
-	ScheduleSlots []string `json:"ScheduleSlots"`
-	ArchiveFolder string   `json:"ArchiveFolder"`
+	ScheduleSlots []string         `json:"ScheduleSlots"`
+	Schedule      *ScheduleRules   `json:"Schedule,omitempty"` // v31: 進階排程規則
+	Timezone      string           `json:"Timezone"`           // v31: 頻道時區 (IANA 名稱)
+	ArchiveFolder string           `json:"ArchiveFolder"`
+	Channels      []ChannelProfile `json:"Channels,omitempty"`    // v31: 多頻道設定，第一個為主頻道
+	LLM           LLMConfig        `json:"LLM"`                   // v31: 與 gemini_gen.go 共用
+	Port          int              `json:"Port,omitempty"`        // v31: 網頁介面埠號，預設 9999
+	Listen        string           `json:"Listen,omitempty"`      // v31: 監聽位址，預設 127.0.0.1 (0.0.0.0 開放區網連線)
+	OpenBrowser   bool             `json:"OpenBrowser,omitempty"` // v31: 啟動時自動開啟瀏覽器
 }
 
 type VideoConfig struct {
@@ -78,6 +92,12 @@ type VideoConfig struct {
 	IsManual    bool     `json:"is_manual,omitempty"`
 	IgnoreCalc  bool     `json:"ignore_calc,omitempty"`
 	DownloadURL string   `json:"download_url,omitempty"`
+	Channel     string   `json:"channel,omitempty"`      // v31: 目標頻道 ID，空白代表主頻道
+	SoraAccount string   `json:"sora_account,omitempty"` // v31: 產生此影片的 Sora 帳號
+	Topic       string   `json:"topic,omitempty"`        // v31: AI 生成故事時使用的主題
+	// v31: 主要語言代碼與翻譯，上傳時設定 YouTube 的 defaultLanguage 與 localizations
+	DefaultLanguage string                           `json:"default_language,omitempty"`
+	Localizations   map[string]storygen.Localization `json:"localizations,omitempty"`
 }
 
 type VideoStatus struct {
@@ -85,6 +105,7 @@ type VideoStatus struct {
 	FileName string `json:"file_name"`
 	Title    string `json:"title"`
 	Status   string `json:"status"`
+	Channel  string `json:"channel,omitempty"`
 }
 
 type IPInfo struct {
@@ -95,10 +116,13 @@ type IPInfo struct {
 }
 
 type StatusAPIResponse struct {
-	PendingCount int           `json:"pending_count"`
-	StatusData   []VideoStatus `json:"status_data"`
-	ManualData   []VideoStatus `json:"manual_data"`
-	NextSchedule string        `json:"next_schedule"`
+	PendingCount int             `json:"pending_count"`
+	StatusData   []VideoStatus   `json:"status_data"`
+	ManualData   []VideoStatus   `json:"manual_data"`
+	NextSchedule string          `json:"next_schedule"`
+	Timezone     string          `json:"timezone"`
+	Channels     []ChannelStatus `json:"channels"`
+	Reauth       []ReauthInfo    `json:"reauth_required"`
 }
 
 // v29: Story File Structure
@@ -126,103 +150,178 @@ type MailboxDraft struct {
 	DownloadableURL string `json:"downloadable_url"`
 }
 
-var soraCreds *SoraCredentials
-var youtubeConfig GlobalConfig = GlobalConfig{
-	ScheduleSlots: []string{"00:00", "08:00", "12:00", "16:00"},
-	ArchiveFolder: "_uploaded_videos",
-}
-
 // ==========================================
 // 2. 主程式與初始化
 // ==========================================
 
 func main() {
-	os.MkdirAll(youtubeConfig.ArchiveFolder, 0755)
-	initSoraCredentials()
-	loadGlobalConfig()
+	os.Exit(runCLI(os.Args[1:]))
+}
+
+// initRuntime 解鎖憑證庫並載入 Sora 帳號、角色與 env.json (serve 與各 CLI 子命令共用)
+func initRuntime() (*RuntimeConfig, error) {
+	if err := initVault(); err != nil {
+		return nil, fmt.Errorf("無法解鎖憑證庫: %w", err)
+	}
+	app.sora.load()
+	// 故事庫讀取失敗時不啟動，避免之後存檔覆蓋掉原本的內容
+	if err := app.stories.load(); err != nil {
+		return nil, fmt.Errorf("無法讀取故事庫: %w", err)
+	}
+	app.importStoryFile()
+	app.setRoles(loadRoles())
+	envCfg, err := readGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := app.SetConfig(envCfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ensureArchiveFolders()
+	return cfg, nil
+}
+
+// runServe 啟動網頁介面 (未指定子命令時的預設行為)
+func runServe(args []string) int {
+	fs := newFlagSet("serve", "啟動網頁介面")
+	addr := fs.String("addr", "", "監聽位址 (覆蓋 env.json 的 Listen，例如 0.0.0.0)")
+	portFlag := fs.Int("port", 0, "埠號 (覆蓋 env.json 的 Port)")
+	headless := fs.Bool("headless", false, "伺服器模式：不開啟瀏覽器")
+	open := fs.Bool("open", false, "啟動後開啟瀏覽器 (同 env.json 的 OpenBrowser)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if msg := validateListen(*addr); *addr != "" && msg != "" {
+		fmt.Println("❌ -addr:", msg)
+		return 2
+	}
+	if *portFlag < 0 || *portFlag > 65535 {
+		fmt.Printf("❌ -port: %d 超出範圍 (1-65535)\n", *portFlag)
+		return 2
+	}
+	cfg, err := initRuntime()
+	if err != nil {
+		log.Fatalf("❌ %v\n(可執行 `doctor` 取得完整檢查報告)", err)
+	}
+	fmt.Printf("🕒 頻道時區: %s\n", cfg.Loc)
 
 	fmt.Println("🔍 正在初始化網路環境檢查...")
 	ip := checkIP()
 	fmt.Printf("🌍 當前 IP: %s (國家: %s, 城市: %s)\n", ip.IP, ip.Country, ip.City)
 
-	http.HandleFunc("/", handleHome)
+	http.HandleFunc("/", app.handleHome)
 
 	// Sora API
-	http.HandleFunc("/api/auth/manual", handleManualAuth)
-	http.HandleFunc("/api/sora/create", handleSoraCreate)
-	http.HandleFunc("/api/sora/poll", handleSoraPoll)
-	http.HandleFunc("/api/sora/download", handleSoraDownloadAndRename)
-	http.HandleFunc("/api/sora/history_batch", handleSoraHistoryBatch)
-	http.HandleFunc("/api/debug/history", handleDebugHistory)
+	http.HandleFunc("/api/auth/manual", app.handleManualAuth)
+	http.HandleFunc("/api/sora/create", app.handleSoraCreate)
+	http.HandleFunc("/api/sora/poll", app.handleSoraPoll)
+	http.HandleFunc("/api/sora/download", app.handleSoraDownloadAndRename)
+	http.HandleFunc("/api/sora/history_batch", app.handleSoraHistoryBatch)
+	http.HandleFunc("/api/debug/history", app.handleDebugHistory)
+	http.HandleFunc("/api/sora/session", app.handleSoraSession)
+	http.HandleFunc("/api/sora/accounts", app.handleSoraAccounts)
 
 	// v29: Story Load API (確保這裡只有一行)
 	http.HandleFunc("/api/story/load", handleLoadStory)
-	// v30: 呼叫外部 Gemini 生成器
-	http.HandleFunc("/api/ai/generate_story", handleCallGemini)
+	// v30: 呼叫 Gemini 生成器 (v31: 同一個程序內執行)
+	http.HandleFunc("/api/ai/generate_story", app.handleCallGemini)
+	http.HandleFunc("/api/ai/providers", app.handleLLMProviders)
+	http.HandleFunc("/api/ai/templates", app.handlePromptTemplates)
+	http.HandleFunc("/api/stories", app.handleStories)
+	http.HandleFunc("/api/roles", app.handleRoles)
+	http.HandleFunc("/api/stories/item", app.handleStoryItem)
+	http.HandleFunc("/api/stories/promote", app.handlePromoteStory)
 	// YouTube API
-	http.HandleFunc("/api/status", handleStatusAPI)
+	http.HandleFunc("/api/status", app.handleStatusAPI)
 	http.HandleFunc("/api/video/delete", handleVideoDelete)
-	http.HandleFunc("/youtube/run", handleYoutubeRun)
-	http.HandleFunc("/youtube/manual_schedule", handleManualSchedule)
-	http.HandleFunc("/oauth", handleOAuth)
-
-	port := "9999"
-	url := "http://localhost:" + port
+	http.HandleFunc("/youtube/run", app.handleYoutubeRun)
+	http.HandleFunc("/youtube/manual_schedule", app.handleManualSchedule)
+	http.HandleFunc("/youtube/rebalance", app.handleRebalance)
+	http.HandleFunc("/oauth", app.handleOAuth)
+	http.HandleFunc("/oauth/start", app.handleOAuthStart)
+	http.HandleFunc("/api/youtube/auth_status", app.handleYouTubeAuthStatus)
+	http.HandleFunc("/api/config", app.handleConfig)
+
+	app.startSoraExpiryWatcher()
+	app.startConfigWatcher()
+
+	// v31: 監聽位址與埠號可由 env.json 或命令列指定，預設只接受本機連線
+	host, port := cfg.Listen, cfg.Port
+	if *addr != "" {
+		host = *addr
+	}
+	if *portFlag != 0 {
+		port = *portFlag
+	}
+	ln, err := net.Listen("tcp", listenAddr(host, port))
+	if err != nil {
+		log.Fatalf("❌ 無法監聽 %s: %v", listenAddr(host, port), err)
+	}
+	url := browseURL(host, port)
 	fmt.Printf("🚀 SkyForge v30 (Auto-Loader) 已啟動: %s\n", url)
+	if !isLocalHost(host) {
+		fmt.Printf("⚠️ 正在監聽 %s，區網內的其他裝置也能開啟此介面\n", host)
+	}
+
+	// v31: 瀏覽器改為選擇性開啟；--headless 或沒有桌面環境時一律略過
+	switch {
+	case *headless:
+		fmt.Println("🖥️ Headless 模式，不開啟瀏覽器")
+	case !*open && !cfg.OpenBrowser:
+	case !hasDisplay():
+		fmt.Println("⚠️ 偵測不到桌面環境，略過開啟瀏覽器")
+	default:
+		if err := openBrowser(url); err != nil {
+			fmt.Printf("⚠️ 無法開啟瀏覽器: %v\n", err)
+		}
+	}
 
-	exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
-
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := http.Serve(ln, nil); err != nil {
 		log.Fatal(err)
 	}
+	return 0
 }
 
-func initSoraCredentials() {
+// initSoraCredentials 讀取舊版的單一 Sora 憑證 (v31 起由 soraAccountPool.load 移轉為 default 帳號)
+func initSoraCredentials() *SoraCredentials {
+	var creds *SoraCredentials
+	// v31: 優先從加密憑證庫讀取
+	if secretVault != nil {
+		if data, ok := secretVault.Get(SecretSoraSession); ok {
+			if err := json.Unmarshal([]byte(data), &creds); err == nil && creds.BearerToken != "" {
+				fmt.Println("✅ Sora 憑證已載入 (Vault)")
+				return creds
+			}
+		}
+		if data, ok := secretVault.Get(SecretSoraCurl); ok {
+			if parsed, parseErr := parseCurlContent(data); parseErr == nil {
+				fmt.Println("✅ Sora 憑證已載入 (Vault cURL)")
+				return parsed
+			}
+		}
+	}
 	if data, err := os.ReadFile("session_cache.json"); err == nil {
-		if err := json.Unmarshal(data, &soraCreds); err == nil && soraCreds.BearerToken != "" {
+		if err := json.Unmarshal(data, &creds); err == nil && creds.BearerToken != "" {
 			fmt.Println("✅ Sora 憑證已載入 (Cache)")
-			return
+			return creds
 		}
 	}
 	if data, err := os.ReadFile(UserCurlFile); err == nil {
-		if creds, parseErr := parseCurlContent(string(data)); parseErr == nil {
-			soraCreds = creds
+		if parsed, parseErr := parseCurlContent(string(data)); parseErr == nil {
 			fmt.Println("✅ Sora 憑證已載入 (Userid.txt)")
-			return
+			return parsed
 		}
 	}
 	fmt.Println("⚠️ 無 Sora 憑證，請在網頁更新。")
-}
-
-func loadGlobalConfig() {
-	data, err := os.ReadFile(EnvFile)
-	if err == nil {
-		json.Unmarshal(data, &youtubeConfig)
-	}
-}
-
-func loadRoles() []string {
-	var roles []string
-	file, err := os.Open(RoleFile)
-	if err != nil {
-		return []string{"@jeremy202.whiskbunbu"}
-	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			roles = append(roles, line)
-		}
-	}
-	return roles
+	return nil
 }
 
 // ==========================================
 // 3. 前端介面
 // ==========================================
 
-func handleHome(w http.ResponseWriter, r *http.Request) {
+func (st *AppState) handleHome(w http.ResponseWriter, r *http.Request) {
 	ip := checkIP()
 	ipHtml := ""
 	if ip.Country == "US" || ip.Country == "TW" {
@@ -231,12 +330,16 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 		ipHtml = fmt.Sprintf(`<div style="background:#b71c1c; color:#fff; padding:10px; text-align:center; border-radius:8px; margin-bottom:20px; font-weight:bold;">⚠️ 警告：非慣用地區 IP (%s - %s)</div>`, ip.Country, ip.IP)
 	}
 
-	roles := loadRoles()
+	roles := st.Roles()
 	var rolesHtmlBuilder strings.Builder
 	for _, role := range roles {
+		label := role.Handle
+		if role.Name != "" {
+			label = role.Name + " " + role.Handle
+		}
 		rolesHtmlBuilder.WriteString(fmt.Sprintf(
-			`<div class="role-chip" draggable="true" ondragstart="event.dataTransfer.setData('text/plain', '%s')">%s</div>`,
-			role, role,
+			`<div class="role-chip" draggable="true" data-handle="%s" title="%s" ondragstart="event.dataTransfer.setData('text/plain', this.dataset.handle)">%s</div>`,
+			html.EscapeString(role.Handle), html.EscapeString(role.Bible), html.EscapeString(label),
 		))
 	}
 
@@ -283,6 +386,10 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
         .next-schedule-info { color: #4fc3f7; font-size: 1.1em; margin-bottom: 15px; font-weight: bold; text-align: center; border: 1px solid #4fc3f7; padding: 10px; border-radius: 6px;}
         .checkbox-container { display: flex; align-items: center; margin-bottom: 15px; color: #fff; }
         .checkbox-container input { width: auto; margin-right: 10px; }
+        .variant-row { display: flex; gap: 10px; overflow-x: auto; margin-bottom: 10px; }
+        .variant-card { flex: 1 0 220px; background: #333; border: 1px solid #555; border-radius: 8px; padding: 10px; font-size: 0.85em; }
+        .variant-card h4 { margin: 0 0 6px 0; color: #fff; }
+        .variant-card pre { white-space: pre-wrap; max-height: 160px; overflow-y: auto; color: #ccc; font-size: 0.9em; }
     </style>
 </head>
 <body>
@@ -291,14 +398,50 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
         <div class="container" style="width: 100%%;">
             <div class="card">
                 <h2>🌊 Sora 工廠 (SkyForge)</h2>
-				<button class="btn-ai" onclick="generateStoryFromAI()">🧠 AI 自動生成故事 (Gemini)</button>
+				<button class="btn-ai" onclick="generateStoryFromAI()">🧠 AI 自動生成故事</button>
+                <select id="ai-provider" title="LLM 提供者" style="margin-bottom:10px;"></select>
+                <select id="ai-template" title="提示詞模板" style="margin-bottom:10px;"></select>
+                <select id="ai-role" title="角色 (角色登錄)" style="margin-bottom:10px;"></select>
+                <details style="margin-bottom:10px; font-size:0.9em;">
+                    <summary>模板變數 (留空使用預設)</summary>
+                    <input type="text" id="ai-topics" placeholder="主題清單 (逗號分隔，每個候選抽一個；留空時從趨勢檔抽樣)">
+                    <input type="text" id="ai-theme" placeholder="題材 (預設 trending topics)">
+                    <textarea id="ai-brief" rows="2" placeholder="創作簡介 (自由填寫，例如想要的情節或節日)"></textarea>
+                    <input type="text" id="ai-characters" placeholder="登場角色">
+                    <input type="text" id="ai-month" placeholder="月份 (預設本月，例如 November 2025)">
+                    <input type="text" id="ai-language" placeholder="語言 (預設 English)">
+                    <input type="text" id="ai-localizations" placeholder="翻譯語言代碼，逗號分隔 (例如 zh-TW,ja；none 為不翻譯)">
+                    <input type="number" id="ai-scenes" min="1" placeholder="場景數 (預設 3)">
+                    <input type="number" id="ai-duration" min="1" placeholder="影片秒數 (預設 15)">
+                    <input type="number" id="ai-count" min="1" max="5" placeholder="候選數 (預設 1，多個候選時並排比較後採用)">
+                </details>
+                <div id="ai-status" style="font-size:0.9em; color:#aaa; margin-bottom:10px;"></div>
+                <div id="ai-variants" class="variant-row"></div>
                 <button class="btn-secondary" onclick="toggleManual()" style="width:auto; padding:5px 10px; font-size:0.8em;">更換 Sora 憑證</button>
                 <div id="manual-box" style="display:none; margin-top:10px;">
-                    <textarea id="curl-input" rows="3" placeholder="貼上 Curl..."></textarea>
+                    <input type="text" id="sora-account-name" placeholder="帳號名稱 (留空為 default，新名稱會新增帳號)">
+                    <textarea id="curl-input" rows="3" placeholder="貼上 cURL (bash/cmd)、HAR 或 Copy as fetch..."></textarea>
                     <button onclick="submitManual()" style="background:#4caf50;">保存</button>
                 </div>
 
                 <button class="btn-load" onclick="loadStory()">📂 讀取 story.json 並填入</button>
+                <details id="story-library" style="margin-bottom:15px;" ontoggle="if (this.open) loadStoryLibrary()">
+                    <summary>📚 故事庫 (所有生成過的故事)</summary>
+                    <div style="display:flex; gap:8px; margin-top:10px;">
+                        <input type="text" id="lib-query" placeholder="搜尋標題 / 標籤 / 主題 / ID" oninput="loadStoryLibrary()">
+                        <select id="lib-status" onchange="loadStoryLibrary()" style="width:auto;">
+                            <option value="">全部狀態</option>
+                            <option value="draft">draft 草稿</option>
+                            <option value="queued">queued 已採用</option>
+                            <option value="used">used 已送出</option>
+                            <option value="rejected">rejected 不使用</option>
+                        </select>
+                    </div>
+                    <table>
+                        <thead><tr><th>標題</th><th>狀態</th><th>建立時間</th><th>操作</th></tr></thead>
+                        <tbody id="lib-body"></tbody>
+                    </table>
+                </details>
 
                 <h3>1. 角色 (拖曳)</h3>
                 <div class="role-container">
@@ -306,6 +449,22 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                     %s
                 </div>
 
+                <details style="margin-bottom:10px; font-size:0.9em;">
+                    <summary>🎭 角色登錄 (角色設定、預設標籤與頻道)</summary>
+                    <select id="role-edit" onchange="editRole(this.value)" style="margin-top:10px;"></select>
+                    <input type="text" id="role-handle" placeholder="Sora cameo handle，例如 @jeremy202.whiskbunbu">
+                    <input type="text" id="role-name" placeholder="顯示名稱">
+                    <textarea id="role-bible" rows="3" placeholder="角色設定 (外觀、個性、口頭禪)，生成故事時填入提示詞"></textarea>
+                    <input type="text" id="role-style" placeholder="畫面風格 (留空使用模板預設)">
+                    <input type="text" id="role-tags" placeholder="預設標籤 (逗號分隔)">
+                    <textarea id="role-footer" rows="2" placeholder="說明欄頁尾"></textarea>
+                    <input type="text" id="role-channel" placeholder="目標頻道 ID (留空為主頻道)">
+                    <div style="display:flex; gap:8px;">
+                        <button onclick="saveRole()" style="background:#4caf50;">保存角色</button>
+                        <button class="btn-secondary" onclick="deleteRole()">刪除角色</button>
+                    </div>
+                </details>
+
                 <h3>2. 提示詞 (Prompt)</h3>
                 <textarea id="sora-prompt" rows="6" placeholder="輸入 Sora 提示詞..." ondragover="event.preventDefault()" ondrop="drop(event)"></textarea>
 
@@ -323,15 +482,19 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 
                 <button id="btn-generate" class="btn-sora" onclick="startPipeline()">✨ 執行流水線 (多工並行)</button>
                 <div id="sora-usage-status">點擊生成後顯示剩餘次數</div>
+                <div id="sora-session-status" style="font-size:0.9em; color:#aaa; margin-bottom:15px;">🔑 Sora 憑證狀態載入中...</div>
+                <div id="sora-dead-banner" style="display:none; background:#b71c1c; color:#fff; padding:10px; border-radius:8px; margin-bottom:15px; font-weight:bold;"></div>
                 <div id="sora-status" style="text-align:center; margin:10px 0; font-weight:bold; color:#aaa;">等待指令...</div>
                 
                 <h3>系統日誌</h3>
                 <button class="btn-debug" onclick="runDebug()">🔍 Debug: 顯示完整回應</button>
-                <div id="log">系統就緒... Port: 9999</div>
+                <div id="log">系統就緒... %s</div>
             </div>
 
             <div class="card">
                 <h2>📺 YouTube 排程中心</h2>
+                <div id="reauthBanner" style="display:none; background:#b71c1c; color:#fff; padding:10px; border-radius:8px; margin-bottom:15px; font-weight:bold;"></div>
+                <div id="ytAuthStatus" style="margin-bottom:15px; font-size:0.9em; color:#aaa;">🔐 YouTube 授權狀態載入中...</div>
                 
                 <div style="display:flex; justify-content:space-between; align-items:center; margin-bottom:15px;">
                     <div class="highlight-box" style="margin-bottom:0; flex-grow:1; margin-right:10px;">
@@ -350,10 +513,15 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                 <form id="manualScheduleForm">
                     <select id="manual_file_select" name="filename"><option>載入中...</option></select>
                     <input type="datetime-local" name="publishtime" required>
+                    <small id="manualTzHint" style="display:block; color:#aaa; margin:-5px 0 10px;">時間以頻道時區計算</small>
                     <div class="checkbox-container">
                         <input type="checkbox" id="update_baseline" name="update_baseline" checked>
                         <label for="update_baseline">🔄 更新預計接續時間 (影響後續排程)</label>
                     </div>
+                    <div class="checkbox-container">
+                        <input type="checkbox" id="on_conflict" name="on_conflict" value="shift">
+                        <label for="on_conflict">↪️ 時段衝突時自動順延到下一個空時段</label>
+                    </div>
                     <button type="submit" class="btn-manual">📅 設定排程並立即上傳</button>
                 </form>
                 <div id="manualMsg"></div>
@@ -364,10 +532,12 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                 <form id="uploadForm">
                     <div style="display:flex; gap:10px;">
                         <input type="number" name="limit" value="5" min="1" placeholder="本次上傳數量">
+                        <select name="channel" id="channel_select"><option value="">全部頻道</option></select>
                         <input type="hidden" name="date" value=""> 
                     </div>
                     <button type="submit" class="btn-yt">🚀 開始上傳與歸檔</button>
                 </form>
+                <button class="btn-secondary" onclick="rebalanceSchedule()">♻️ 重新分配待上傳排程 (避開已佔用時段)</button>
 
                 <hr style="margin: 20px 0; border: 0; border-top: 1px dashed #555;">
                 <h3 style="color:#009688;">🔗 強制下載 (救援模式)</h3>
@@ -381,9 +551,9 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
         let STATUS_DATA = %s;
         let MANUAL_DATA = %s;
         
-        function updateUsageDisplay(remaining) {
+        function updateUsageDisplay(remaining, account) {
             const el = document.getElementById('sora-usage-status');
-            el.innerHTML = '剩餘生成次數: <span style="font-weight:bold; color:#f90;">' + remaining + '</span> 次';
+            el.innerHTML = (account ? '[' + account + '] ' : '') + '剩餘生成次數: <span style="font-weight:bold; color:#f90;">' + remaining + '</span> 次';
         }
 
         function log(msg) {
@@ -405,34 +575,258 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                 textArea.focus();
             }
         }
-// v30: 呼叫外部生成器
+// v30: 呼叫外部生成器 (v31: 可選擇 LLM 提供者)
         async function generateStoryFromAI() {
             const status = document.getElementById('ai-status');
             const btn = document.querySelector('.btn-ai');
             
+            const provider = document.getElementById('ai-provider').value;
+            const params = new URLSearchParams({ provider: provider, template: document.getElementById('ai-template').value, role: document.getElementById('ai-role').value });
+            ['topics', 'theme', 'brief', 'characters', 'month', 'language', 'localizations', 'scenes', 'duration', 'count'].forEach(k => {
+                const v = document.getElementById('ai-' + k).value.trim();
+                if (v) params.set(k, v);
+            });
+            params.set('stream', '1');
             btn.disabled = true;
-            status.innerText = "⏳ 正在呼叫 Gemini 撰寫劇本 (約需 5-10 秒)...";
-            log(">>> 呼叫外部 AI 生成器...");
-
-            try {
-                const res = await fetch('/api/ai/generate_story');
-                const data = await res.json();
-                
-                if (res.ok) {
+            status.style.color = "";
+            status.innerText = "⏳ 正在呼叫 " + (provider || "AI") + " 撰寫劇本...";
+            log(">>> 呼叫 AI 生成器 (" + provider + " / " + params.get('template') + ")...");
+            document.getElementById('ai-variants').innerHTML = '';
+
+            // v31: 以 server-sent events 接收進度，串流中的草稿即時顯示在候選區
+            const drafts = {};
+            const es = new EventSource('/api/ai/generate_story?' + params.toString());
+            const finish = () => { es.close(); btn.disabled = false; };
+            es.addEventListener('progress', e => {
+                const ev = JSON.parse(e.data);
+                const d = drafts[ev.id] || (drafts[ev.id] = draftCard(ev.id));
+                switch (ev.stage) {
+                    case 'started': d.stage.innerText = '🕒 準備中' + (ev.text ? ' · ' + ev.text : ''); break;
+                    case 'model_call': d.text.innerText = ''; d.stage.innerText = '🤖 呼叫模型' + (ev.attempt > 1 ? ' (第 ' + ev.attempt + ' 次)' : ''); break;
+                    case 'delta': d.text.innerText += ev.text; d.text.scrollTop = d.text.scrollHeight; d.stage.innerText = '✍️ 撰寫中 (' + d.text.innerText.length + ' 字)'; break;
+                    case 'validating': d.stage.innerText = '🔍 檢查格式'; break;
+                    case 'retry': d.stage.innerText = '⚠️ 格式不符，重試中'; log("⚠️ " + ev.id + " 格式不符: " + ev.problems.join('; ')); break;
+                    case 'saved': d.stage.innerText = '✅ 已存入故事庫'; break;
+                    case 'failed': d.stage.innerText = '❌ ' + ev.text; break;
+                }
+                status.innerText = "⏳ " + ev.id + ": " + d.stage.innerText;
+            });
+            es.addEventListener('done', e => {
+                finish();
+                const data = JSON.parse(e.data);
+                const stories = data.stories || [];
+                if (stories.length > 1 || data.batch) {
+                    log("🎉 已生成 " + stories.length + " 個候選故事 (批次 " + data.batch + ")，已存入故事庫");
+                    status.innerText = "✅ 請從下方候選中選擇要採用的故事";
+                    renderVariants(stories);
+                } else {
                     log("🎉 AI 生成成功！故事已寫入 story.json");
                     status.innerText = "✅ 生成完畢！請按下方按鈕讀取";
-                    status.style.color = "#4caf50";
-                } else {
-                    throw new Error(data.error || "生成失敗");
+                    document.getElementById('ai-variants').innerHTML = '';
                 }
-            } catch(e) {
-                log("❌ AI 錯誤: " + e);
-                status.innerText = "❌ 生成失敗: " + e;
+                status.style.color = "#4caf50";
+                loadStoryLibrary();
+            });
+            es.addEventListener('error', e => {
+                finish();
+                let msg = "與伺服器的連線中斷";
+                if (e.data) {
+                    const data = JSON.parse(e.data);
+                    msg = data.code === 'missing_api_key' ? "尚未設定 API Key (env.json 的 LLM.ApiKey 或提供者的 ApiKey)" : (data.error || "生成失敗");
+                }
+                log("❌ AI 錯誤: " + msg);
+                status.innerText = "❌ 生成失敗: " + msg;
                 status.style.color = "#f44336";
-            } finally {
-                btn.disabled = false;
+            });
+        }
+        // v31: 生成中的草稿卡片 (完成後由 renderVariants 取代)
+        function draftCard(id) {
+            const card = document.createElement('div');
+            card.className = 'variant-card';
+            const title = document.createElement('h4');
+            title.innerText = id;
+            const stage = document.createElement('small');
+            const text = document.createElement('pre');
+            card.append(title, stage, text);
+            document.getElementById('ai-variants').appendChild(card);
+            return { stage: stage, text: text };
+        }
+        // v31: 多個候選故事並排顯示，按下採用後寫入 story.json 並填入表單
+        function renderVariants(stories) {
+            const row = document.getElementById('ai-variants');
+            row.innerHTML = '';
+            stories.forEach(rec => {
+                const meta = rec.story.metadata || {};
+                const card = document.createElement('div');
+                card.className = 'variant-card';
+                const title = document.createElement('h4');
+                title.innerText = meta.title || rec.id;
+                const id = document.createElement('small');
+                const langs = Object.keys(meta.localizations || {});
+                id.innerText = rec.id + (meta.topic ? ' · ' + meta.topic : '') + (langs.length ? ' · ' + [meta.default_language || 'en'].concat(langs).join('/') : '');
+                const desc = document.createElement('p');
+                desc.innerText = meta.description || '';
+                const prompt = document.createElement('pre');
+                prompt.innerText = rec.story.prompt;
+                const btn = document.createElement('button');
+                btn.className = 'btn-load';
+                btn.innerText = '✅ 採用';
+                btn.onclick = () => promoteStory(rec.id);
+                card.append(title, id, desc, prompt, btn);
+                row.appendChild(card);
+            });
+        }
+        async function promoteStory(id) {
+            try {
+                const res = await fetch('/api/stories/promote', { method: 'POST', body: new URLSearchParams({ id: id }) });
+                const data = await res.json();
+                if (!res.ok) throw new Error(data.error || "採用失敗");
+                fillStory(data.story);
+                log("✅ 已採用故事 " + id + " (story.json 已更新)");
+                loadStoryLibrary();
+            } catch(e) {
+                log("❌ 採用失敗: " + e);
             }
         }
+        // v31: 故事庫清單 (展開時才載入)
+        async function loadStoryLibrary() {
+            if (!document.getElementById('story-library').open) return;
+            const params = new URLSearchParams({ q: document.getElementById('lib-query').value, status: document.getElementById('lib-status').value });
+            try {
+                const res = await fetch('/api/stories?' + params.toString());
+                const list = await res.json();
+                const body = document.getElementById('lib-body');
+                body.innerHTML = '';
+                if (list.length === 0) body.innerHTML = '<tr><td colspan="4" style="color:#aaa;">沒有符合的故事</td></tr>';
+                list.forEach(rec => {
+                    const tr = document.createElement('tr');
+                    const title = document.createElement('td');
+                    title.innerText = (rec.story.metadata.title || rec.id);
+                    title.title = rec.id + (rec.story.metadata.topic ? ' / 主題: ' + rec.story.metadata.topic : '') + ' / ' + (rec.story.metadata.tags || []).join(', ');
+                    const status = document.createElement('td');
+                    status.innerText = rec.status;
+                    const created = document.createElement('td');
+                    created.innerText = new Date(rec.created_at).toLocaleString();
+                    const actions = document.createElement('td');
+                    actions.style.whiteSpace = 'nowrap';
+                    const use = document.createElement('button');
+                    use.className = 'btn-delete';
+                    use.style.background = '#ff9800';
+                    use.style.color = 'black';
+                    use.innerText = '📂 載入';
+                    use.onclick = () => promoteStory(rec.id);
+                    const reject = document.createElement('button');
+                    reject.className = 'btn-delete';
+                    reject.style.background = '#555';
+                    reject.innerText = '🚫';
+                    reject.title = '標記為不使用';
+                    reject.onclick = () => setStoryStatus(rec.id, 'rejected');
+                    const del = document.createElement('button');
+                    del.className = 'btn-delete';
+                    del.innerText = '🗑️';
+                    del.onclick = () => deleteStory(rec.id);
+                    actions.append(use, reject, del);
+                    tr.append(title, status, created, actions);
+                    body.appendChild(tr);
+                });
+            } catch(e) { log("⚠️ 無法載入故事庫: " + e); }
+        }
+        async function setStoryStatus(id, status) {
+            const res = await fetch('/api/stories/item?id=' + encodeURIComponent(id), { method: 'PUT', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ status: status }) });
+            if (!res.ok) { const d = await res.json(); log("❌ 無法更新故事: " + d.error); }
+            loadStoryLibrary();
+        }
+        async function deleteStory(id) {
+            if (!confirm('確定要從故事庫刪除 [' + id + '] 嗎？')) return;
+            const res = await fetch('/api/stories/item?id=' + encodeURIComponent(id), { method: 'DELETE' });
+            if (!res.ok) { const d = await res.json(); log("❌ 無法刪除故事: " + d.error); }
+            loadStoryLibrary();
+        }
+        // v31: 角色登錄 (生成用的角色選單與編輯表單)
+        let roleRegistry = [];
+        async function loadRoleRegistry() {
+            try {
+                const res = await fetch('/api/roles');
+                roleRegistry = await res.json();
+                const sel = document.getElementById('ai-role');
+                const edit = document.getElementById('role-edit');
+                sel.innerHTML = '';
+                edit.innerHTML = '<option value="">＋ 新增角色</option>';
+                roleRegistry.forEach(p => {
+                    const label = (p.Name ? p.Name + ' ' : '') + p.Handle;
+                    [sel, edit].forEach(s => {
+                        const opt = document.createElement('option');
+                        opt.value = p.Handle;
+                        opt.innerText = label;
+                        s.appendChild(opt);
+                    });
+                });
+            } catch(e) { log("⚠️ 無法載入角色登錄: " + e); }
+        }
+        function editRole(handle) {
+            const p = roleRegistry.find(r => r.Handle === handle) || {};
+            document.getElementById('role-handle').value = p.Handle || '';
+            document.getElementById('role-name').value = p.Name || '';
+            document.getElementById('role-bible').value = p.Bible || '';
+            document.getElementById('role-style').value = p.Style || '';
+            document.getElementById('role-tags').value = (p.DefaultTags || []).join(', ');
+            document.getElementById('role-footer').value = p.DescriptionFooter || '';
+            document.getElementById('role-channel').value = p.Channel || '';
+        }
+        async function saveRole() {
+            const v = id => document.getElementById(id).value.trim();
+            const role = {
+                Handle: v('role-handle'), Name: v('role-name'), Bible: v('role-bible'), Style: v('role-style'),
+                DefaultTags: v('role-tags').split(',').map(t => t.trim()).filter(t => t),
+                DescriptionFooter: v('role-footer'), Channel: v('role-channel'),
+            };
+            const res = await fetch('/api/roles', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(role) });
+            if (!res.ok) { log("❌ 無法保存角色: " + await res.text()); return; }
+            log("✅ 已保存角色 " + role.Handle + " (重新整理頁面以更新拖曳標籤)");
+            await loadRoleRegistry();
+            document.getElementById('role-edit').value = role.Handle;
+        }
+        async function deleteRole() {
+            const handle = document.getElementById('role-edit').value;
+            if (!handle || !confirm('確定要刪除角色 [' + handle + '] 嗎？')) return;
+            const res = await fetch('/api/roles?handle=' + encodeURIComponent(handle), { method: 'DELETE' });
+            if (!res.ok) { log("❌ 無法刪除角色: " + await res.text()); return; }
+            log("🗑️ 已刪除角色 " + handle);
+            await loadRoleRegistry();
+            editRole('');
+        }
+        // v31: 載入 LLM 提供者清單
+        async function loadAIProviders() {
+            try {
+                const res = await fetch('/api/ai/providers');
+                const list = await res.json();
+                const sel = document.getElementById('ai-provider');
+                sel.innerHTML = '';
+                list.forEach(p => {
+                    const opt = document.createElement('option');
+                    opt.value = p.name;
+                    opt.innerText = p.name + (p.model ? ' (' + p.model + ')' : '') + (p.default ? ' ★' : '');
+                    if (p.default) opt.selected = true;
+                    sel.appendChild(opt);
+                });
+            } catch(e) { log("⚠️ 無法載入 LLM 提供者: " + e); }
+        }
+        // v31: 載入提示詞模板清單
+        async function loadAITemplates() {
+            try {
+                const res = await fetch('/api/ai/templates');
+                const data = await res.json();
+                const sel = document.getElementById('ai-template');
+                sel.innerHTML = '';
+                (data.templates || []).forEach(t => {
+                    const opt = document.createElement('option');
+                    opt.value = t.name;
+                    opt.innerText = t.name + (t.description ? ' — ' + t.description : '');
+                    if (t.name === data.default) opt.selected = true;
+                    sel.appendChild(opt);
+                });
+            } catch(e) { log("⚠️ 無法載入提示詞模板: " + e); }
+        }
         async function fetchAndUpdateTables() {
             const res = await fetch('/api/status');
             const data = await res.json();
@@ -441,6 +835,33 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
             renderTable();
             populateSelect();
             document.querySelector('.highlight-box span').innerText = data.pending_count + ' 部';
+            if (data.channels && data.channels.length > 1) {
+                const chSel = document.getElementById('channel_select');
+                const current = chSel.value;
+                chSel.innerHTML = '<option value="">全部頻道</option>';
+                data.channels.forEach(c => chSel.add(new Option(c.name + ' (下一時段 ' + c.next_schedule + ')', c.id)));
+                chSel.value = current;
+            }
+            const banner = document.getElementById('reauthBanner');
+            if (data.reauth_required && data.reauth_required.length > 0) {
+                banner.style.display = 'block';
+                // 頻道名稱與原因來自設定與錯誤訊息，以 textContent 輸出避免被當成 HTML
+                banner.replaceChildren();
+                data.reauth_required.forEach((x, i) => {
+                    if (i > 0) banner.appendChild(document.createElement('br'));
+                    banner.appendChild(document.createTextNode('⚠️ ' + x.channel_name + ' 需要重新授權 YouTube (' + x.reason + ') — '));
+                    const link = document.createElement('a');
+                    link.style.color = '#fff';
+                    link.href = '/oauth/start?channel=' + encodeURIComponent(x.channel_id);
+                    link.textContent = '立即重新連結';
+                    banner.appendChild(link);
+                });
+            } else {
+                banner.style.display = 'none';
+            }
+            if (data.timezone) {
+                document.getElementById('manualTzHint').innerText = '時間以頻道時區 (' + data.timezone + ') 計算';
+            }
             if (data.next_schedule) {
                 document.getElementById('nextScheduleDisplay').innerText = '📅 預計接續排程時間：' + data.next_schedule;
             } else {
@@ -448,11 +869,90 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
             }
         }
 
+        // v31: Sora session 狀態；失效時暫停所有監控中的任務
+        let SORA_PAUSED = false;
+        async function refreshSoraSession() {
+            try {
+                const res = await fetch('/api/sora/session');
+                const st = await res.json();
+                const el = document.getElementById('sora-session-status');
+                const banner = document.getElementById('sora-dead-banner');
+                const colors = { ok: '#4caf50', expiring: '#ff9800', expired: '#f44336', dead: '#f44336', missing: '#f44336', unknown: '#aaa' };
+                let text = '🔑 ' + st.message;
+                if (st.expires_at) {
+                    const h = Math.floor(Math.max(st.expires_in_seconds, 0) / 3600);
+                    const m = Math.floor(Math.max(st.expires_in_seconds, 0) %% 3600 / 60);
+                    text += ' (到期: ' + st.expires_at + '，剩餘 ' + h + ' 小時 ' + m + ' 分)';
+                }
+                if (st.user_id) text += ' · ' + st.user_id;
+                // v31: 多帳號時逐一列出各帳號狀態
+                if (st.accounts && st.accounts.length > 1) {
+                    text += '\n' + st.accounts.map(a => '  ' + a.account + ': ' + a.state + (a.expires_at ? ' (到期 ' + a.expires_at + ')' : '')).join('\n');
+                }
+                el.innerText = text;
+                el.style.color = colors[st.state] || '#aaa';
+
+                const wasPaused = SORA_PAUSED;
+                SORA_PAUSED = (st.state === 'dead' || st.state === 'expired' || st.state === 'missing');
+                if (SORA_PAUSED) {
+                    banner.style.display = 'block';
+                    banner.innerText = '⛔ ' + st.message + ' — 任務佇列已暫停，更新憑證後會自動繼續';
+                    document.getElementById('manual-box').style.display = 'block';
+                    if (!wasPaused) log('⛔ Sora 憑證失效，暫停所有任務監控，請重新貼上 cURL');
+                } else {
+                    banner.style.display = 'none';
+                    if (wasPaused) log('▶️ Sora 憑證已恢復，繼續任務監控');
+                }
+            } catch(e) { console.error(e); }
+        }
+        setInterval(refreshSoraSession, 60000);
+
+        async function loadYouTubeAuth() {
+            const box = document.getElementById('ytAuthStatus');
+            try {
+                const res = await fetch('/api/youtube/auth_status');
+                const list = await res.json();
+                box.innerHTML = '';
+                // 頻道與帳號名稱來自設定檔與 YouTube，以 innerText 顯示避免被當成 HTML
+                list.forEach(s => {
+                    const line = document.createElement('div');
+                    line.style.cssText = 'display:flex; align-items:center; gap:10px; margin-bottom:5px;';
+                    const label = document.createElement('span');
+                    if (s.connected) {
+                        label.style.color = '#4caf50';
+                        label.innerText = '🟢 ' + s.channel_name + '：' + (s.account || '已授權');
+                        const expiry = document.createElement('small');
+                        expiry.innerText = 'Token 到期: ' + (s.expiry || '未知') + (s.has_refresh_token ? ' (可自動更新)' : ' (無 refresh token)');
+                        line.append(label, expiry);
+                    } else {
+                        label.style.color = '#f44336';
+                        label.innerText = '🔴 ' + s.channel_name + '：尚未連結';
+                        line.append(label);
+                    }
+                    const link = document.createElement('a');
+                    link.href = '/oauth/start?channel=' + encodeURIComponent(s.channel_id);
+                    link.innerHTML = '<button class="btn-secondary" style="width:auto; padding:5px 10px; font-size:0.8em; margin:0;">🔗 連結 YouTube</button>';
+                    line.append(link);
+                    box.appendChild(line);
+                });
+            } catch(e) { box.innerText = '❌ 無法取得授權狀態: ' + e; }
+        }
+
         window.onload = function() {
             fetchAndUpdateTables();
+            loadYouTubeAuth();
+            refreshSoraSession();
+            loadAIProviders();
+            loadAITemplates();
+            loadRoleRegistry();
         };
 
         // v29: Load Story
+        function fillStory(data) {
+            // 自動填入
+            if(data.prompt) document.getElementById('sora-prompt').value = data.prompt;
+            if(data.metadata) document.getElementById('meta-json').value = JSON.stringify(data.metadata, null, 2);
+        }
 // v29: 前端讀檔邏輯
         async function loadStory() {
             log(">>> 正在讀取 story.json ...");
@@ -462,12 +962,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                     const errData = await res.json();
                     throw new Error(errData.error || "無法讀取檔案");
                 }
-                const data = await res.json();
-                
-                // 自動填入
-                if(data.prompt) document.getElementById('sora-prompt').value = data.prompt;
-                if(data.metadata) document.getElementById('meta-json').value = JSON.stringify(data.metadata, null, 2);
-                
+                fillStory(await res.json());
                 log("✅ 故事與設定已載入！");
             } catch(e) {
                 alert("讀取失敗: " + e);
@@ -543,6 +1038,7 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
             const prompt = document.getElementById('sora-prompt').value;
             const jsonStr = document.getElementById('meta-json').value;
             if(!prompt) return alert("請輸入提示詞");
+            if(SORA_PAUSED) return alert("Sora 憑證已失效，請先重新貼上 cURL");
             let metaObj;
             try {
                 metaObj = JSON.parse(jsonStr);
@@ -559,11 +1055,12 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
                 });
                 const data = await res.json();
                 if(data.error) throw data.error;
-                if (data.rate_limit_and_credit_balance.estimated_num_videos_remaining !== undefined) {
-                    updateUsageDisplay(data.rate_limit_and_credit_balance.estimated_num_videos_remaining);
+                if (data.rate_limit_and_credit_balance && data.rate_limit_and_credit_balance.estimated_num_videos_remaining !== undefined) {
+                    updateUsageDisplay(data.rate_limit_and_credit_balance.estimated_num_videos_remaining, data.account);
                 }
                 const taskId = data.id;
-                log("✅ 任務 ID: " + taskId + " 已建立");
+                metaObj.sora_account = data.account;
+                log("✅ 任務 ID: " + taskId + " 已建立 (帳號: " + data.account + ")");
                 status.innerText = "⏳ 生成中 (請稍候)...";
                 setTimeout(() => { pollSora(taskId, metaObj, prompt); }, 3000);
             } catch(e) { log("❌ 錯誤: " + e); }
@@ -574,11 +1071,13 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
             let attempts = 0;
             log("👀 開始監控: " + metaObj.file_name);
             const timer = setInterval(async () => {
+                if(SORA_PAUSED) return; // 憑證失效時暫停，不計入超時
                 attempts++;
                 if(attempts > 600) { clearInterval(timer); log("❌ 任務超時: " + metaObj.file_name); return; }
                 try {
-                    const res = await fetch('/api/sora/poll?task_id=' + taskId + '&prompt=' + encodeURIComponent(originalPrompt));
+                    const res = await fetch('/api/sora/poll?task_id=' + taskId + '&account=' + encodeURIComponent(metaObj.sora_account || '') + '&prompt=' + encodeURIComponent(originalPrompt));
                     const data = await res.json();
+                    if(data.error && data.error.indexOf('憑證已失效') >= 0) { refreshSoraSession(); return; }
                     if(data.status === 'running') {
                         if(attempts %% 10 === 0) log("⏳ " + metaObj.file_name + " 生成中...");
                     } else if(data.status === 'done') {
@@ -729,16 +1228,40 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
             fetchAndUpdateTables(); 
         };
 
+        async function rebalanceSchedule() {
+            if(!confirm('將重新分配所有待上傳 (非手動) 影片的預排時段，確定嗎？')) return;
+            log(">>> 重新分配排程...");
+            try {
+                const res = await fetch('/youtube/rebalance', { method: 'POST' });
+                const data = await res.json();
+                if(!res.ok) throw data.error;
+                (data.plan || []).forEach(p => log("📌 " + p.file_name + " → " + p.publish_at));
+                log("✅ 已重新分配 " + (data.plan || []).length + " 部影片");
+                fetchAndUpdateTables();
+            } catch(e) { log("❌ 重新分配失敗: " + e); }
+        }
+
         function toggleManual() { document.getElementById('manual-box').style.display = 'block'; }
         async function submitManual() {
             const c = document.getElementById('curl-input').value;
-            await fetch('/api/auth/manual', { method:'POST', headers:{'Content-Type':'application/x-www-form-urlencoded'}, body:'curl='+encodeURIComponent(c)});
-            location.reload();
+            const account = document.getElementById('sora-account-name').value.trim();
+            const res = await fetch('/api/auth/manual', { method:'POST', headers:{'Content-Type':'application/x-www-form-urlencoded'}, body:'curl='+encodeURIComponent(c)+'&account='+encodeURIComponent(account)});
+            const data = await res.json();
+            const rep = data.report;
+            if (rep) {
+                let msg = '格式: ' + rep.format + '\n找到: ' + rep.found.join(', ') + '\n缺少: ' + (rep.missing.length ? rep.missing.join(', ') : '無');
+                if (rep.extra_headers && rep.extra_headers.length) msg += '\n其他 header: ' + rep.extra_headers.join(', ');
+                msg += '\n驗證: ' + (rep.validated ? '✅ 通過' : '⚠️ ' + (rep.validation_error || '未驗證'));
+                alert((res.ok ? '✅ 憑證已更新 (帳號: ' + data.account + ')\n\n' : '❌ ' + data.error + '\n\n') + msg);
+            } else if (!res.ok) {
+                return alert('❌ ' + data.error);
+            }
+            if (res.ok) location.reload();
         }
     </script>
 </body>
 </html>
-	`, ipHtml, rolesHtmlBuilder.String(), pendingCount, statusJSON, manualJSON)
+	`, ipHtml, rolesHtmlBuilder.String(), r.Host, pendingCount, statusJSON, manualJSON)
 
 	w.Write([]byte(html))
 }
@@ -755,19 +1278,33 @@ func handleLoadStory(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "找不到 story.json 檔案 (請確認檔案在根目錄)")
 		return
 	}
+	// v31: 先驗證格式再交給前端 (不檢查 ID 與場景數，手動編輯的檔案也能載入)
+	story, err := storygen.Parse(string(data), storygen.Request{})
+	if err != nil {
+		jsonError(w, "story.json 格式錯誤: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(story)
+}
+
+func (st *AppState) handleStatusAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
+	json.NewEncoder(w).Encode(st.buildStatus())
 }
 
-func handleStatusAPI(w http.ResponseWriter, r *http.Request) {
+// buildStatus 彙整待上傳影片與各頻道下一個排程時段 (網頁與 CLI `status` 共用)
+func (st *AppState) buildStatus() StatusAPIResponse {
+	rc := st.Config()
 	videos, _ := loadConfig(ConfigFile)
 	statusList := []VideoStatus{}
 	manualList := []VideoStatus{}
 	pendingCount := 0
 
-	var lastScheduledTime time.Time
+	lastScheduled := map[string]time.Time{}
 
 	for _, v := range videos {
+		ch := rc.resolveChannel(v.Channel)
 		if !v.Uploaded {
 			pendingCount++
 			status := "Missing"
@@ -777,6 +1314,7 @@ func handleStatusAPI(w http.ResponseWriter, r *http.Request) {
 			entry := VideoStatus{
 				UniqueID: v.UniqueID,
 				FileName: v.FileName, Title: v.Title, Status: status,
+				Channel: v.Channel,
 			}
 			if v.IsManual {
 				manualList = append(manualList, entry)
@@ -784,49 +1322,33 @@ func handleStatusAPI(w http.ResponseWriter, r *http.Request) {
 				statusList = append(statusList, entry)
 			}
 		}
-		if v.PublishAt != "" && !v.IgnoreCalc {
+		if v.PublishAt != "" && !v.IgnoreCalc && ch != nil {
 			t, err := time.Parse(time.RFC3339, v.PublishAt)
-			if err == nil && t.After(lastScheduledTime) {
-				lastScheduledTime = t
+			if err == nil && t.After(lastScheduled[ch.ID]) {
+				lastScheduled[ch.ID] = t
 			}
 		}
 	}
 
-	nextSlot := calculateNextSlot(lastScheduledTime)
-	loc, _ := time.LoadLocation("Asia/Taipei")
-	nextSlotStr := nextSlot.In(loc).Format("2006-01-02 15:04")
+	channels := []ChannelStatus{}
+	for _, ch := range rc.channels {
+		next := ch.nextSlot(lastScheduled[ch.ID])
+		channels = append(channels, ChannelStatus{
+			ID: ch.ID, Name: ch.Name,
+			NextSchedule: next.In(ch.location()).Format("2006-01-02 15:04"),
+		})
+	}
+	nextSlotStr := channels[0].NextSchedule
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(StatusAPIResponse{
+	return StatusAPIResponse{
 		PendingCount: pendingCount,
 		StatusData:   statusList,
 		ManualData:   manualList,
 		NextSchedule: nextSlotStr,
-	})
-}
-
-func calculateNextSlot(lastTime time.Time) time.Time {
-	loc, _ := time.LoadLocation("Asia/Taipei")
-	if lastTime.IsZero() {
-		lastTime = time.Now()
-	} else {
-		lastTime = lastTime.In(loc)
-	}
-	baseDate := time.Date(lastTime.Year(), lastTime.Month(), lastTime.Day(), 0, 0, 0, 0, loc)
-	for _, slot := range youtubeConfig.ScheduleSlots {
-		parts := strings.Split(slot, ":")
-		h, _ := strconv.Atoi(parts[0])
-		m, _ := strconv.Atoi(parts[1])
-		candidate := time.Date(baseDate.Year(), baseDate.Month(), baseDate.Day(), h, m, 0, 0, loc)
-		if candidate.After(lastTime) {
-			return candidate
-		}
+		Timezone:     rc.Loc.String(),
+		Channels:     channels,
+		Reauth:       reauthList(rc),
 	}
-	nextDay := baseDate.AddDate(0, 0, 1)
-	parts := strings.Split(youtubeConfig.ScheduleSlots[0], ":")
-	h, _ := strconv.Atoi(parts[0])
-	m, _ := strconv.Atoi(parts[1])
-	return time.Date(nextDay.Year(), nextDay.Month(), nextDay.Day(), h, m, 0, 0, loc)
 }
 
 func handleVideoDelete(w http.ResponseWriter, r *http.Request) {
@@ -858,59 +1380,133 @@ func handleVideoDelete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func handleManualAuth(w http.ResponseWriter, r *http.Request) {
+func (st *AppState) handleManualAuth(w http.ResponseWriter, r *http.Request) {
 	curl := r.FormValue("curl")
-	creds, err := parseCurlContent(curl)
+	creds, report, err := importSoraCredentials(curl)
 	if err != nil {
 		jsonError(w, err.Error())
 		return
 	}
-	soraCreds = creds
-	saveCredentialsCache(creds)
-	jsonError(w, "success")
-}
 
-func handleSoraCreate(w http.ResponseWriter, r *http.Request) {
-	if soraCreds == nil {
-		jsonError(w, "未登入")
+	// v31: 先以新憑證打一次 pending API 驗證；401/403 直接拒絕，網路錯誤則僅警告
+	if r.FormValue("skip_validate") != "1" {
+		_, status, verr := st.sendSoraRequestWith(creds, "GET", SoraPendingEndpoint, nil)
+		if verr == nil {
+			report.Validated = true
+		} else {
+			report.ValidationError = verr.Error()
+			if status == http.StatusUnauthorized || status == http.StatusForbidden {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"error": "憑證驗證失敗: " + verr.Error(), "report": report})
+				return
+			}
+		}
+	}
+	// v31: 依帳號名稱儲存，可同時登入多個 Sora 帳號
+	account := strings.TrimSpace(r.FormValue("account"))
+	if account == "" {
+		account = DefaultSoraAccount
+	}
+	fmt.Printf("🔑 匯入 Sora 憑證 [%s] (%s)：找到 %v，缺少 %v\n", account, report.Format, report.Found, report.Missing)
+
+	if err := st.sora.upsert(account, creds); err != nil {
+		jsonError(w, err.Error())
 		return
 	}
-	prompt := r.FormValue("prompt")
-	payload := SoraCreatePayload{Kind: "video", Prompt: prompt, Orientation: "portrait", Size: "small", NFrames: 300, Model: ModelName}
-	respBody, err := sendSoraRequest("POST", SoraCreateEndpoint, payload)
+	st.sora.resetSession(account)
+	if claims, err := decodeSoraToken(creds.BearerToken); err == nil && !claims.ExpiresAt.IsZero() {
+		fmt.Printf("🔑 Sora 憑證已更新 [%s] (使用者: %s, 到期: %s)\n", account, claims.UserID, claims.ExpiresAt.In(st.Config().Loc).Format("2006-01-02 15:04"))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "account": account, "report": report})
+}
+
+func (st *AppState) handleSoraCreate(w http.ResponseWriter, r *http.Request) {
+	resp, err := st.createSoraTask(r.FormValue("prompt"))
 	if err != nil {
 		jsonError(w, err.Error())
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(respBody)
+	json.NewEncoder(w).Encode(resp)
 }
 
-// v28: Poll Handler - 精準 Task ID 比對
-func handleSoraPoll(w http.ResponseWriter, r *http.Request) {
-	if soraCreds == nil {
-		jsonError(w, "未登入")
-		return
+// v31: 挑選剩餘額度最多的帳號送出任務；額度用完 (HTTP 429) 時自動換下一個帳號。
+// 回傳 Sora 的原始回應並附上 account 欄位
+func (st *AppState) createSoraTask(prompt string) (map[string]interface{}, error) {
+	payload := SoraCreatePayload{Kind: "video", Prompt: prompt, Orientation: "portrait", Size: "small", NFrames: 300, Model: ModelName}
+	for {
+		acc, err := st.sora.pick()
+		if err != nil {
+			return nil, err
+		}
+		respBody, err := st.sendSoraRequest(acc, "POST", SoraCreateEndpoint, payload)
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "HTTP 429") {
+				fmt.Printf("⚠️ [%s] 額度已用完，改用其他帳號\n", acc.Name)
+				st.sora.setRemaining(acc.Name, 0)
+				continue
+			}
+			if errors.Is(err, errSoraSessionDead) {
+				continue
+			}
+			return nil, err
+		}
+
+		var resp map[string]interface{}
+		if err := json.Unmarshal(respBody, &resp); err != nil {
+			return nil, fmt.Errorf("Sora 回應格式錯誤")
+		}
+		if id, _ := resp["id"].(string); id != "" {
+			st.sora.recordTask(id, acc.Name)
+		}
+		if balance, ok := resp["rate_limit_and_credit_balance"].(map[string]interface{}); ok {
+			if n, ok := balance["estimated_num_videos_remaining"].(float64); ok {
+				st.sora.setRemaining(acc.Name, int(n))
+			}
+		}
+		resp["account"] = acc.Name
+		fmt.Printf("🎬 [%s] 已送出 Sora 任務\n", acc.Name)
+		st.markStoryUsed(prompt)
+		return resp, nil
 	}
-	targetTaskId := r.URL.Query().Get("task_id")
-	// ❌ 移除未使用的 targetPrompt
+}
 
-	pendingData, err := sendSoraRequest("GET", SoraPendingEndpoint, nil)
+// v28: Poll Handler - 精準 Task ID 比對
+func (st *AppState) handleSoraPoll(w http.ResponseWriter, r *http.Request) {
+	links, done, err := st.pollSoraTask(r.URL.Query().Get("task_id"), r.URL.Query().Get("account"))
 	if err != nil {
 		jsonError(w, err.Error())
 		return
 	}
-
-	if targetTaskId != "" && strings.Contains(string(pendingData), targetTaskId) {
-		w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "application/json")
+	if !done {
 		json.NewEncoder(w).Encode(map[string]string{"status": "running"})
 		return
 	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "done", "download_links": links})
+}
 
-	mailData, err := sendSoraRequest("GET", SoraHistoryEndpoint, nil)
+// pollSoraTask 查詢任務是否仍在 pending；完成時從 mailbox 取出下載連結
+func (st *AppState) pollSoraTask(targetTaskId, account string) ([]string, bool, error) {
+	// v31: 任務只能在送出它的帳號查詢
+	acc, err := st.sora.resolve(account, targetTaskId)
 	if err != nil {
-		jsonError(w, err.Error())
-		return
+		return nil, false, err
+	}
+	pendingData, err := st.sendSoraRequest(acc, "GET", SoraPendingEndpoint, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if targetTaskId != "" && strings.Contains(string(pendingData), targetTaskId) {
+		return nil, false, nil
+	}
+
+	mailData, err := st.sendSoraRequest(acc, "GET", SoraHistoryEndpoint, nil)
+	if err != nil {
+		return nil, false, err
 	}
 
 	// 使用 Task ID 進行提取
@@ -920,10 +1516,7 @@ func handleSoraPoll(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("⚠️ 無法匹配 Task ID，啟動保底機制 (抓取最新)...")
 		links = extractFirstValidLink(string(mailData))
 	}
-
-	response := map[string]interface{}{"status": "done", "download_links": links}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	return links, true, nil
 }
 
 // v28 New: Extract by Task ID
@@ -973,8 +1566,7 @@ func extractLinksSmart(jsonBody string, targetPrompt string) []string {
 		return nil
 	}
 	var bestLinks []string
-	idRegex := regexp.MustCompile(`(S2_\d+_\d+_\d+)`)
-	targetID := idRegex.FindString(targetPrompt)
+	targetID := storygen.IDPattern.FindString(targetPrompt)
 	targetKey := normalizePrompt(targetPrompt)
 	for _, item := range mailboxResponse.Items {
 		if item.Kind != "sora_gen_complete" {
@@ -1013,20 +1605,41 @@ func extractFirstValidLink(jsonBody string) []string {
 	return nil
 }
 
-func handleSoraHistoryBatch(w http.ResponseWriter, r *http.Request) {
-	if soraCreds == nil {
-		jsonError(w, "未登入")
-		return
-	}
-	mailBody, err := sendSoraRequest("GET", SoraHistoryEndpoint, nil)
+func (st *AppState) handleSoraHistoryBatch(w http.ResponseWriter, r *http.Request) {
+	syncedCount, err := st.syncMailbox()
 	if err != nil {
 		jsonError(w, err.Error())
 		return
 	}
-	var mailboxResponse MailboxResponse
-	if err := json.Unmarshal(mailBody, &mailboxResponse); err != nil {
-		jsonError(w, "Mailbox Error")
-		return
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "synced_count": syncedCount})
+}
+
+// syncMailbox 將 Sora mailbox 中已完成、但本地沒有紀錄的影片補進 videos.json，回傳新增筆數
+func (st *AppState) syncMailbox() (int, error) {
+	// v31: 逐一同步所有可用帳號的 mailbox
+	accounts := st.sora.usable("")
+	if len(accounts) == 0 {
+		return 0, fmt.Errorf("未登入")
+	}
+	mailboxes := map[string]MailboxResponse{}
+	var lastErr error
+	for _, acc := range accounts {
+		mailBody, err := st.sendSoraRequest(acc, "GET", SoraHistoryEndpoint, nil)
+		if err != nil {
+			fmt.Printf("⚠️ [%s] 讀取 mailbox 失敗: %v\n", acc.Name, err)
+			lastErr = err
+			continue
+		}
+		var mailboxResponse MailboxResponse
+		if err := json.Unmarshal(mailBody, &mailboxResponse); err != nil {
+			lastErr = fmt.Errorf("Mailbox Error")
+			continue
+		}
+		mailboxes[acc.Name] = mailboxResponse
+	}
+	if len(mailboxes) == 0 {
+		return 0, lastErr
 	}
 
 	localVideos, _ := loadConfig(ConfigFile)
@@ -1039,84 +1652,90 @@ func handleSoraHistoryBatch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	syncedCount := 0
-	idPattern := regexp.MustCompile(`(S2_\d+_\d+_\d+)`)
 
-	for _, item := range mailboxResponse.Items {
-		// 直接判斷 Kind
-		if item.Kind == "sora_gen_complete" && item.Object.Draft.DownloadableURL != "" {
-			url := item.Object.Draft.DownloadableURL
+	for accName, mailboxResponse := range mailboxes {
+		for _, item := range mailboxResponse.Items {
+			// 直接判斷 Kind
+			if item.Kind == "sora_gen_complete" && item.Object.Draft.DownloadableURL != "" {
+				url := item.Object.Draft.DownloadableURL
 
-			re := regexp.MustCompile(`files/([a-zA-Z0-9-_]+)/`)
-			match := re.FindStringSubmatch(url)
+				re := regexp.MustCompile(`files/([a-zA-Z0-9-_]+)/`)
+				match := re.FindStringSubmatch(url)
 
-			if len(match) > 1 {
-				fileUUID := match[1]
-				targetFileName := "sora_" + fileUUID + ".mp4"
-
-				// 嘗試從 DisplayStr 提取 ID
-				matches := idPattern.FindStringSubmatch(item.DisplayStr)
-				var foundID string
-				if len(matches) > 1 {
-					foundID = matches[1]
-				}
+				if len(match) > 1 {
+					fileUUID := match[1]
+					targetFileName := "sora_" + fileUUID + ".mp4"
 
-				if foundID != "" {
-					if v, exists := existingIDs[foundID]; exists {
-						v.DownloadURL = url
-						continue
+					// 嘗試從 DisplayStr 提取 ID
+					matches := storygen.IDPattern.FindStringSubmatch(item.DisplayStr)
+					var foundID string
+					if len(matches) > 1 {
+						foundID = matches[1]
 					}
 
-					// ★★★ 修正：正確構建並使用 title 變數 ★★★
-					title := "SYNC: " + foundID
-					if len(item.DisplayStr) > 30 {
-						title += " " + item.DisplayStr[:30]
-					}
+					if foundID != "" {
+						if v, exists := existingIDs[foundID]; exists {
+							v.DownloadURL = url
+							if v.SoraAccount == "" {
+								v.SoraAccount = accName
+							}
+							continue
+						}
+
+						// ★★★ 修正：正確構建並使用 title 變數 ★★★
+						title := "SYNC: " + foundID
+						if len(item.DisplayStr) > 30 {
+							title += " " + item.DisplayStr[:30]
+						}
 
-					newVideo := VideoConfig{
-						UniqueID:    foundID,
-						FileName:    foundID + ".mp4",
-						Title:       title, // 這裡使用了 title 變數
-						Description: "Synced from Sora Mailbox.",
-						CategoryID:  "24",
-						Privacy:     "private",
-						Uploaded:    false,
-						IsManual:    true,
-						DownloadURL: url,
-					}
-					localVideos = append(localVideos, newVideo)
-					existingIDs[foundID] = &newVideo
-					syncedCount++
-				} else {
-					if !localFileNames[targetFileName] {
 						newVideo := VideoConfig{
-							FileName:    targetFileName,
-							Title:       "SYNC: " + fileUUID,
+							UniqueID:    foundID,
+							FileName:    foundID + ".mp4",
+							Title:       title, // 這裡使用了 title 變數
 							Description: "Synced from Sora Mailbox.",
 							CategoryID:  "24",
 							Privacy:     "private",
 							Uploaded:    false,
 							IsManual:    true,
 							DownloadURL: url,
+							SoraAccount: accName,
 						}
 						localVideos = append(localVideos, newVideo)
-						localFileNames[targetFileName] = true
+						existingIDs[foundID] = &newVideo
 						syncedCount++
+					} else {
+						if !localFileNames[targetFileName] {
+							newVideo := VideoConfig{
+								FileName:    targetFileName,
+								Title:       "SYNC: " + fileUUID,
+								Description: "Synced from Sora Mailbox.",
+								CategoryID:  "24",
+								Privacy:     "private",
+								Uploaded:    false,
+								IsManual:    true,
+								DownloadURL: url,
+								SoraAccount: accName,
+							}
+							localVideos = append(localVideos, newVideo)
+							localFileNames[targetFileName] = true
+							syncedCount++
+						}
 					}
 				}
 			}
 		}
 	}
 	saveConfig(ConfigFile, localVideos)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "synced_count": syncedCount})
+	return syncedCount, nil
 }
 
-func handleDebugHistory(w http.ResponseWriter, r *http.Request) {
-	if soraCreds == nil {
-		jsonError(w, "未登入")
+func (st *AppState) handleDebugHistory(w http.ResponseWriter, r *http.Request) {
+	acc, err := st.sora.resolve(r.URL.Query().Get("account"), "")
+	if err != nil {
+		jsonError(w, err.Error())
 		return
 	}
-	mailBody, err := sendSoraRequest("GET", SoraHistoryEndpoint, nil)
+	mailBody, err := st.sendSoraRequest(acc, "GET", SoraHistoryEndpoint, nil)
 	if err != nil {
 		jsonError(w, err.Error())
 		return
@@ -1125,18 +1744,30 @@ func handleDebugHistory(w http.ResponseWriter, r *http.Request) {
 	w.Write(mailBody)
 }
 
+// SoraDownloadRequest 為流水線下載 / 補檔的參數 (網頁與 CLI `download` 共用)
+type SoraDownloadRequest struct {
+	URL            string `json:"url"`
+	Filename       string `json:"filename"`
+	MetaJSON       string `json:"meta_json"`
+	UniqueIDLookup string `json:"unique_id_lookup"`
+	Account        string `json:"account"` // v31: 產生此影片的 Sora 帳號
+}
+
 // v28: Metadata First Download Logic
-func handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		URL            string `json:"url"`
-		Filename       string `json:"filename"`
-		MetaJSON       string `json:"meta_json"`
-		UniqueIDLookup string `json:"unique_id_lookup"`
-	}
+func (st *AppState) handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
+	var req SoraDownloadRequest
 	json.NewDecoder(r.Body).Decode(&req)
 
+	targetFilename, statusMsg := st.downloadVideo(req)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "filename": targetFilename, "message": statusMsg})
+}
+
+// downloadVideo 先寫入 metadata，再下載影片 (沒有連結時從 mailbox 補找)；回傳檔名與結果訊息
+func (st *AppState) downloadVideo(req SoraDownloadRequest) (string, string) {
 	targetFilename := req.Filename
 	targetURL := req.URL
+	account := req.Account
 
 	// 1. Metadata First
 	if req.MetaJSON != "" {
@@ -1152,6 +1783,10 @@ func handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
 			}
 			newVideo.Uploaded = false
 			newVideo.IsManual = false
+			if newVideo.SoraAccount == "" {
+				newVideo.SoraAccount = account
+			}
+			account = newVideo.SoraAccount
 			currentVideos, _ := loadConfig(ConfigFile)
 			found := false
 			for i, v := range currentVideos {
@@ -1192,6 +1827,9 @@ func handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
 			for _, v := range videos {
 				if v.FileName == targetFilename {
 					lookupID = v.UniqueID
+					if account == "" {
+						account = v.SoraAccount
+					}
 					if v.DownloadURL != "" {
 						targetURL = v.DownloadURL
 					}
@@ -1201,13 +1839,15 @@ func handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
 		}
 		if targetURL == "" && lookupID != "" {
 			fmt.Printf("🔄 本地無連結，正在掃描 Sora History 尋找 ID [%s]...\n", lookupID)
-			newURL, err := fetchSoraURLFromHistory(lookupID)
+			newURL, foundIn, err := st.fetchSoraURLFromHistory(lookupID, account)
 			if err == nil {
 				targetURL = newURL
+				account = foundIn
 				videos, _ := loadConfig(ConfigFile)
 				for i, v := range videos {
 					if v.UniqueID == lookupID {
 						videos[i].DownloadURL = newURL
+						videos[i].SoraAccount = foundIn
 						saveConfig(ConfigFile, videos)
 						fmt.Println("📝 已更新本地庫存的下載連結")
 						break
@@ -1235,6 +1875,10 @@ func handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Printf("📥 [流水線/補檔] 準備下載: %s\n", targetFilename)
 	statusMsg := "ok"
+	var userAgent string
+	if acc, err := st.sora.resolve(account, ""); err == nil {
+		userAgent = acc.Creds.UserAgent
+	}
 	if targetURL != "" {
 		if _, err := os.Stat(targetFilename); err == nil {
 			info, _ := os.Stat(targetFilename)
@@ -1242,12 +1886,12 @@ func handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
 				statusMsg = "檔案已存在，跳過下載"
 			} else {
 				os.Remove(targetFilename)
-				if err := downloadFileWithProgress(targetURL, targetFilename); err != nil {
+				if err := downloadFileWithProgress(targetURL, targetFilename, userAgent); err != nil {
 					statusMsg = "下載失敗: " + err.Error()
 				}
 			}
 		} else {
-			if err := downloadFileWithProgress(targetURL, targetFilename); err != nil {
+			if err := downloadFileWithProgress(targetURL, targetFilename, userAgent); err != nil {
 				statusMsg = "下載失敗: " + err.Error()
 			}
 		}
@@ -1255,40 +1899,45 @@ func handleSoraDownloadAndRename(w http.ResponseWriter, r *http.Request) {
 		statusMsg = "僅建立資料 (無下載連結)"
 		fmt.Println("⚠️ 無下載連結，僅執行 Metadata 存檔")
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "filename": targetFilename, "message": statusMsg})
+	return targetFilename, statusMsg
 }
 
-func fetchSoraURLFromHistory(targetUniqueID string) (string, error) {
-	if soraCreds == nil {
-		return "", fmt.Errorf("未登入")
-	}
-	mailBody, err := sendSoraRequest("GET", SoraHistoryEndpoint, nil)
-	if err != nil {
-		return "", err
-	}
-	var mailboxResponse MailboxResponse
-	if err := json.Unmarshal(mailBody, &mailboxResponse); err != nil {
-		return "", err
-	}
-	for _, item := range mailboxResponse.Items {
-		if item.Kind == "sora_gen_complete" {
-			if strings.Contains(item.DisplayStr, targetUniqueID) {
-				if item.Object.Draft.DownloadableURL != "" {
-					return item.Object.Draft.DownloadableURL, nil
+// v31: 依序搜尋所有帳號的 mailbox (preferred 優先)，回傳連結與找到的帳號
+func (st *AppState) fetchSoraURLFromHistory(targetUniqueID, preferred string) (string, string, error) {
+	accounts := st.sora.usable(preferred)
+	if len(accounts) == 0 {
+		return "", "", fmt.Errorf("未登入")
+	}
+	var lastErr error = fmt.Errorf("Not found")
+	for _, acc := range accounts {
+		mailBody, err := st.sendSoraRequest(acc, "GET", SoraHistoryEndpoint, nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var mailboxResponse MailboxResponse
+		if err := json.Unmarshal(mailBody, &mailboxResponse); err != nil {
+			lastErr = err
+			continue
+		}
+		for _, item := range mailboxResponse.Items {
+			if item.Kind == "sora_gen_complete" {
+				if strings.Contains(item.DisplayStr, targetUniqueID) {
+					if item.Object.Draft.DownloadableURL != "" {
+						return item.Object.Draft.DownloadableURL, acc.Name, nil
+					}
 				}
 			}
 		}
 	}
-	return "", fmt.Errorf("Not found")
+	return "", "", lastErr
 }
 
 // ==========================================
 // 5. YouTube Handlers & Logic
 // ==========================================
 
-func handleYoutubeRun(w http.ResponseWriter, r *http.Request) {
+func (st *AppState) handleYoutubeRun(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("Transfer-Encoding", "chunked")
 	logger := func(msg string) {
@@ -1301,17 +1950,18 @@ func handleYoutubeRun(w http.ResponseWriter, r *http.Request) {
 	dateStr := r.URL.Query().Get("date")
 	var startDate time.Time
 	if dateStr != "" {
-		startDate, _ = time.Parse("2006-01-02", dateStr)
+		startDate, _ = time.ParseInLocation("2006-01-02", dateStr, st.Config().Loc)
 	}
+	channelID := r.URL.Query().Get("channel")
 	logger(fmt.Sprintf("🚀 開始上傳任務 (Limit: %d)", limit))
-	if err := processScheduleAndUpload(startDate, limit, logger); err != nil {
+	if err := st.processScheduleAndUpload(startDate, limit, channelID, logger); err != nil {
 		logger(fmt.Sprintf("❌ 錯誤: %v", err))
 	} else {
 		logger("🎉 任務完成")
 	}
 }
 
-func handleManualSchedule(w http.ResponseWriter, r *http.Request) {
+func (st *AppState) handleManualSchedule(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "405", 405)
 		return
@@ -1320,29 +1970,67 @@ func handleManualSchedule(w http.ResponseWriter, r *http.Request) {
 	fname := r.FormValue("filename")
 	pubTimeStr := r.FormValue("publishtime")
 	updateBaseline := r.FormValue("update_baseline")
-	pubTime, err := time.Parse("2006-01-02T15:04", pubTimeStr)
-	if err != nil {
-		http.Error(w, "時間格式錯誤", 400)
-		return
-	}
+	// v31: 所有輸入驗證完才連線 YouTube
 	videos, _ := loadConfig(ConfigFile)
-	var targetVideo *VideoConfig
-	found := false
+	targetIdx := -1
 	for i, v := range videos {
 		if v.FileName == fname {
-			videos[i].PublishAt = pubTime.Format(time.RFC3339)
-			videos[i].IsManual = true
-			videos[i].Uploaded = false
-			videos[i].IgnoreCalc = (updateBaseline != "on")
-			targetVideo = &videos[i]
-			found = true
+			targetIdx = i
 			break
 		}
 	}
-	if !found {
+	if targetIdx < 0 {
 		http.Error(w, "找無檔案", 404)
 		return
 	}
+	ch := st.Config().resolveChannel(videos[targetIdx].Channel)
+	if ch == nil {
+		http.Error(w, "未知頻道: "+videos[targetIdx].Channel, 400)
+		return
+	}
+	pubTime, err := ch.parseLocalTime(pubTimeStr)
+	if err != nil {
+		http.Error(w, "時間格式錯誤", 400)
+		return
+	}
+	if !pubTime.After(time.Now()) {
+		http.Error(w, "發布時間必須晚於現在", 400)
+		return
+	}
+	if _, err := os.Stat(fname); os.IsNotExist(err) {
+		http.Error(w, "❌ 錯誤：找不到檔案 (請確認檔案是否在根目錄): "+fname, 404)
+		return
+	}
+	service, err := openYouTubeService(ch)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	// v31: 時段衝突檢查 (同頻道本地 + YouTube 已排程)
+	var sameChannel []VideoConfig
+	for _, v := range videos {
+		if ch.owns(v) {
+			sameChannel = append(sameChannel, v)
+		}
+	}
+	occ := buildOccupancy(sameChannel, getScheduledTimes(service), fname)
+	shiftMsg := ""
+	if owner, taken := occ.owner(pubTime); taken {
+		if r.FormValue("on_conflict") != "shift" {
+			http.Error(w, fmt.Sprintf("⚠️ 時段衝突: %s 已被 [%s] 佔用，請改選其他時間或勾選自動順延", pubTime.Format("2006-01-02 15:04"), owner), http.StatusConflict)
+			return
+		}
+		shifted := occ.nextFree(pubTime, ch)
+		shiftMsg = fmt.Sprintf("↪️ 時段 %s 已被 [%s] 佔用，自動順延至 %s", pubTime.Format("2006-01-02 15:04"), owner, shifted.In(ch.location()).Format("2006-01-02 15:04"))
+		pubTime = shifted
+	}
+
+	targetVideo := &videos[targetIdx]
+	targetVideo.PublishAt = pubTime.Format(time.RFC3339)
+	targetVideo.IsManual = true
+	targetVideo.Uploaded = false
+	targetVideo.IgnoreCalc = (updateBaseline != "on")
 	saveConfig(ConfigFile, videos)
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Header().Set("Transfer-Encoding", "chunked")
@@ -1352,43 +2040,82 @@ func handleManualSchedule(w http.ResponseWriter, r *http.Request) {
 			f.Flush()
 		}
 	}
-	ctx := context.Background()
-	b, _ := os.ReadFile("client_secret.json")
-	config, _ := google.ConfigFromJSON(b, youtube.YoutubeUploadScope)
-	client := getClient(config)
-	service, _ := youtube.NewService(ctx, option.WithHTTPClient(client))
-	if _, err := os.Stat(targetVideo.FileName); os.IsNotExist(err) {
-		logger("❌ 錯誤：找不到檔案 (請確認檔案是否在根目錄): " + targetVideo.FileName)
-		return
+	if shiftMsg != "" {
+		logger(shiftMsg)
 	}
-	logger(fmt.Sprintf("📤 上傳中: %s", targetVideo.FileName))
-	if err := uploadVideo(service, targetVideo); err != nil {
+	logger(fmt.Sprintf("📤 上傳中: %s → %s", targetVideo.FileName, ch.Name))
+	if err := uploadVideo(service, ch, targetVideo); err != nil {
 		logger("❌ 上傳失敗: " + err.Error())
 		return
 	}
 	targetVideo.Uploaded = true
-	archiveVideo(targetVideo.FileName)
+	archiveVideo(ch, targetVideo.FileName)
 	saveConfig(ConfigFile, videos)
 	logger("✅ 手動排程上傳與歸檔完成！")
 }
 
-func processScheduleAndUpload(startDate time.Time, limit int, logger func(string)) error {
+// processScheduleAndUpload 依頻道分組排程並上傳，channelID 空白代表所有頻道
+func (st *AppState) processScheduleAndUpload(startDate time.Time, limit int, channelID string, logger func(string)) error {
 	videos, err := loadConfig(ConfigFile)
 	if err != nil {
 		return err
 	}
-	ctx := context.Background()
-	b, err := os.ReadFile("client_secret.json")
+	rc := st.Config()
+	channels := rc.channels
+	if channelID != "" {
+		ch := rc.resolveChannel(channelID)
+		if ch == nil {
+			return fmt.Errorf("未知頻道: %s", channelID)
+		}
+		channels = []*ChannelProfile{ch}
+	}
+	// limit <= 0 代表不限數量
+	if limit <= 0 {
+		limit = math.MaxInt
+	}
+	// 單一頻道失敗不影響其他頻道，最後一併回報讓呼叫端 (例如 CLI) 得知失敗
+	var errs []error
+	processed := 0
+	for _, ch := range channels {
+		if processed >= limit {
+			break
+		}
+		n, err := processChannelUploads(ch, videos, startDate, limit-processed, logger)
+		processed += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[%s] %w", ch.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func processChannelUploads(ch *ChannelProfile, videos []VideoConfig, startDate time.Time, limit int, logger func(string)) (int, error) {
+	hasWork := false
+	for _, v := range videos {
+		if !v.Uploaded && ch.owns(v) {
+			hasWork = true
+			break
+		}
+	}
+	if !hasWork {
+		return 0, nil
+	}
+	service, err := openYouTubeService(ch)
 	if err != nil {
-		return fmt.Errorf("Missing client_secret.json")
+		return 0, err
 	}
-	config, _ := google.ConfigFromJSON(b, youtube.YoutubeUploadScope)
-	client := getClient(config)
-	service, _ := youtube.NewService(ctx, option.WithHTTPClient(client))
-	logger("🔗 同步 YouTube 排程...")
-	lastTime := getLastScheduledTime(service)
-	var localMaxTime time.Time
+	logger(fmt.Sprintf("🔗 同步 YouTube 排程 (%s)...", ch.Name))
+	var channelVideos []VideoConfig
 	for _, v := range videos {
+		if ch.owns(v) {
+			channelVideos = append(channelVideos, v)
+		}
+	}
+	remoteTimes := getScheduledTimes(service)
+	occ := buildOccupancy(channelVideos, remoteTimes, "")
+	lastTime := latestTime(remoteTimes)
+	var localMaxTime time.Time
+	for _, v := range channelVideos {
 		if v.PublishAt != "" && !v.IgnoreCalc {
 			t, _ := time.Parse(time.RFC3339, v.PublishAt)
 			if t.After(localMaxTime) {
@@ -1401,12 +2128,11 @@ func processScheduleAndUpload(startDate time.Time, limit int, logger func(string
 	}
 	var currTime time.Time
 	if startDate.IsZero() {
-		currTime = calculateNextSlot(lastTime)
+		currTime = ch.nextSlot(lastTime)
 	} else {
-		loc, _ := time.LoadLocation("Asia/Taipei")
-		currTime = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, loc)
+		currTime = time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, ch.location())
 		if lastTime.After(currTime) {
-			currTime = calculateNextSlot(lastTime)
+			currTime = ch.nextSlot(lastTime)
 		}
 	}
 	processed := 0
@@ -1415,9 +2141,12 @@ func processScheduleAndUpload(startDate time.Time, limit int, logger func(string
 			break
 		}
 		v := &videos[i]
-		if v.Uploaded {
+		if v.Uploaded || !ch.owns(*v) {
 			continue
 		}
+		if reason, blocked := reauthRequired(ch.ID); blocked {
+			return processed, fmt.Errorf("需要重新授權 YouTube，暫停此頻道上傳: %s", reason)
+		}
 		if _, err := os.Stat(v.FileName); os.IsNotExist(err) {
 			logger("❌ 缺檔跳過: " + v.FileName)
 			continue
@@ -1425,56 +2154,186 @@ func processScheduleAndUpload(startDate time.Time, limit int, logger func(string
 		if v.IsManual && v.PublishAt != "" {
 			if t, err := time.Parse(time.RFC3339, v.PublishAt); err == nil {
 				if !v.IgnoreCalc && t.After(currTime) {
-					currTime = calculateNextSlot(t)
+					currTime = ch.nextSlot(t)
 				}
 			}
 		} else {
-			v.PublishAt = currTime.In(time.UTC).Format(time.RFC3339)
-			currTime = calculateNextSlot(currTime)
+			// v31: 保留 rebalance 預先分配且仍未被佔用的時段，否則取下一個空時段
+			keepPlanned := false
+			if planned, err := time.Parse(time.RFC3339, v.PublishAt); err == nil && planned.After(time.Now()) {
+				if owner, taken := occ.owner(planned); !taken || owner == v.FileName {
+					occ.claim(planned, v.FileName)
+					keepPlanned = true
+					logger(fmt.Sprintf("📌 沿用預排時段: %s", planned.In(ch.location()).Format("2006-01-02 15:04")))
+				}
+			}
+			if !keepPlanned {
+				currTime = occ.nextFree(currTime, ch)
+				v.PublishAt = currTime.In(time.UTC).Format(time.RFC3339)
+				occ.claim(currTime, v.FileName)
+				currTime = ch.nextSlot(currTime)
+			}
 		}
 		logger(fmt.Sprintf("📤 上傳中: %s (%s)", v.FileName, v.PublishAt))
-		if err := uploadVideo(service, v); err != nil {
+		if err := uploadVideo(service, ch, v); err != nil {
+			if _, blocked := reauthRequired(ch.ID); blocked {
+				return processed, fmt.Errorf("YouTube 授權已失效，請重新連結後再上傳")
+			}
 			logger("❌ 上傳失敗: " + err.Error())
 			continue
 		}
 		v.Uploaded = true
-		archiveVideo(v.FileName)
+		archiveVideo(ch, v.FileName)
 		saveConfig(ConfigFile, videos)
 		processed++
 	}
-	return nil
+	return processed, nil
 }
 
-func getLastScheduledTime(service *youtube.Service) time.Time {
-	call := service.Videos.List([]string{"status"}).MyRating("like").MaxResults(10)
-	resp, err := call.Do()
-	var last time.Time
-	if err == nil {
-		for _, item := range resp.Items {
-			if item.Status.PrivacyStatus == "private" && item.Status.PublishAt != "" {
-				t, _ := time.Parse(time.RFC3339, item.Status.PublishAt)
-				if t.After(last) {
-					last = t
+// maxUploadPages 為讀取頻道上傳清單的最多頁數 (每頁 50 部)，已排程的影片都在最近上傳的部分
+const maxUploadPages = 10
+
+// v31: 回傳 YouTube 頻道上所有已排程 (private + publishAt) 的時間：
+// 由頻道的上傳播放清單取得影片 ID，再以 Videos.List 讀取 status。讀取失敗時回傳已取得的部分
+func getScheduledTimes(service *youtube.Service) []time.Time {
+	chResp, err := service.Channels.List([]string{"contentDetails"}).Mine(true).Do()
+	if err != nil || len(chResp.Items) == 0 || chResp.Items[0].ContentDetails == nil {
+		fmt.Printf("⚠️ 無法取得頻道的上傳清單: %v\n", err)
+		return nil
+	}
+	uploads := chResp.Items[0].ContentDetails.RelatedPlaylists.Uploads
+
+	var times []time.Time
+	pageToken := ""
+	for page := 0; page < maxUploadPages; page++ {
+		call := service.PlaylistItems.List([]string{"contentDetails"}).PlaylistId(uploads).MaxResults(50)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+		items, err := call.Do()
+		if err != nil {
+			fmt.Printf("⚠️ 無法讀取上傳清單: %v\n", err)
+			break
+		}
+		var ids []string
+		for _, item := range items.Items {
+			if item.ContentDetails != nil {
+				ids = append(ids, item.ContentDetails.VideoId)
+			}
+		}
+		if len(ids) > 0 {
+			videos, err := service.Videos.List([]string{"status"}).Id(ids...).Do()
+			if err != nil {
+				fmt.Printf("⚠️ 無法讀取影片狀態: %v\n", err)
+				break
+			}
+			for _, v := range videos.Items {
+				if v.Status == nil || v.Status.PrivacyStatus != "private" || v.Status.PublishAt == "" {
+					continue
+				}
+				if t, err := time.Parse(time.RFC3339, v.Status.PublishAt); err == nil {
+					times = append(times, t)
 				}
 			}
 		}
+		if pageToken = items.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+	return times
+}
+
+func latestTime(times []time.Time) time.Time {
+	var last time.Time
+	for _, t := range times {
+		if t.After(last) {
+			last = t
+		}
 	}
 	return last
 }
 
-func uploadVideo(service *youtube.Service, v *VideoConfig) error {
+// openYouTubeService 以頻道的 client secret 與 token 建立 YouTube 服務
+func openYouTubeService(ch *ChannelProfile) (*youtube.Service, error) {
+	config, err := oauthConfig(ch)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getClient(config, ch)
+	if err != nil {
+		return nil, err
+	}
+	return youtube.NewService(context.Background(), option.WithHTTPClient(client))
+}
+
+func uploadVideo(service *youtube.Service, ch *ChannelProfile, v *VideoConfig) error {
+	ch.applyDefaults(v)
 	upload := &youtube.Video{
-		Snippet: &youtube.VideoSnippet{Title: v.Title, Description: v.Description, Tags: v.Tags, CategoryId: v.CategoryID},
+		Snippet: &youtube.VideoSnippet{Title: v.Title, Description: v.Description, Tags: v.Tags, CategoryId: v.CategoryID, DefaultLanguage: v.DefaultLanguage},
 		Status:  &youtube.VideoStatus{PrivacyStatus: "private", PublishAt: v.PublishAt},
 	}
+	parts := []string{"snippet", "status"}
+	// v31: 翻譯需要 defaultLanguage；翻譯的標籤在 YouTube 標籤長度限制內合併到影片標籤
+	if v.DefaultLanguage != "" && len(v.Localizations) > 0 {
+		upload.Localizations = map[string]youtube.VideoLocalization{}
+		for _, code := range sortedKeys(v.Localizations) {
+			l := v.Localizations[code]
+			if code == v.DefaultLanguage || l.Title == "" {
+				continue
+			}
+			upload.Localizations[code] = youtube.VideoLocalization{Title: l.Title, Description: l.Description}
+			upload.Snippet.Tags = mergeTags(upload.Snippet.Tags, l.Tags, maxYouTubeTagsLength)
+		}
+		parts = append(parts, "localizations")
+	} else if len(v.Localizations) > 0 {
+		// 無法判斷主要語言 (例如 Language 不是已知的語言名稱) 時 YouTube 不接受翻譯
+		fmt.Printf("⚠️ %s 沒有 default_language，略過 %d 個翻譯 (%s)\n", v.FileName, len(v.Localizations), strings.Join(sortedKeys(v.Localizations), ", "))
+	}
 	f, _ := os.Open(v.FileName)
 	defer f.Close()
-	_, err := service.Videos.Insert([]string{"snippet", "status"}, upload).Media(f).Do()
+	_, err := service.Videos.Insert(parts, upload).Media(f).Do()
 	return err
 }
 
-func archiveVideo(filename string) {
-	os.Rename(filename, filepath.Join(youtubeConfig.ArchiveFolder, filename))
+// maxYouTubeTagsLength 為 YouTube 所有標籤合計的字數上限 (含分隔的逗號，含空白的標籤另計引號)
+const maxYouTubeTagsLength = 500
+
+func tagLength(tag string) int {
+	n := utf8.RuneCountInString(tag)
+	if strings.Contains(tag, " ") {
+		n += 2
+	}
+	return n
+}
+
+// mergeTags 將 extra 中尚未出現的標籤依序加入 base，超過 limit 的標籤略過
+func mergeTags(base, extra []string, limit int) []string {
+	total := 0
+	for _, t := range base {
+		total += tagLength(t) + 1
+	}
+	out := append([]string(nil), base...)
+	for _, t := range extra {
+		if t == "" || containsFold(out, t) || total+tagLength(t)+1 > limit+1 {
+			continue
+		}
+		out = append(out, t)
+		total += tagLength(t) + 1
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func archiveVideo(ch *ChannelProfile, filename string) {
+	os.Rename(filename, filepath.Join(ch.ArchiveFolder, filename))
 }
 
 // ==========================================
@@ -1504,17 +2363,14 @@ func saveConfig(file string, v []VideoConfig) {
 	os.WriteFile(file, b, 0644)
 }
 
-func handleOAuth(w http.ResponseWriter, r *http.Request) { fmt.Fprintf(w, "Auth Code Received") }
-func getClient(config *oauth2.Config) *http.Client {
-	tokFile := TokenFile
-	tok, err := tokenFromFile(tokFile)
-	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
-	}
-	return config.Client(context.Background(), tok)
-}
 func tokenFromFile(file string) (*oauth2.Token, error) {
+	if secretVault != nil {
+		if data, ok := secretVault.Get(tokenSecretName(file)); ok {
+			tok := &oauth2.Token{}
+			err := json.Unmarshal([]byte(data), tok)
+			return tok, err
+		}
+	}
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
@@ -1524,78 +2380,65 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 	err = json.NewDecoder(f).Decode(tok)
 	return tok, err
 }
-func saveToken(path string, token *oauth2.Token) {
-	f, _ := os.Create(path)
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
-}
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("⚠️ 請授權: %v\n輸入代碼: ", authURL)
-	var authCode string
-	fmt.Scan(&authCode)
-	tok, _ := config.Exchange(context.Background(), authCode)
-	return tok
-}
-
-func parseCurlContent(content string) (*SoraCredentials, error) {
-	creds := &SoraCredentials{UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36"}
-	reToken := regexp.MustCompile(`(?i)authorization:\s*(Bearer\s+)?([a-zA-Z0-9\._-]+)`)
-	if match := reToken.FindStringSubmatch(content); len(match) > 2 {
-		creds.BearerToken = "Bearer " + match[2]
-	}
-	reCookie := regexp.MustCompile(`(?i)-b\s+'([^']*)'`)
-	if match := reCookie.FindStringSubmatch(content); len(match) > 1 {
-		creds.Cookie = match[1]
-	} else {
-		reCookieH := regexp.MustCompile(`(?i)cookie:\s*([^']*)`)
-		if matchH := reCookieH.FindStringSubmatch(content); len(matchH) > 1 {
-			creds.Cookie = matchH[1]
-		}
-	}
-	reDevice := regexp.MustCompile(`(?i)oai-device-id:\s*([a-zA-Z0-9-]+)`)
-	if match := reDevice.FindStringSubmatch(content); len(match) > 1 {
-		creds.DeviceID = match[1]
+
+// v31: 先寫暫存檔再 rename，避免寫到一半當機導致 token 檔損毀
+func saveToken(path string, token *oauth2.Token) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
 	}
-	if creds.BearerToken == "" {
-		return nil, fmt.Errorf("Token 解析失敗")
+	if secretVault != nil {
+		return secretVault.Set(tokenSecretName(path), string(b))
 	}
-	return creds, nil
+	return writeFileAtomic(path, b, 0600)
 }
 
-func saveCredentialsCache(c *SoraCredentials) {
-	f, _ := os.Create("session_cache.json")
-	defer f.Close()
-	json.NewEncoder(f).Encode(c)
+// v31: 以指定帳號送出請求，401 時只暫停該帳號
+func (st *AppState) sendSoraRequest(acc SoraAccount, method, url string, payload interface{}) ([]byte, error) {
+	if err := st.sora.check(acc); err != nil {
+		return nil, err
+	}
+	body, status, err := st.sendSoraRequestWith(acc.Creds, method, url, payload)
+	if status == http.StatusUnauthorized {
+		st.sora.markDead(acc.Name, "Sora 回應 HTTP 401")
+		return nil, fmt.Errorf("%w: %v", errSoraSessionDead, err)
+	}
+	return body, err
 }
 
-func sendSoraRequest(method, url string, payload interface{}) ([]byte, error) {
+// v31: 以指定憑證送出請求 (匯入驗證時使用尚未生效的憑證)，回傳 HTTP 狀態碼
+func (st *AppState) sendSoraRequestWith(creds *SoraCredentials, method, url string, payload interface{}) ([]byte, int, error) {
+	if creds == nil {
+		return nil, 0, fmt.Errorf("未登入")
+	}
 	var bodyReader io.Reader
 	if payload != nil {
 		b, _ := json.Marshal(payload)
 		bodyReader = bytes.NewBuffer(b)
 	}
 	req, _ := http.NewRequest(method, url, bodyReader)
-	req.Header.Set("Authorization", soraCreds.BearerToken)
-	req.Header.Set("Cookie", soraCreds.Cookie)
-	req.Header.Set("Oai-Device-Id", soraCreds.DeviceID)
-	if soraCreds.UserAgent == "" {
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36")
+	for name, value := range creds.ExtraHeaders {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Authorization", creds.BearerToken)
+	req.Header.Set("Cookie", creds.Cookie)
+	req.Header.Set("Oai-Device-Id", creds.DeviceID)
+	if creds.UserAgent == "" {
+		req.Header.Set("User-Agent", DefaultUserAgent)
 	} else {
-		req.Header.Set("User-Agent", soraCreds.UserAgent)
+		req.Header.Set("User-Agent", creds.UserAgent)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := st.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 	body, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return nil, resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
 	}
-	return body, nil
+	return body, resp.StatusCode, nil
 }
 
 type WriteCounter struct{ Total, ContentLen uint64 }
@@ -1615,12 +2458,13 @@ func (wc *WriteCounter) PrintProgress() {
 	}
 }
 
-func downloadFileWithProgress(url, filename string) error {
+func downloadFileWithProgress(url, filename, userAgent string) error {
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("Referer", "https://sora.chatgpt.com/")
-	if soraCreds != nil {
-		req.Header.Set("User-Agent", soraCreds.UserAgent)
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
 	}
+	req.Header.Set("User-Agent", userAgent)
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
@@ -1670,54 +2514,245 @@ func normalizePrompt(s string) string {
 
 func jsonError(w http.ResponseWriter, msg string) {
 	// ★★★ 修正：設定 HTTP 500 狀態碼，讓前端知道出錯了 ★★★
-	w.WriteHeader(http.StatusInternalServerError)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
 	json.NewEncoder(w).Encode(map[string]string{"error": msg})
 }
 
 // v30: 執行外部 Gemini 生成程式
-// v30.1: 執行外部 Gemini 生成程式 (優化錯誤回傳)
-func handleCallGemini(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("🤖 正在啟動 Gemini 生成器 (gemini_gen.go)...")
-
-	// 檢查 gemini_gen.go 是否存在
-	if _, err := os.Stat("gemini_gen.go"); os.IsNotExist(err) {
-		errMsg := "找不到 gemini_gen.go 檔案，請確保它與主程式在同一目錄下"
-		fmt.Println("❌ " + errMsg)
-		jsonError(w, errMsg)
+// v31: 改為直接呼叫 storygen 套件，不再需要 Go 工具鏈
+func (st *AppState) handleCallGemini(w http.ResponseWriter, r *http.Request) {
+	sr := storyRequestFromQuery(r.URL.Query())
+	if r.URL.Query().Get("stream") == "1" {
+		st.streamStories(w, r, sr)
 		return
 	}
+	records, err := st.generateStories(r.Context(), sr)
+	if err != nil {
+		code, status := storyErrorCode(err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "code": code})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(storyResult(records))
+}
 
-	// 執行 go run gemini_gen.go
-	// 注意：這需要執行環境有安裝 Go 語言。
-	// 如果要在沒有 Go 的環境執行，建議先將 gemini_gen.go 編譯成 gemini_gen.exe，然後改用 exec.Command("./gemini_gen.exe")
-	cmd := exec.Command("go", "run", "gemini_gen.go")
-
-	// 捕獲標準輸出與錯誤輸出
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
+func storyResult(records []StoryRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"status": "ok", "message": "Story generated successfully",
+		"story": records[0].Story, "stories": records, "batch": records[0].Batch,
+	}
+}
 
+// streamStories (v31) 以 server-sent events 回報生成進度：每筆進度為 progress 事件 (storygen.Event)，
+// 完成時送出 done (內容同一般回應)，失敗時送出 error ({error, code})
+func (st *AppState) streamStories(w http.ResponseWriter, r *http.Request, sr StoryRequest) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, "伺服器不支援串流")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	var mu sync.Mutex // 多個候選並行生成，寫入需要互斥
+	send := func(event string, v interface{}) {
+		data, _ := json.Marshal(v)
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+	}
+	sr.Progress = func(ev storygen.Event) { send("progress", ev) }
+	records, err := st.generateStories(r.Context(), sr)
 	if err != nil {
-		// 將詳細的錯誤訊息 (stderr) 回傳給前端
-		detailedError := fmt.Sprintf("執行失敗: %v | 詳細訊息: %s", err, stderr.String())
-		fmt.Printf("❌ AI 生成失敗: %s\n", detailedError)
-		jsonError(w, detailedError)
+		code, _ := storyErrorCode(err)
+		send("error", map[string]string{"error": err.Error(), "code": code})
 		return
 	}
+	send("done", storyResult(records))
+}
 
-	// 檢查輸出是否包含成功訊號
-	outputStr := out.String()
-	if strings.Contains(outputStr, "SUCCESS") {
-		fmt.Println("✅ AI 故事生成完畢 (story.json 已更新)")
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Story generated successfully"})
+// generateStories 以指定的 LLM 提供者與提示詞模板產生 sr.Count 個候選故事並全部存入故事庫
+// (網頁與 CLI `generate-story` 共用)。只產生一個時直接寫入 story.json；多個候選時由使用者採用其中一個。
+// 部分候選失敗時回傳成功的部分，全部失敗才回傳錯誤
+func (st *AppState) generateStories(ctx context.Context, sr StoryRequest) ([]StoryRecord, error) {
+	rc := st.Config()
+	gen, name, err := rc.storyGenerator(sr.Provider)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return nil, err
+	}
+	if sr.Template == "" {
+		sr.Template = rc.LLM.Template
+	}
+	if sr.Vars.Role == "" {
+		if roles := st.Roles(); len(roles) > 0 {
+			sr.Vars.Role = roles[0].Handle
+		}
+	}
+	// 已登錄的角色提供角色設定與畫面風格 (請求有指定時以請求為準)
+	role, hasRole := st.role(sr.Vars.Role)
+	if hasRole {
+		if sr.Vars.Characters == "" {
+			sr.Vars.Characters = role.Bible
+		}
+		if sr.Vars.Style == "" {
+			sr.Vars.Style = role.Style
+		}
+	}
+	if sr.Vars.Localizations == nil {
+		sr.Vars.Localizations = rc.LLM.Localizations
+	}
+	count := min(max(sr.Count, 1), MaxStoryVariants)
+	topics := storyTopics(rc, sr, count)
+
+	// 候選共用同一個批次 ID，各自加上 _v1、_v2... 作為 unique_id
+	now := time.Now()
+	batch := sr.Vars.ID
+	if batch == "" {
+		batch = st.stories.freeID(now)
+	}
+	reqs := make([]storygen.Request, count)
+	for i := range reqs {
+		vars := sr.Vars
+		vars.ID = batch
+		if topics != nil {
+			vars.Topic = topics[i]
+		}
+		if count > 1 {
+			vars.ID = fmt.Sprintf("%s_v%d", batch, i+1)
+			vars.Variant, vars.Variants = i+1, count
+		}
+		if reqs[i], err = storygen.NewRequest(rc.LLM.PromptDir, sr.Template, vars, now); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return nil, err
+		}
+		reqs[i].Progress = logStoryProgress(sr.Progress)
+	}
+	for _, req := range reqs {
+		req.Emit(storygen.Event{Stage: storygen.StageStarted, Text: req.Topic})
+	}
+	fmt.Printf("🤖 正在請求 AI 生成 %d 個故事 (提供者: %s, 模板: %s)...\n", count, name, sr.Template)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	stories := make([]*storygen.Story, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stories[i], errs[i] = storygen.GenerateWithRepair(ctx, gen, reqs[i], rc.LLM.MaxAttempts)
+		}()
+	}
+	wg.Wait()
+
+	var records []StoryRecord
+	var firstErr error
+	for i, story := range stories {
+		if errs[i] != nil {
+			fmt.Printf("❌ AI 生成失敗 (%s): %v\n", reqs[i].ID, errs[i])
+			reqs[i].Emit(storygen.Event{Stage: storygen.StageFailed, Text: errs[i].Error()})
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		// 主題與主要語言以程式決定的為準，不採用模型的回答
+		story.Metadata.Topic = reqs[i].Topic
+		if reqs[i].Language != "" {
+			story.Metadata.DefaultLanguage = reqs[i].Language
+			delete(story.Metadata.Localizations, reqs[i].Language)
+		}
+		content := storyContentFrom(story)
+		if hasRole {
+			role.applyDefaults(&content.Metadata)
+			story = storyFromContent(*content)
+			stories[i] = story
+		}
+		rec := StoryRecord{ID: story.Metadata.UniqueID, CreatedAt: now, Provider: name, Template: sr.Template, Story: *content}
+		if count > 1 {
+			rec.Batch = batch
+		}
+		records = append(records, rec)
+	}
+	if len(records) == 0 {
+		return nil, firstErr
+	}
+	if count == 1 {
+		records[0].Status = StoryQueued // 直接寫入 story.json，視同已採用
+	}
+	if err := st.stories.add(records...); err != nil {
+		fmt.Printf("⚠️ 無法寫入故事庫: %v\n", err)
+	}
+	if count == 1 {
+		if err := stories[0].WriteFile(StoryFile); err != nil {
+			fmt.Printf("❌ 無法寫入 %s: %v\n", StoryFile, err)
+			return nil, err
+		}
+		fmt.Printf("✅ AI 故事生成完畢 (%s 已更新: %s)\n", StoryFile, stories[0].Metadata.FileName)
 	} else {
-		fmt.Println("⚠️ AI 執行完成但未檢測到成功訊號，可能未生成檔案")
-		// 這裡也可以視為一種錯誤
-		jsonError(w, "AI 程式執行完成但無回應 (No SUCCESS signal)")
+		fmt.Printf("✅ 已生成 %d/%d 個候選故事 (批次 %s)，請選擇要採用的故事\n", len(records), count, batch)
 	}
+	if sr.Progress != nil {
+		for _, rec := range records {
+			sr.Progress(storygen.Event{Stage: storygen.StageSaved, ID: rec.ID})
+		}
+	}
+	return records, nil
+}
+
+// logStoryProgress 將模型呼叫與重試印到終端機，再轉交給 next (可為 nil)
+func logStoryProgress(next storygen.ProgressFunc) storygen.ProgressFunc {
+	return func(ev storygen.Event) {
+		switch ev.Stage {
+		case storygen.StageModelCall:
+			fmt.Printf("🤖 [%s] 第 %d 次請求模型生成故事...\n", ev.ID, ev.Attempt)
+		case storygen.StageRetry:
+			fmt.Printf("⚠️ [%s] 第 %d 次生成不符合格式，回饋錯誤後重試: %s\n", ev.ID, ev.Attempt, strings.Join(ev.Problems, "; "))
+		}
+		if next != nil {
+			next(ev)
+		}
+	}
+}
+
+// storyContentFrom 將 storygen 的結果轉成流水線使用的 StoryContent
+func storyContentFrom(s *storygen.Story) *StoryContent {
+	m := s.Metadata
+	return &StoryContent{
+		Prompt: s.Prompt,
+		Metadata: VideoConfig{
+			UniqueID: m.UniqueID, FileName: m.FileName, Title: m.Title, Description: m.Description,
+			Tags: m.Tags, CategoryID: m.CategoryID, Privacy: m.Privacy, Topic: m.Topic, Channel: m.Channel,
+			DefaultLanguage: m.DefaultLanguage, Localizations: m.Localizations,
+		},
+	}
+}
+
+// storyErrorCode 將生成錯誤分類，供前端顯示對應的提示
+func storyErrorCode(err error) (string, int) {
+	var apiErr *storygen.APIError
+	var parseErr *storygen.ParseError
+	var validErr *storygen.ValidationError
+	var tmplErr *storygen.TemplateError
+	switch {
+	case errors.Is(err, storygen.ErrMissingAPIKey):
+		return "missing_api_key", http.StatusBadRequest
+	case errors.As(err, &tmplErr):
+		return "template_error", http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout", http.StatusGatewayTimeout
+	case errors.As(err, &parseErr), errors.As(err, &validErr):
+		return "invalid_response", http.StatusBadGateway
+	case errors.Is(err, storygen.ErrEmptyResponse):
+		return "empty_response", http.StatusBadGateway
+	case errors.As(err, &apiErr):
+		return "provider_error", http.StatusBadGateway
+	}
+	return "internal", http.StatusInternalServerError
 }
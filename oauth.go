@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/youtube/v3"
+)
+
+// ==========================================
+// YouTube 網頁授權流程 (v31)
+// ==========================================
+
+// youtubeScopes: 上傳 + 唯讀 (讀取已排程影片與頻道名稱)
+var youtubeScopes = []string{youtube.YoutubeUploadScope, youtube.YoutubeReadonlyScope}
+
+// state 有效時間，逾時需重新點選「連結 YouTube」
+const oauthStateTTL = 10 * time.Minute
+
+type pendingOAuth struct {
+	ChannelID   string
+	RedirectURL string
+	CreatedAt   time.Time
+}
+
+var (
+	oauthMu       sync.Mutex
+	oauthPending  = map[string]pendingOAuth{}
+	oauthAccounts = map[string]string{} // 頻道 ID → 已連結的 YouTube 頻道名稱
+	oauthReauth   = map[string]string{} // 頻道 ID → 需要重新授權的原因
+)
+
+// errReauthRequired 表示 refresh token 已被撤銷或過期，必須重新走網頁授權
+var errReauthRequired = errors.New("YouTube 授權已失效，需要重新授權")
+
+// ReauthInfo 列出需要重新授權的頻道，供 /api/status 與前端顯示
+type ReauthInfo struct {
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Reason      string `json:"reason"`
+}
+
+// YouTubeAuthStatus 為 /api/youtube/auth_status 的單一頻道狀態
+type YouTubeAuthStatus struct {
+	ChannelID       string `json:"channel_id"`
+	ChannelName     string `json:"channel_name"`
+	Connected       bool   `json:"connected"`
+	Account         string `json:"account,omitempty"`
+	Expiry          string `json:"expiry,omitempty"`
+	HasRefreshToken bool   `json:"has_refresh_token"`
+	ReauthRequired  bool   `json:"reauth_required"`
+	ReauthReason    string `json:"reauth_reason,omitempty"`
+}
+
+// oauthConfig 讀取頻道的 client secret 建立 OAuth 設定
+func oauthConfig(ch *ChannelProfile) (*oauth2.Config, error) {
+	b, err := os.ReadFile(ch.ClientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("Missing %s", ch.ClientSecretFile)
+	}
+	config, err := google.ConfigFromJSON(b, youtubeScopes...)
+	if err != nil {
+		return nil, fmt.Errorf("%s 格式錯誤: %w", ch.ClientSecretFile, err)
+	}
+	return config, nil
+}
+
+// getClient 以既有 token 建立 HTTP client；沒有 token 或授權已失效時回傳錯誤，提示改用網頁授權。
+// 更新後的 access token 會寫回頻道的 TokenFile。
+func getClient(config *oauth2.Config, ch *ChannelProfile) (*http.Client, error) {
+	if reason, blocked := reauthRequired(ch.ID); blocked {
+		return nil, fmt.Errorf("%w: %s", errReauthRequired, reason)
+	}
+	tok, err := tokenFromFile(ch.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("尚未授權 YouTube (%s)，請在網頁點選「連結 YouTube」", ch.TokenFile)
+	}
+	ctx := context.Background()
+	src := &persistingTokenSource{
+		base:      config.TokenSource(ctx, tok),
+		path:      ch.TokenFile,
+		channelID: ch.ID,
+		last:      tok,
+	}
+	return oauth2.NewClient(ctx, src), nil
+}
+
+// persistingTokenSource 在 access token 更新時寫回檔案，並偵測 invalid_grant
+type persistingTokenSource struct {
+	base      oauth2.TokenSource
+	path      string
+	channelID string
+
+	mu   sync.Mutex
+	last *oauth2.Token
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		var rErr *oauth2.RetrieveError
+		if errors.As(err, &rErr) && rErr.ErrorCode == "invalid_grant" {
+			markReauthRequired(s.channelID, "refresh token 已被撤銷或過期 (invalid_grant)")
+			return nil, fmt.Errorf("%w: %v", errReauthRequired, err)
+		}
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil || tok.AccessToken != s.last.AccessToken {
+		// Google 刷新時通常不回傳 refresh token，沿用舊的以免寫回後遺失
+		if tok.RefreshToken == "" && s.last != nil {
+			tok.RefreshToken = s.last.RefreshToken
+		}
+		if err := saveToken(s.path, tok); err != nil {
+			fmt.Printf("⚠️ 無法寫回更新後的 token (%s): %v\n", s.path, err)
+		} else {
+			fmt.Printf("🔄 YouTube access token 已更新並儲存 (%s)\n", s.path)
+		}
+		s.last = tok
+	}
+	return tok, nil
+}
+
+func markReauthRequired(channelID, reason string) {
+	oauthMu.Lock()
+	defer oauthMu.Unlock()
+	if _, exists := oauthReauth[channelID]; !exists {
+		fmt.Printf("⛔ 頻道 %s 需要重新授權 YouTube: %s\n", channelID, reason)
+	}
+	oauthReauth[channelID] = reason
+}
+
+func clearReauthRequired(channelID string) {
+	oauthMu.Lock()
+	defer oauthMu.Unlock()
+	delete(oauthReauth, channelID)
+}
+
+// reauthRequired 回傳頻道是否因授權失效而暫停上傳
+func reauthRequired(channelID string) (string, bool) {
+	oauthMu.Lock()
+	defer oauthMu.Unlock()
+	reason, ok := oauthReauth[channelID]
+	return reason, ok
+}
+
+func reauthList(rc *RuntimeConfig) []ReauthInfo {
+	list := []ReauthInfo{}
+	for _, ch := range rc.channels {
+		if reason, blocked := reauthRequired(ch.ID); blocked {
+			list = append(list, ReauthInfo{ChannelID: ch.ID, ChannelName: ch.Name, Reason: reason})
+		}
+	}
+	return list
+}
+
+func newOAuthState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handleOAuthStart 產生隨機 state 並導向 Google 授權頁
+func (st *AppState) handleOAuthStart(w http.ResponseWriter, r *http.Request) {
+	ch := st.Config().resolveChannel(r.URL.Query().Get("channel"))
+	if ch == nil {
+		http.Error(w, "未知頻道", 400)
+		return
+	}
+	config, err := oauthConfig(ch)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	state, err := newOAuthState()
+	if err != nil {
+		http.Error(w, "無法產生 state: "+err.Error(), 500)
+		return
+	}
+	config.RedirectURL = "http://" + r.Host + "/oauth"
+
+	oauthMu.Lock()
+	for k, p := range oauthPending {
+		if time.Since(p.CreatedAt) > oauthStateTTL {
+			delete(oauthPending, k)
+		}
+	}
+	oauthPending[state] = pendingOAuth{ChannelID: ch.ID, RedirectURL: config.RedirectURL, CreatedAt: time.Now()}
+	oauthMu.Unlock()
+
+	// prompt=consent 確保每次都拿到 refresh token
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleOAuth 驗證 state、交換授權碼並儲存頻道 token
+func (st *AppState) handleOAuth(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if errMsg := q.Get("error"); errMsg != "" {
+		oauthResultPage(w, false, "使用者拒絕授權: "+errMsg)
+		return
+	}
+	state := q.Get("state")
+	oauthMu.Lock()
+	pending, ok := oauthPending[state]
+	delete(oauthPending, state)
+	oauthMu.Unlock()
+	if !ok || time.Since(pending.CreatedAt) > oauthStateTTL {
+		oauthResultPage(w, false, "state 無效或已過期，請重新點選「連結 YouTube」")
+		return
+	}
+
+	ch := st.Config().resolveChannel(pending.ChannelID)
+	if ch == nil {
+		oauthResultPage(w, false, "未知頻道: "+pending.ChannelID)
+		return
+	}
+	config, err := oauthConfig(ch)
+	if err != nil {
+		oauthResultPage(w, false, err.Error())
+		return
+	}
+	config.RedirectURL = pending.RedirectURL
+	tok, err := config.Exchange(r.Context(), q.Get("code"))
+	if err != nil {
+		oauthResultPage(w, false, "交換 token 失敗: "+err.Error())
+		return
+	}
+	if err := saveToken(ch.TokenFile, tok); err != nil {
+		oauthResultPage(w, false, "儲存 token 失敗: "+err.Error())
+		return
+	}
+	clearReauthRequired(ch.ID)
+
+	account, err := fetchAccountName(ch)
+	if err != nil {
+		fmt.Printf("⚠️ 無法取得 %s 的 YouTube 帳號名稱: %v\n", ch.Name, err)
+		account = "未知帳號"
+	} else {
+		oauthMu.Lock()
+		oauthAccounts[ch.ID] = account
+		oauthMu.Unlock()
+	}
+	fmt.Printf("✅ YouTube 已授權: %s → %s\n", ch.Name, account)
+	oauthResultPage(w, true, fmt.Sprintf("%s 已連結 YouTube 帳號: %s", ch.Name, account))
+}
+
+// fetchAccountName 查詢頻道 token 對應的 YouTube 頻道名稱；
+// 與上傳共用 getClient，刷新後的 token 會寫回檔案，invalid_grant 會標記需要重新授權
+func fetchAccountName(ch *ChannelProfile) (string, error) {
+	service, err := openYouTubeService(ch)
+	if err != nil {
+		return "", err
+	}
+	resp, err := service.Channels.List([]string{"snippet"}).Mine(true).Do()
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Items) == 0 {
+		return "", fmt.Errorf("此帳號沒有 YouTube 頻道")
+	}
+	return resp.Items[0].Snippet.Title, nil
+}
+
+// oauthResultPage 顯示授權結果；msg 可能含查詢參數或錯誤訊息，一律跳脫後輸出
+func oauthResultPage(w http.ResponseWriter, ok bool, msg string) {
+	icon := "❌"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if ok {
+		icon = "✅"
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	fmt.Fprintf(w, `<!DOCTYPE html><html lang="zh-TW"><head><meta charset="UTF-8"><title>YouTube 授權</title></head>
+<body style="background:#1e1e1e; color:#fff; font-family:'Segoe UI', sans-serif; text-align:center; padding-top:80px;">
+<h2>%s %s</h2><p><a href="/" style="color:#7c4dff;">回到 SkyForge</a></p></body></html>`, icon, html.EscapeString(msg))
+}
+
+// handleYouTubeAuthStatus 回傳各頻道的授權狀態 (帳號名稱與 token 到期時間)
+func (st *AppState) handleYouTubeAuthStatus(w http.ResponseWriter, r *http.Request) {
+	list := []YouTubeAuthStatus{}
+	for _, ch := range st.Config().channels {
+		status := YouTubeAuthStatus{ChannelID: ch.ID, ChannelName: ch.Name}
+		status.ReauthReason, status.ReauthRequired = reauthRequired(ch.ID)
+		if tok, err := tokenFromFile(ch.TokenFile); err == nil {
+			status.Connected = true
+			status.HasRefreshToken = tok.RefreshToken != ""
+			if !tok.Expiry.IsZero() {
+				status.Expiry = tok.Expiry.In(ch.location()).Format("2006-01-02 15:04")
+			}
+			oauthMu.Lock()
+			account, cached := oauthAccounts[ch.ID]
+			oauthMu.Unlock()
+			if !cached && !status.ReauthRequired {
+				// 查詢失敗時不快取，下次重新查詢
+				if name, err := fetchAccountName(ch); err == nil {
+					account = name
+					oauthMu.Lock()
+					oauthAccounts[ch.ID] = account
+					oauthMu.Unlock()
+				} else {
+					account = "未知帳號"
+					status.ReauthReason, status.ReauthRequired = reauthRequired(ch.ID)
+				}
+			}
+			status.Account = account
+		}
+		list = append(list, status)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
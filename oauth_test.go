@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestOAuthResultPageEscapes(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newAppState("", "").handleOAuth(rec, httptest.NewRequest("GET", "/oauth?error=%3Cscript%3Ealert(1)%3C/script%3E", nil))
+	body := rec.Body.String()
+	if strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;") {
+		t.Fatalf("錯誤訊息應跳脫後輸出: %s", body)
+	}
+}
+
+// fakeTokenServer 回傳固定內容的 token endpoint，並計算被呼叫的次數
+func fakeTokenServer(t *testing.T, status int, body string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// expiredToken 寫入一個已過期、需要刷新的 token 並回傳
+func expiredToken(t *testing.T, path string) *oauth2.Token {
+	t.Helper()
+	tok := &oauth2.Token{AccessToken: "old", RefreshToken: "refresh-1", TokenType: "Bearer", Expiry: time.Now().Add(-time.Hour)}
+	if err := saveToken(path, tok); err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestPersistingTokenSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token.json")
+	tok := expiredToken(t, path)
+
+	// 刷新成功：寫回新的 access token，回應沒有 refresh token 時沿用舊的
+	srv, _ := fakeTokenServer(t, 200, `{"access_token":"new","token_type":"Bearer","expires_in":3600}`)
+	config := &oauth2.Config{ClientID: "id", Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}
+	src := &persistingTokenSource{base: config.TokenSource(context.Background(), tok), path: path, channelID: "t-ok", last: tok}
+	if got, err := src.Token(); err != nil || got.AccessToken != "new" {
+		t.Fatalf("刷新失敗: %v %v", got, err)
+	}
+	saved, err := tokenFromFile(path)
+	if err != nil || saved.AccessToken != "new" || saved.RefreshToken != "refresh-1" {
+		t.Fatalf("應寫回新 token 並保留 refresh token: %+v %v", saved, err)
+	}
+
+	// invalid_grant：標記需要重新授權
+	defer clearReauthRequired("t-revoked")
+	srv, _ = fakeTokenServer(t, 400, `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+	config.Endpoint.TokenURL = srv.URL
+	tok = expiredToken(t, path)
+	src = &persistingTokenSource{base: config.TokenSource(context.Background(), tok), path: path, channelID: "t-revoked", last: tok}
+	if _, err := src.Token(); !errors.Is(err, errReauthRequired) {
+		t.Fatalf("invalid_grant 應回傳 errReauthRequired: %v", err)
+	}
+	if _, blocked := reauthRequired("t-revoked"); !blocked {
+		t.Fatal("invalid_grant 後頻道應標記為需要重新授權")
+	}
+	if saved, _ := tokenFromFile(path); saved.AccessToken != "old" {
+		t.Fatalf("刷新失敗時不應改寫 token 檔: %+v", saved)
+	}
+}
+
+func TestAuthStatusDoesNotCacheUnknownAccount(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	srv, calls := fakeTokenServer(t, 500, `{"error":"backend_error"}`)
+	secret := fmt.Sprintf(`{"installed":{"client_id":"id","client_secret":"s","auth_uri":"https://accounts.example/auth","token_uri":%q,"redirect_uris":["http://localhost"]}}`, srv.URL)
+	if err := os.WriteFile("client_secret.json", []byte(secret), 0600); err != nil {
+		t.Fatal(err)
+	}
+	st := newAppState("", "")
+	ch := st.Config().resolveChannel("")
+	expiredToken(t, ch.TokenFile)
+	defer func() {
+		oauthMu.Lock()
+		delete(oauthAccounts, ch.ID)
+		oauthMu.Unlock()
+	}()
+
+	for i := 1; i <= 2; i++ {
+		rec := httptest.NewRecorder()
+		st.handleYouTubeAuthStatus(rec, httptest.NewRequest("GET", "/api/youtube/auth_status", nil))
+		if !strings.Contains(rec.Body.String(), "未知帳號") {
+			t.Fatalf("查詢失敗時應顯示未知帳號: %s", rec.Body.String())
+		}
+		// 查詢帳號名稱應透過會刷新 token 的 client，且失敗結果不可快取
+		if n := atomic.LoadInt32(calls); n < int32(i) {
+			t.Fatalf("第 %d 次查詢應重新刷新 token，token endpoint 只被呼叫 %d 次", i, n)
+		}
+	}
+	oauthMu.Lock()
+	_, cached := oauthAccounts[ch.ID]
+	oauthMu.Unlock()
+	if cached {
+		t.Fatal("不應快取未知帳號")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ==========================================
+// 角色登錄 (v31)
+// ==========================================
+
+// RolesFile 為角色登錄檔；不存在時讀取舊版 Role.txt (每行一個 handle)，第一次儲存時移轉
+const RolesFile = "roles.json"
+
+// RoleProfile 為一個 Sora cameo 角色；生成故事時提供提示詞的角色設定，並補齊影片 metadata
+type RoleProfile struct {
+	Handle            string   `json:"Handle"` // Sora cameo，例如 @jeremy202.whiskbunbu
+	Name              string   `json:"Name,omitempty"`
+	Bible             string   `json:"Bible,omitempty"` // 角色設定 (外觀、個性、口頭禪)，填入提示詞的 Characters
+	Style             string   `json:"Style,omitempty"` // 畫面風格，填入提示詞的 Style
+	DefaultTags       []string `json:"DefaultTags,omitempty"`
+	DescriptionFooter string   `json:"DescriptionFooter,omitempty"`
+	Channel           string   `json:"Channel,omitempty"` // 目標頻道 ID，空白為主頻道
+}
+
+// UnmarshalJSON 也接受單純的字串 (舊版 /api/config 的角色清單) 作為 Handle
+func (p *RoleProfile) UnmarshalJSON(data []byte) error {
+	var handle string
+	if err := json.Unmarshal(data, &handle); err == nil {
+		*p = RoleProfile{Handle: handle}
+		return nil
+	}
+	type plain RoleProfile
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+// defaultRoles 為沒有任何角色設定時使用的內建角色
+var defaultRoles = []RoleProfile{{Handle: "@jeremy202.whiskbunbu"}}
+
+// readRoles 讀取 roles.json，沒有時讀取 Role.txt；回傳實際讀取的檔名
+func readRoles() ([]RoleProfile, string, error) {
+	data, err := os.ReadFile(RolesFile)
+	if err == nil {
+		var list []RoleProfile
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, RolesFile, describeJSONError(RolesFile, data, err)
+		}
+		return list, RolesFile, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, RolesFile, err
+	}
+	data, err = os.ReadFile(RoleFile)
+	if err != nil {
+		return nil, RoleFile, err
+	}
+	var list []RoleProfile
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, RoleProfile{Handle: line})
+		}
+	}
+	return list, RoleFile, nil
+}
+
+// loadRoles 讀取角色登錄，失敗或沒有角色時使用內建角色
+func loadRoles() []RoleProfile {
+	list, file, err := readRoles()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("⚠️ 無法讀取 %s，使用內建角色: %v\n", file, err)
+	}
+	if len(list) == 0 {
+		return defaultRoles
+	}
+	return list
+}
+
+// validateRoles 檢查 Handle 必填且不重複，Channel 必須是已設定的頻道
+func validateRoles(list []RoleProfile, rc *RuntimeConfig) []string {
+	var problems []string
+	seen := map[string]bool{}
+	for i, p := range list {
+		field := fmt.Sprintf("角色[%d]", i)
+		switch {
+		case strings.TrimSpace(p.Handle) == "":
+			problems = append(problems, field+": Handle 必填")
+		case strings.ContainsAny(p.Handle, " \t\r\n"):
+			problems = append(problems, fmt.Sprintf("%s: Handle 不可包含空白: %q", field, p.Handle))
+		case seen[p.Handle]:
+			problems = append(problems, fmt.Sprintf("%s: Handle 重複: %s", field, p.Handle))
+		}
+		seen[p.Handle] = true
+		if p.Channel != "" && rc.resolveChannel(p.Channel) == nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): 找不到頻道 %q", field, p.Handle, p.Channel))
+		}
+	}
+	return problems
+}
+
+// Roles 回傳目前的角色登錄
+func (st *AppState) Roles() []RoleProfile {
+	if r := st.roles.Load(); r != nil {
+		return *r
+	}
+	return nil
+}
+
+func (st *AppState) setRoles(roles []RoleProfile) {
+	st.roles.Store(&roles)
+}
+
+// role 依 Handle 找角色
+func (st *AppState) role(handle string) (RoleProfile, bool) {
+	for _, p := range st.Roles() {
+		if p.Handle == handle {
+			return p, true
+		}
+	}
+	return RoleProfile{}, false
+}
+
+// roleForPrompt 找出提示詞中出現的第一個已登錄角色 (提示詞第一行通常是 handle)
+func (st *AppState) roleForPrompt(prompt string) (RoleProfile, bool) {
+	for _, p := range st.Roles() {
+		if strings.Contains(prompt, p.Handle) {
+			return p, true
+		}
+	}
+	return RoleProfile{}, false
+}
+
+func (st *AppState) reloadRoles() {
+	roles, file, err := readRoles()
+	if err != nil {
+		fmt.Printf("⚠️ 無法讀取 %s: %v\n", file, err)
+		return
+	}
+	if len(roles) == 0 {
+		roles = defaultRoles
+	}
+	before := st.Roles()
+	st.setRoles(roles)
+	if !reflect.DeepEqual(before, roles) {
+		fmt.Printf("🔄 %s 已重新載入 (%d → %d 個角色)\n", file, len(before), len(roles))
+	}
+}
+
+// saveRoles 驗證後寫入 roles.json 並立即生效
+func (st *AppState) saveRoles(list []RoleProfile) error {
+	normalizeRoles(list)
+	if problems := validateRoles(list, st.Config()); len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return st.writeRoles(list)
+}
+
+// normalizeRoles 去除 Handle 前後空白
+func normalizeRoles(list []RoleProfile) {
+	for i := range list {
+		list[i].Handle = strings.TrimSpace(list[i].Handle)
+	}
+}
+
+// writeRoles 寫入已驗證的角色清單並立即生效
+func (st *AppState) writeRoles(list []RoleProfile) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(RolesFile, data, 0644); err != nil {
+		return err
+	}
+	st.reloadRoles()
+	return nil
+}
+
+// applyDefaults 以角色預設值補齊影片 metadata：標籤合併、頁尾不重複附加、未指定頻道時使用角色的頻道
+func (p RoleProfile) applyDefaults(v *VideoConfig) {
+	for _, tag := range p.DefaultTags {
+		if !containsFold(v.Tags, tag) {
+			v.Tags = append(v.Tags, tag)
+		}
+	}
+	if p.DescriptionFooter != "" && !strings.Contains(v.Description, p.DescriptionFooter) {
+		if v.Description != "" {
+			v.Description += "\n\n"
+		}
+		v.Description += p.DescriptionFooter
+	}
+	if v.Channel == "" {
+		v.Channel = p.Channel
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRoles GET 列出角色；POST 以 JSON (RoleProfile) 新增或依 Handle 更新；DELETE 以 handle= 刪除
+func (st *AppState) handleRoles(w http.ResponseWriter, r *http.Request) {
+	list := append([]RoleProfile(nil), st.Roles()...)
+	switch r.Method {
+	case "GET":
+	case "POST":
+		// 角色的頁尾與頻道會套用到每部上傳的影片，與 /api/config 一樣只接受同源 JSON
+		if err := checkJSONRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var p RoleProfile
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "JSON 格式錯誤: "+err.Error(), 400)
+			return
+		}
+		p.Handle = strings.TrimSpace(p.Handle)
+		replaced := false
+		for i := range list {
+			if list[i].Handle == p.Handle {
+				list[i], replaced = p, true
+			}
+		}
+		if !replaced {
+			list = append(list, p)
+		}
+		if err := st.saveRoles(list); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		fmt.Printf("🎭 已儲存角色 %s\n", p.Handle)
+	case "DELETE":
+		if err := checkSameOrigin(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		handle := r.URL.Query().Get("handle")
+		kept := list[:0:0]
+		for _, p := range list {
+			if p.Handle != handle {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == len(list) {
+			http.Error(w, "找不到角色 "+handle, 404)
+			return
+		}
+		if err := st.saveRoles(kept); err != nil {
+			jsonError(w, err.Error())
+			return
+		}
+		fmt.Printf("🗑️ 已刪除角色 %s\n", handle)
+	default:
+		http.Error(w, "405 Method Not Allowed", 405)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st.Roles())
+}
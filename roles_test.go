@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoleRegistry(t *testing.T) {
+	// 舊版 /api/config 以字串清單傳入角色
+	var list []RoleProfile
+	if err := json.Unmarshal([]byte(`["@a", {"Handle": "@b", "Bible": "Cat chef", "DefaultTags": ["Cute"]}]`), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Handle != "@a" || list[1].Bible != "Cat chef" {
+		t.Fatalf("解析錯誤: %+v", list)
+	}
+
+	rc := app.Config()
+	if problems := validateRoles(append(list, RoleProfile{Handle: "@a", Channel: "nope"}), rc); len(problems) != 2 {
+		t.Fatalf("應找出重複的 Handle 與不存在的頻道: %q", problems)
+	}
+
+	role := RoleProfile{Handle: "@b", DefaultTags: []string{"Cute", "Shorts"}, DescriptionFooter: "#Sora", Channel: "kids"}
+	v := VideoConfig{Description: "Hello", Tags: []string{"cute"}}
+	role.applyDefaults(&v)
+	role.applyDefaults(&v)
+	want := VideoConfig{Description: "Hello\n\n#Sora", Tags: []string{"cute", "Shorts"}, Channel: "kids"}
+	if !reflect.DeepEqual(v, want) {
+		t.Fatalf("預設值套用錯誤:\n got %+v\nwant %+v", v, want)
+	}
+}
+
+func TestHandleRolesRequiresSameOriginJSON(t *testing.T) {
+	t.Chdir(t.TempDir())
+	st := newAppState("", "")
+	do := func(method, target, body string, header map[string]string) int {
+		req := httptest.NewRequest(method, "http://localhost:9999"+target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		st.handleRoles(rec, req)
+		return rec.Code
+	}
+	role := `{"Handle": "@evil", "DescriptionFooter": "spam"}`
+	if code := do("POST", "/api/roles", role, map[string]string{"Content-Type": "text/plain"}); code != 403 {
+		t.Fatalf("text/plain 表單應被拒絕: %d", code)
+	}
+	if code := do("POST", "/api/roles", role, map[string]string{"Content-Type": "application/json", "Origin": "http://evil.example"}); code != 403 {
+		t.Fatalf("跨來源請求應被拒絕: %d", code)
+	}
+	if len(st.Roles()) != 0 {
+		t.Fatalf("被拒絕的請求不應修改角色: %+v", st.Roles())
+	}
+	if code := do("POST", "/api/roles", role, map[string]string{"Content-Type": "application/json", "Origin": "http://localhost:9999"}); code != 200 {
+		t.Fatalf("同源 JSON 請求應成功: %d", code)
+	}
+	if code := do("DELETE", "/api/roles?handle=@evil", "", map[string]string{"Origin": "http://evil.example"}); code != 403 {
+		t.Fatalf("跨來源刪除應被拒絕: %d", code)
+	}
+	if code := do("DELETE", "/api/roles?handle=@evil", "", nil); code != 200 {
+		t.Fatalf("刪除應成功: %d", code)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Windows 無系統時區資料庫時仍可載入 IANA 時區
+)
+
+// ==========================================
+// 排程規則 (v31)
+// ==========================================
+
+// ScheduleRules 擴充 ScheduleSlots：可依星期指定時段、設定停更日期、
+// 單日額外時段，以及每日上限。未設定的部分沿用 ScheduleSlots。
+type ScheduleRules struct {
+	Weekdays   map[string][]string `json:"Weekdays,omitempty"`   // "Mon": ["10:00", "18:00"]，空陣列代表當天不發片
+	Blackouts  []DateRange         `json:"Blackouts,omitempty"`  // 停更日期 (含頭尾)
+	ExtraSlots []string            `json:"ExtraSlots,omitempty"` // 單次加開: "2006-01-02 15:04"
+	MaxPerDay  int                 `json:"MaxPerDay,omitempty"`  // 0 = 不限制
+}
+
+// DateRange 為 "2006-01-02" 格式的日期區間，To 留空代表只有 From 當天。
+type DateRange struct {
+	From string `json:"From"`
+	To   string `json:"To,omitempty"`
+}
+
+// 往後搜尋的最大天數，避免規則把所有日子都排除時無窮迴圈
+const scheduleSearchDays = 400
+
+var weekdayKeys = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseSlot 解析 "HH:MM"
+func parseSlot(slot string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(slot), ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("時段格式錯誤 %q (應為 HH:MM)", slot)
+	}
+	h, errH := strconv.Atoi(parts[0])
+	m, errM := strconv.Atoi(parts[1])
+	if errH != nil || errM != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, 0, fmt.Errorf("時段格式錯誤 %q (應為 HH:MM)", slot)
+	}
+	return h, m, nil
+}
+
+// validateSlots 檢查時段清單，回傳所有格式錯誤
+func validateSlots(field string, slots []string) []string {
+	var problems []string
+	for i, slot := range slots {
+		if _, _, err := parseSlot(slot); err != nil {
+			problems = append(problems, fmt.Sprintf("%s[%d]: %v", field, i, err))
+		}
+	}
+	return problems
+}
+
+// validate 檢查排程規則的星期、日期與時段格式
+func (r *ScheduleRules) validate(field string) []string {
+	if r == nil {
+		return nil
+	}
+	var problems []string
+	// 依鍵名排序檢查，錯誤訊息順序固定；"Mon" 與 "Monday" 同時出現視為重複
+	seen := map[time.Weekday]string{}
+	for _, k := range r.sortedWeekdayKeys() {
+		wd, ok := weekdayKeys[strings.ToLower(k)]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s.Weekdays: 無法辨識的星期 %q (應為 Mon、Tue… 或 Monday…)", field, k))
+		case seen[wd] != "":
+			problems = append(problems, fmt.Sprintf("%s.Weekdays: %q 與 %q 重複指定 %s", field, seen[wd], k, wd))
+		default:
+			seen[wd] = k
+		}
+		problems = append(problems, validateSlots(fmt.Sprintf("%s.Weekdays.%s", field, k), r.Weekdays[k])...)
+	}
+	for i, b := range r.Blackouts {
+		from, err := time.Parse("2006-01-02", b.From)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s.Blackouts[%d].From: 日期格式錯誤 %q (應為 YYYY-MM-DD)", field, i, b.From))
+			continue
+		}
+		if b.To != "" {
+			to, err := time.Parse("2006-01-02", b.To)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s.Blackouts[%d].To: 日期格式錯誤 %q (應為 YYYY-MM-DD)", field, i, b.To))
+			} else if to.Before(from) {
+				problems = append(problems, fmt.Sprintf("%s.Blackouts[%d]: To (%s) 早於 From (%s)", field, i, b.To, b.From))
+			}
+		}
+	}
+	for i, s := range r.ExtraSlots {
+		if _, err := time.Parse("2006-01-02 15:04", strings.TrimSpace(s)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.ExtraSlots[%d]: 格式錯誤 %q (應為 YYYY-MM-DD HH:MM)", field, i, s))
+		}
+	}
+	if r.MaxPerDay < 0 {
+		problems = append(problems, fmt.Sprintf("%s.MaxPerDay 不可為負數", field))
+	}
+	return problems
+}
+
+// isBlackout 判斷某日是否落在停更區間
+func (r *ScheduleRules) isBlackout(day time.Time) bool {
+	if r == nil {
+		return false
+	}
+	key := day.Format("2006-01-02")
+	for _, b := range r.Blackouts {
+		to := b.To
+		if to == "" {
+			to = b.From
+		}
+		// 同格式日期字串可直接比較大小
+		if key >= b.From && key <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedWeekdayKeys 回傳排序後的 Weekdays 鍵名，結果不受 map 走訪順序影響
+func (r *ScheduleRules) sortedWeekdayKeys() []string {
+	keys := make([]string, 0, len(r.Weekdays))
+	for k := range r.Weekdays {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// weekdaySlots 回傳指定星期的時段；"Mon" 與 "Monday" 同時出現時以排序後的第一個為準
+func (r *ScheduleRules) weekdaySlots(wd time.Weekday) ([]string, bool) {
+	if r == nil {
+		return nil, false
+	}
+	for _, k := range r.sortedWeekdayKeys() {
+		if d, ok := weekdayKeys[strings.ToLower(k)]; ok && d == wd {
+			return r.Weekdays[k], true
+		}
+	}
+	return nil, false
+}
+
+// maxPerDay 回傳每日上限，0 代表不限制
+func (r *ScheduleRules) maxPerDay() int {
+	if r == nil {
+		return 0
+	}
+	return r.MaxPerDay
+}
+
+// slotsForDay 回傳某日 (loc 時區的 00:00) 所有可用時段，已排序並套用每日上限
+func slotsForDay(slotList []string, rules *ScheduleRules, day time.Time, loc *time.Location) []time.Time {
+	if rules.isBlackout(day) {
+		return nil
+	}
+
+	base := slotList
+	if v, ok := rules.weekdaySlots(day.Weekday()); ok {
+		base = v
+	}
+
+	var slots []time.Time
+	for _, s := range base {
+		h, m, err := parseSlot(s)
+		if err != nil {
+			continue
+		}
+		slots = append(slots, time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, loc))
+	}
+	if rules != nil {
+		dayKey := day.Format("2006-01-02")
+		for _, s := range rules.ExtraSlots {
+			t, err := time.ParseInLocation("2006-01-02 15:04", strings.TrimSpace(s), loc)
+			if err == nil && t.Format("2006-01-02") == dayKey {
+				slots = append(slots, t)
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Before(slots[j]) })
+	// 去除重複時段
+	uniq := slots[:0]
+	for i, t := range slots {
+		if i == 0 || !t.Equal(slots[i-1]) {
+			uniq = append(uniq, t)
+		}
+	}
+	slots = uniq
+
+	if limit := rules.maxPerDay(); limit > 0 && len(slots) > limit {
+		slots = slots[:limit]
+	}
+	return slots
+}
+
+// nextSlot 回傳此頻道在 lastTime 之後第一個符合排程規則的時段
+func (ch *ChannelProfile) nextSlot(lastTime time.Time) time.Time {
+	loc := ch.location()
+	if lastTime.IsZero() {
+		lastTime = time.Now()
+	}
+	lastTime = lastTime.In(loc)
+	day := time.Date(lastTime.Year(), lastTime.Month(), lastTime.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < scheduleSearchDays; i++ {
+		for _, candidate := range slotsForDay(ch.ScheduleSlots, ch.Schedule, day, loc) {
+			if candidate.After(lastTime) {
+				return candidate
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	fmt.Printf("⚠️ [%s] %d 天內找不到可用排程時段，請檢查 env.json 的排程設定\n", ch.ID, scheduleSearchDays)
+	return lastTime.Add(24 * time.Hour)
+}
+
+// parseLocalTime 解析網頁 datetime-local 的輸入；沒有時區資訊，一律視為頻道時區的當地時間
+func (ch *ChannelProfile) parseLocalTime(s string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02T15:04", s, ch.location())
+}
+
+// ==========================================
+// 時段佔用表 (v31)
+// ==========================================
+
+// slotOccupancy 以「分鐘」為單位記錄已被佔用的發布時段 → 佔用者 (檔名或 YouTube)
+type slotOccupancy map[int64]string
+
+func slotKey(t time.Time) int64 { return t.Truncate(time.Minute).Unix() }
+
+// buildOccupancy 由本地已排程影片與 YouTube 已排程時間建立佔用表，skip 為要排除的檔名
+func buildOccupancy(videos []VideoConfig, remote []time.Time, skip string) slotOccupancy {
+	occ := slotOccupancy{}
+	for _, v := range videos {
+		if v.PublishAt == "" || v.FileName == skip {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, v.PublishAt); err == nil {
+			occ.claim(t, v.FileName)
+		}
+	}
+	for _, t := range remote {
+		if _, taken := occ.owner(t); !taken {
+			occ.claim(t, "YouTube")
+		}
+	}
+	return occ
+}
+
+func (o slotOccupancy) owner(t time.Time) (string, bool) {
+	name, ok := o[slotKey(t)]
+	return name, ok
+}
+
+func (o slotOccupancy) claim(t time.Time, owner string) {
+	o[slotKey(t)] = owner
+}
+
+// countOnDay 回傳 t 當天 (loc 時區) 已被佔用的時段數
+func (o slotOccupancy) countOnDay(t time.Time, loc *time.Location) int {
+	day := t.In(loc).Format("2006-01-02")
+	n := 0
+	for key := range o {
+		if time.Unix(key, 0).In(loc).Format("2006-01-02") == day {
+			n++
+		}
+	}
+	return n
+}
+
+// nextFree 若 t 未被佔用則直接回傳，否則依頻道排程規則往後找第一個空時段；
+// 設定 MaxPerDay 時，當天已排滿 (含已排程的影片) 則跳到隔天
+func (o slotOccupancy) nextFree(t time.Time, ch *ChannelProfile) time.Time {
+	loc := ch.location()
+	limit := ch.Schedule.maxPerDay()
+	for i := 0; i < scheduleSearchDays*24; i++ {
+		if limit > 0 && o.countOnDay(t, loc) >= limit {
+			local := t.In(loc)
+			t = ch.nextSlot(time.Date(local.Year(), local.Month(), local.Day(), 23, 59, 59, 0, loc))
+			continue
+		}
+		if _, taken := o.owner(t); !taken {
+			return t
+		}
+		t = ch.nextSlot(t)
+	}
+	return t
+}
+
+type rebalanceEntry struct {
+	FileName  string `json:"file_name"`
+	Channel   string `json:"channel"`
+	PublishAt string `json:"publish_at"`
+}
+
+// handleRebalance 將待上傳的自動排程影片重新平均分配到現在之後的空時段。
+// 手動排程與已上傳的影片 (以及 YouTube 上已排程的影片) 視為固定佔用。
+// 帶 dry_run=1 時只回傳分配結果不存檔。
+func (st *AppState) handleRebalance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "405 Method Not Allowed", 405)
+		return
+	}
+	dryRun := r.FormValue("dry_run") == "1"
+	plan := st.rebalanceSchedule(dryRun)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "dry_run": dryRun, "plan": plan})
+}
+
+// rebalanceSchedule 計算各頻道的重新分配結果，dryRun 為 false 時寫回 videos.json
+func (st *AppState) rebalanceSchedule(dryRun bool) []rebalanceEntry {
+	videos, _ := loadConfig(ConfigFile)
+
+	plan := []rebalanceEntry{}
+	for _, ch := range st.Config().channels {
+		// 沒有 token 時不呼叫 YouTube，避免卡在命令列授權
+		var remote []time.Time
+		if _, err := tokenFromFile(ch.TokenFile); err == nil {
+			if service, err := openYouTubeService(ch); err == nil {
+				remote = getScheduledTimes(service)
+			}
+		}
+
+		var fixed []VideoConfig
+		var movable []int
+		for i, v := range videos {
+			if !ch.owns(v) {
+				continue
+			}
+			if !v.Uploaded && !v.IsManual {
+				if _, err := os.Stat(v.FileName); err == nil {
+					movable = append(movable, i)
+					continue
+				}
+			}
+			fixed = append(fixed, v)
+		}
+		occ := buildOccupancy(fixed, remote, "")
+
+		cursor := ch.nextSlot(time.Now())
+		for _, i := range movable {
+			cursor = occ.nextFree(cursor, ch)
+			occ.claim(cursor, videos[i].FileName)
+			videos[i].PublishAt = cursor.In(time.UTC).Format(time.RFC3339)
+			plan = append(plan, rebalanceEntry{
+				FileName:  videos[i].FileName,
+				Channel:   ch.ID,
+				PublishAt: cursor.In(ch.location()).Format("2006-01-02 15:04"),
+			})
+			cursor = ch.nextSlot(cursor)
+		}
+	}
+	if !dryRun {
+		saveConfig(ConfigFile, videos)
+		fmt.Printf("♻️ 已重新分配 %d 部影片的排程\n", len(plan))
+	}
+	return plan
+}
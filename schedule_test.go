@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleRules(t *testing.T) {
+	ch := &ChannelProfile{ID: "t", ScheduleSlots: []string{"18:00", "10:00"}, loc: time.UTC, Schedule: &ScheduleRules{
+		Weekdays:   map[string][]string{"Sat": {}, "Monday": {"09:00"}},
+		Blackouts:  []DateRange{{From: "2026-01-06", To: "2026-01-07"}},
+		ExtraSlots: []string{"2026-01-03 12:00"},
+	}}
+	// 2026-01-02 為星期五：週六只有加開時段、週一改用 09:00、週二三停更
+	want := []string{"2026-01-02 10:00", "2026-01-02 18:00", "2026-01-03 12:00", "2026-01-04 10:00", "2026-01-04 18:00", "2026-01-05 09:00", "2026-01-08 10:00"}
+	cur := at("2026-01-02 00:00")
+	for _, w := range want {
+		cur = ch.nextSlot(cur)
+		if got := cur.Format("2006-01-02 15:04"); got != w {
+			t.Fatalf("下一個時段應為 %s，實際為 %s", w, got)
+		}
+	}
+
+	// "Mon" 與 "Monday" 同時出現時結果固定
+	rules := &ScheduleRules{Weekdays: map[string][]string{"Monday": {"11:00"}, "Mon": {"10:00"}}}
+	for i := 0; i < 10; i++ {
+		if slots, _ := rules.weekdaySlots(time.Monday); len(slots) != 1 || slots[0] != "10:00" {
+			t.Fatalf("重複的星期應固定取排序後的第一個: %v", slots)
+		}
+	}
+
+	problems := (&ScheduleRules{Weekdays: map[string][]string{"Mon": {"10:00"}, "monday": {"11:00"}, "Funday": nil}}).validate("Schedule")
+	if len(problems) != 2 || !strings.Contains(strings.Join(problems, "\n"), "重複") {
+		t.Fatalf("應拒絕重複與無法辨識的星期: %q", problems)
+	}
+}
+
+func TestMaxPerDayCountsScheduledVideos(t *testing.T) {
+	ch := &ChannelProfile{ID: "t", ScheduleSlots: []string{"10:00", "14:00", "18:00"}, loc: time.UTC, Schedule: &ScheduleRules{MaxPerDay: 2}}
+	if slots := slotsForDay(ch.ScheduleSlots, ch.Schedule, at("2026-01-02 00:00"), time.UTC); len(slots) != 2 {
+		t.Fatalf("每日時段應截到 2 個: %v", slots)
+	}
+
+	// 當天已有一部手動排程 (不在預設時段)，只剩一個名額
+	occ := buildOccupancy([]VideoConfig{{FileName: "manual.mp4", PublishAt: at("2026-01-02 08:00").Format(time.RFC3339)}}, nil, "")
+	cur := ch.nextSlot(at("2026-01-02 00:00"))
+	var got []string
+	for i := 0; i < 3; i++ {
+		cur = occ.nextFree(cur, ch)
+		occ.claim(cur, "v.mp4")
+		got = append(got, cur.Format("2006-01-02 15:04"))
+		cur = ch.nextSlot(cur)
+	}
+	want := "2026-01-02 10:00,2026-01-03 10:00,2026-01-03 14:00"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("MaxPerDay 應計入已排程的影片:\n got %s\nwant %s", strings.Join(got, ","), want)
+	}
+}
+
+func TestScheduledTimesFromUploads(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/channels") && q.Get("mine") == "true":
+			w.Write([]byte(`{"items":[{"contentDetails":{"relatedPlaylists":{"uploads":"UU1"}}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/playlistItems") && q.Get("playlistId") == "UU1" && q.Get("pageToken") == "":
+			w.Write([]byte(`{"nextPageToken":"p2","items":[{"contentDetails":{"videoId":"a"}},{"contentDetails":{"videoId":"b"}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/playlistItems") && q.Get("pageToken") == "p2":
+			w.Write([]byte(`{"items":[{"contentDetails":{"videoId":"c"}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/videos") && strings.Join(q["id"], ",") == "a,b":
+			w.Write([]byte(`{"items":[{"id":"a","status":{"privacyStatus":"private","publishAt":"2026-01-02T10:00:00Z"}},{"id":"b","status":{"privacyStatus":"public"}}]}`))
+		case strings.HasSuffix(r.URL.Path, "/videos") && strings.Join(q["id"], ",") == "c":
+			w.Write([]byte(`{"items":[{"id":"c","status":{"privacyStatus":"private","publishAt":"2026-01-03T10:00:00Z"}}]}`))
+		default:
+			t.Errorf("未預期的請求: %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	service, err := youtube.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := getScheduledTimes(service)
+	if len(times) != 2 || !times[0].Equal(at("2026-01-02 10:00")) || !times[1].Equal(at("2026-01-03 10:00")) {
+		t.Fatalf("應讀取上傳清單中所有已排程的影片: %v", times)
+	}
+}
+
+func TestUploadLimitAndChannelErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	st := newAppState("", "")
+	cfg := defaultGlobalConfig()
+	cfg.Channels = []ChannelProfile{{ID: "a", Name: "A"}, {ID: "b", Name: "B"}}
+	if _, err := st.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	saveConfig(ConfigFile, []VideoConfig{{FileName: "1.mp4"}, {FileName: "2.mp4", Channel: "b"}})
+
+	// limit 0 代表不限：兩個頻道都會嘗試 (缺 client_secret.json)，錯誤一併回傳
+	err := st.processScheduleAndUpload(time.Time{}, 0, "", func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "[A]") || !strings.Contains(err.Error(), "[B]") {
+		t.Fatalf("limit 0 應處理所有頻道並回傳各頻道錯誤: %v", err)
+	}
+	err = st.processScheduleAndUpload(time.Time{}, 1, "b", func(string) {})
+	if err == nil || strings.Contains(err.Error(), "[A]") || !strings.Contains(err.Error(), "[B]") {
+		t.Fatalf("指定頻道時只處理該頻道: %v", err)
+	}
+}
+
+func TestScheduleUsesConfiguredTimezone(t *testing.T) {
+	st := newAppState("", "")
+	cfg := defaultGlobalConfig()
+	cfg.Timezone = "Asia/Taipei"
+	cfg.ScheduleSlots = []string{"00:30", "23:30"}
+	if _, err := st.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	ch := st.Config().resolveChannel("")
+
+	// 手動輸入的 datetime-local 視為頻道時區 (UTC+8)
+	got, err := ch.parseLocalTime("2026-03-01T09:30")
+	if err != nil || !got.Equal(at("2026-03-01 01:30")) {
+		t.Fatalf("手動時間應以設定的時區解析: %v %v", got, err)
+	}
+	if _, err := ch.parseLocalTime("2026-03-01 09:30"); err == nil {
+		t.Fatal("非 datetime-local 格式應回傳錯誤")
+	}
+
+	// 台北 23:45 (UTC 仍是同一天 15:45) 之後的下一個時段為台北隔天 00:30
+	if next := ch.nextSlot(at("2026-01-01 15:45")); !next.Equal(at("2026-01-01 16:30")) {
+		t.Fatalf("跨過當地午夜的下一個時段錯誤: %v", next.UTC())
+	}
+	// UTC 已跨日但台北仍在 23:30 之前
+	if next := ch.nextSlot(at("2026-01-01 15:00")); !next.Equal(at("2026-01-01 15:30")) {
+		t.Fatalf("應使用台北當天 23:30: %v", next.UTC())
+	}
+
+	// 夏令時間開始 (紐約 2026-03-08)：時段維持當地 10:00，實際間隔只有 23 小時
+	cfg.Timezone = "America/New_York"
+	cfg.ScheduleSlots = []string{"10:00"}
+	if _, err := st.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	ch = st.Config().resolveChannel("")
+	before := at("2026-03-07 15:00") // 10:00 EST
+	next := ch.nextSlot(before)
+	if !next.Equal(at("2026-03-08 14:00")) || next.Sub(before) != 23*time.Hour {
+		t.Fatalf("夏令時間開始後應仍在當地 10:00 發布: %v", next.UTC())
+	}
+	// 夏令時間結束 (2026-11-01)：間隔 25 小時
+	before = at("2026-10-31 14:00") // 10:00 EDT
+	if next := ch.nextSlot(before); next.Sub(before) != 25*time.Hour {
+		t.Fatalf("夏令時間結束後應仍在當地 10:00 發布: %v", next.UTC())
+	}
+}
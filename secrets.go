@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"SoraYT_Studio/vault"
+)
+
+// ==========================================
+// 加密憑證庫 (v31)
+// ==========================================
+
+// 憑證庫內的名稱
+const (
+	SecretSoraSession = "sora/session"
+	SecretSoraCurl    = "sora/curl"
+	SecretGeminiKey   = vault.SecretGeminiKey
+	secretTokenPrefix = "youtube/token/"
+)
+
+// secretVault 為 nil 時代表未啟用加密，沿用舊的明文檔案
+var secretVault *vault.Vault
+
+// initVault 有金鑰或已有 secrets.vault 時解鎖憑證庫
+func initVault() error {
+	if !vault.Exists(vault.DefaultPath) && !vault.Available() {
+		fmt.Println("⚠️ 未啟用加密憑證庫，憑證以明文儲存 (執行 `vault init` 與 `vault migrate` 啟用)")
+		return nil
+	}
+	v, err := vault.Open(vault.DefaultPath)
+	if err != nil {
+		return err
+	}
+	secretVault = v
+	fmt.Println("🔐 加密憑證庫已解鎖")
+	return nil
+}
+
+func tokenSecretName(tokFile string) string {
+	return secretTokenPrefix + tokFile
+}
+
+// runVaultCommand 處理 `vault <子命令>`，回傳 exit code
+func runVaultCommand(args []string) int {
+	if len(args) == 0 {
+		printVaultUsage()
+		return 2
+	}
+	cmd, rest := args[0], args[1:]
+
+	if cmd == "init" {
+		if os.Getenv(vault.EnvPassphrase) == "" {
+			path, err := vault.GenerateKeyFile()
+			if err != nil {
+				fmt.Println("❌", err)
+				return 1
+			}
+			fmt.Printf("🔑 已產生金鑰檔 %s (請妥善備份，並勿加入版本控制)\n", path)
+		}
+		v, err := vault.Open(vault.DefaultPath)
+		if err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		if err := v.Save(); err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		fmt.Printf("✅ 已建立 %s\n", vault.DefaultPath)
+		return 0
+	}
+
+	v, err := vault.Open(vault.DefaultPath)
+	if err != nil {
+		fmt.Println("❌", err)
+		return 1
+	}
+
+	switch cmd {
+	case "list":
+		for _, name := range v.Names() {
+			fmt.Println(name)
+		}
+	case "get":
+		if len(rest) != 1 {
+			printVaultUsage()
+			return 2
+		}
+		val, ok := v.Get(rest[0])
+		if !ok {
+			fmt.Printf("❌ 找不到 %s\n", rest[0])
+			return 1
+		}
+		fmt.Println(val)
+	case "set":
+		if len(rest) < 1 || len(rest) > 2 {
+			printVaultUsage()
+			return 2
+		}
+		var val string
+		if len(rest) == 2 {
+			val = rest[1]
+		} else {
+			// 未給值時從 stdin 讀取，避免密碼留在 shell 歷史
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Println("❌", err)
+				return 1
+			}
+			val = strings.TrimRight(string(b), "\r\n")
+		}
+		if err := v.Set(rest[0], val); err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		fmt.Printf("✅ 已儲存 %s\n", rest[0])
+	case "delete":
+		if len(rest) != 1 {
+			printVaultUsage()
+			return 2
+		}
+		if err := v.Delete(rest[0]); err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		fmt.Printf("🗑️ 已刪除 %s\n", rest[0])
+	case "rotate":
+		if err := v.Rotate(); err != nil {
+			fmt.Println("❌ 金鑰輪替失敗:", err)
+			return 1
+		}
+		if os.Getenv(vault.EnvNewPassphrase) != "" {
+			fmt.Printf("🔄 已改用新密碼加密，之後請以新密碼設定 %s\n", vault.EnvPassphrase)
+		} else {
+			fmt.Println("🔄 已產生新金鑰檔並重新加密")
+		}
+	case "export":
+		b, _ := json.MarshalIndent(v.Export(), "", "  ")
+		fmt.Println(string(b))
+	case "import":
+		if len(rest) != 1 {
+			printVaultUsage()
+			return 2
+		}
+		b, err := os.ReadFile(rest[0])
+		if err != nil {
+			fmt.Println("❌", err)
+			return 1
+		}
+		var m map[string]string
+		if err := json.Unmarshal(b, &m); err != nil {
+			fmt.Println("❌ JSON 格式錯誤:", err)
+			return 1
+		}
+		for k, val := range m {
+			if err := v.Set(k, val); err != nil {
+				fmt.Println("❌", err)
+				return 1
+			}
+		}
+		fmt.Printf("✅ 已匯入 %d 筆\n", len(m))
+	case "migrate":
+		return migrateSecrets(v)
+	default:
+		printVaultUsage()
+		return 2
+	}
+	return 0
+}
+
+func printVaultUsage() {
+	fmt.Println(`用法: vault <命令>
+  init                 建立憑證庫 (未設定 SKYFORGE_VAULT_PASSPHRASE 時產生 vault.key)
+  list                 列出所有憑證名稱
+  get <名稱>           顯示憑證內容
+  set <名稱> [值]      寫入憑證 (省略值時由 stdin 讀取)
+  delete <名稱>        刪除憑證
+  rotate               以新金鑰重新加密 (設定 SKYFORGE_VAULT_NEW_PASSPHRASE 則改用新密碼)
+  export               以 JSON 輸出所有明文憑證
+  import <檔案>        從 JSON 匯入憑證
+  migrate              將 session_cache.json、userid.txt、sora_accounts.json、token 檔與 env.json 的 API Key 移入憑證庫`)
+}
+
+// migrateSecrets 將現有明文憑證移入憑證庫，成功後刪除明文檔案
+func migrateSecrets(v *vault.Vault) int {
+	var rc *RuntimeConfig
+	cfg, err := readGlobalConfig()
+	if err == nil {
+		rc, err = app.SetConfig(cfg)
+	}
+	if err != nil {
+		fmt.Println("❌", err)
+		return 1
+	}
+
+	moveFile := func(path, name string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		if err := v.Set(name, string(data)); err != nil {
+			fmt.Printf("❌ %s 移轉失敗: %v\n", path, err)
+			return
+		}
+		os.Remove(path)
+		fmt.Printf("🔐 %s → %s (已刪除明文檔)\n", path, name)
+	}
+	moveFile("session_cache.json", SecretSoraSession)
+	moveFile(UserCurlFile, SecretSoraCurl)
+	moveFile(SoraAccountsFile, SecretSoraAccounts)
+	for _, ch := range rc.channels {
+		moveFile(ch.TokenFile, tokenSecretName(ch.TokenFile))
+	}
+
+	// env.json 保留其他設定，只清空 LLM.ApiKey
+	data, err := os.ReadFile(EnvFile)
+	if err != nil {
+		return 0
+	}
+	var env map[string]interface{}
+	if err := json.Unmarshal(data, &env); err != nil {
+		fmt.Printf("⚠️ %s 格式錯誤，略過 API Key 移轉: %v\n", EnvFile, err)
+		return 0
+	}
+	if llm, ok := env["LLM"].(map[string]interface{}); ok {
+		if key, _ := llm["ApiKey"].(string); key != "" {
+			if err := v.Set(SecretGeminiKey, key); err != nil {
+				fmt.Println("❌ API Key 移轉失敗:", err)
+				return 1
+			}
+			llm["ApiKey"] = ""
+			b, _ := json.MarshalIndent(env, "", "  ")
+			os.WriteFile(EnvFile, b, 0644)
+			fmt.Printf("🔐 %s LLM.ApiKey → %s (已從 env.json 清除)\n", EnvFile, SecretGeminiKey)
+		}
+	}
+	return 0
+}
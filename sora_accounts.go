@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"SoraYT_Studio/filelock"
+)
+
+// ==========================================
+// 多 Sora 帳號輪替 (v31)
+// ==========================================
+
+const (
+	// DefaultSoraAccount 為舊版單一憑證移轉後的帳號名稱
+	DefaultSoraAccount = "default"
+	SoraAccountsFile   = "sora_accounts.json"
+	SecretSoraAccounts = "sora/accounts"
+
+	// soraQuotaRecheck 為額度用完 (HTTP 429) 後多久重新嘗試該帳號，額度恢復後會由回應更新
+	soraQuotaRecheck = time.Hour
+)
+
+// SoraAccount 為一組具名的 Sora 憑證與其剩餘額度
+type SoraAccount struct {
+	Name      string           `json:"name"`
+	Creds     *SoraCredentials `json:"creds"`
+	Remaining int              `json:"remaining"` // 預估剩餘生成次數，-1 代表未知
+	UpdatedAt time.Time        `json:"updated_at,omitempty"`
+	Disabled  bool             `json:"disabled,omitempty"`
+}
+
+// quota 回傳挑選帳號時使用的剩餘額度：用完超過 soraQuotaRecheck 的帳號視為未知，重新嘗試以取得最新額度
+func (a SoraAccount) quota(now time.Time) int {
+	if a.Remaining == 0 && now.Sub(a.UpdatedAt) >= soraQuotaRecheck {
+		return -1
+	}
+	return a.Remaining
+}
+
+// SoraAccountStatus 為 /api/sora/accounts 的單一帳號資訊 (不含憑證內容)
+type SoraAccountStatus struct {
+	Name      string            `json:"name"`
+	Remaining int               `json:"remaining"`
+	UpdatedAt string            `json:"updated_at,omitempty"`
+	Disabled  bool              `json:"disabled"`
+	Session   SoraSessionStatus `json:"session"`
+}
+
+// soraAccountPool 管理所有帳號與其 session 狀態；對外一律回傳複本，SoraCredentials 建立後不再修改
+type soraAccountPool struct {
+	file string // 明文模式下的存檔路徑，空字串代表不存檔
+
+	mu       sync.Mutex
+	accounts []*SoraAccount
+	tasks    map[string]string // Sora task ID → 帳號名稱
+	dead     map[string]string // 帳號 → session 失效原因
+	warned   map[string]bool   // 帳號 → 已提醒即將到期
+
+	loc func() *time.Location // 顯示到期時間用的時區，由 AppState 注入
+}
+
+// location 回傳注入的時區，未注入時使用系統時區
+func (p *soraAccountPool) location() *time.Location {
+	if p.loc == nil {
+		return time.Local
+	}
+	return p.loc()
+}
+
+func newSoraAccountPool(file string) *soraAccountPool {
+	return &soraAccountPool{
+		file:   file,
+		tasks:  map[string]string{},
+		dead:   map[string]string{},
+		warned: map[string]bool{},
+	}
+}
+
+// load 讀取帳號清單；沒有時移轉舊版的單一憑證為 default 帳號
+func (p *soraAccountPool) load() {
+	list, err := p.readStored()
+	if err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+	}
+
+	p.mu.Lock()
+	p.accounts = append(p.accounts, list...)
+	count := len(p.accounts)
+	p.mu.Unlock()
+
+	if count > 0 {
+		fmt.Printf("✅ 已載入 %d 個 Sora 帳號\n", count)
+		return
+	}
+	if creds := initSoraCredentials(); creds != nil {
+		if err := p.upsert(DefaultSoraAccount, creds); err != nil {
+			fmt.Printf("⚠️ 無法移轉舊版 Sora 憑證: %v\n", err)
+		}
+	}
+}
+
+// readStored 讀取憑證庫 (或明文檔) 中的帳號清單，略過沒有 token 的項目
+func (p *soraAccountPool) readStored() ([]*SoraAccount, error) {
+	var data []byte
+	if secretVault != nil {
+		if s, ok := secretVault.Get(SecretSoraAccounts); ok {
+			data = []byte(s)
+		}
+	}
+	if data == nil && p.file != "" {
+		data, _ = os.ReadFile(p.file)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	var list, valid []*SoraAccount
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("Sora 帳號清單格式錯誤: %w", err)
+	}
+	for _, a := range list {
+		if a.Name != "" && a.Creds != nil && a.Creds.BearerToken != "" {
+			valid = append(valid, a)
+		}
+	}
+	return valid, nil
+}
+
+// mutate 在檔案鎖內重新讀取最新的帳號清單後執行 fn 並存檔，避免 serve 與 CLI 互相覆蓋；
+// 重新讀取失敗時不修改也不存檔
+func (p *soraAccountPool) mutate(fn func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file != "" {
+		unlock, err := filelock.Lock(p.file)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		list, err := p.readStored()
+		if err != nil {
+			return err
+		}
+		p.accounts = list
+	}
+	fn()
+	p.saveLocked()
+	return nil
+}
+
+// saveLocked 將帳號清單寫入憑證庫 (或明文檔)，呼叫前需持有 p.mu
+func (p *soraAccountPool) saveLocked() {
+	if p.file == "" {
+		return
+	}
+	b, _ := json.MarshalIndent(p.accounts, "", "  ")
+	if secretVault != nil {
+		if err := secretVault.Set(SecretSoraAccounts, string(b)); err != nil {
+			fmt.Printf("⚠️ 無法寫入憑證庫: %v\n", err)
+		}
+		return
+	}
+	if err := os.WriteFile(p.file, b, 0600); err != nil {
+		fmt.Printf("⚠️ 無法寫入 %s: %v\n", p.file, err)
+	}
+}
+
+func (p *soraAccountPool) findLocked(name string) *SoraAccount {
+	for _, a := range p.accounts {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// upsert 新增或更新帳號憑證；更新憑證時額度重設為未知
+func (p *soraAccountPool) upsert(name string, creds *SoraCredentials) error {
+	return p.mutate(func() {
+		if a := p.findLocked(name); a != nil {
+			a.Creds = creds
+			a.Remaining = -1
+			a.Disabled = false
+		} else {
+			p.accounts = append(p.accounts, &SoraAccount{Name: name, Creds: creds, Remaining: -1})
+		}
+	})
+}
+
+func (p *soraAccountPool) remove(name string) (bool, error) {
+	found := false
+	err := p.mutate(func() {
+		for i, a := range p.accounts {
+			if a.Name == name {
+				p.accounts = append(p.accounts[:i:i], p.accounts[i+1:]...)
+				found = true
+				return
+			}
+		}
+	})
+	return found, err
+}
+
+func (p *soraAccountPool) setRemaining(name string, remaining int) {
+	err := p.mutate(func() {
+		if a := p.findLocked(name); a != nil {
+			a.Remaining = remaining
+			a.UpdatedAt = time.Now()
+		}
+	})
+	if err != nil {
+		fmt.Printf("⚠️ 無法更新 Sora 帳號 %s 的額度: %v\n", name, err)
+	}
+}
+
+func (p *soraAccountPool) get(name string) (SoraAccount, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if a := p.findLocked(name); a != nil {
+		return *a, true
+	}
+	return SoraAccount{}, false
+}
+
+func (p *soraAccountPool) snapshot() []SoraAccount {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]SoraAccount, len(p.accounts))
+	for i, a := range p.accounts {
+		list[i] = *a
+	}
+	return list
+}
+
+func (p *soraAccountPool) empty() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.accounts) == 0
+}
+
+// usable 回傳未停用且 session 有效的帳號，preferred 排在最前面
+func (p *soraAccountPool) usable(preferred string) []SoraAccount {
+	var list []SoraAccount
+	for _, a := range p.snapshot() {
+		if !a.Disabled && p.check(a) == nil {
+			list = append(list, a)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Name == preferred && list[j].Name != preferred
+	})
+	return list
+}
+
+// pick 選出要執行新生成任務的帳號：額度未知者優先 (順便取得額度)，其次剩餘最多者；
+// 額度用完的帳號在 soraQuotaRecheck 內略過
+func (p *soraAccountPool) pick() (SoraAccount, error) {
+	if p.empty() {
+		return SoraAccount{}, fmt.Errorf("未登入")
+	}
+	now := time.Now()
+	var best *SoraAccount
+	bestQuota := 0
+	for _, a := range p.usable("") {
+		a := a
+		q := a.quota(now)
+		if q == 0 {
+			continue
+		}
+		if best == nil || (bestQuota >= 0 && (q < 0 || q > bestQuota)) {
+			best, bestQuota = &a, q
+		}
+	}
+	if best == nil {
+		return SoraAccount{}, fmt.Errorf("所有 Sora 帳號皆無可用額度或憑證已失效")
+	}
+	return *best, nil
+}
+
+// resolve 依名稱取得帳號，名稱空白時依 task ID 對應，再不行則挑選可用帳號
+func (p *soraAccountPool) resolve(name, taskID string) (SoraAccount, error) {
+	if name == "" && taskID != "" {
+		p.mu.Lock()
+		name = p.tasks[taskID]
+		p.mu.Unlock()
+	}
+	if name != "" {
+		if a, ok := p.get(name); ok {
+			return a, nil
+		}
+		return SoraAccount{}, fmt.Errorf("未知的 Sora 帳號: %s", name)
+	}
+	list := p.usable("")
+	if len(list) == 0 {
+		return SoraAccount{}, fmt.Errorf("未登入")
+	}
+	return list[0], nil
+}
+
+func (p *soraAccountPool) recordTask(taskID, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasks[taskID] = name
+}
+
+// handleSoraAccounts GET 列出帳號狀態；POST action=remove&name=… 移除帳號
+func (st *AppState) handleSoraAccounts(w http.ResponseWriter, r *http.Request) {
+	p := st.sora
+	if r.Method == "POST" {
+		name := strings.TrimSpace(r.FormValue("name"))
+		if r.FormValue("action") != "remove" || name == "" {
+			http.Error(w, "參數錯誤", 400)
+			return
+		}
+		found, err := p.remove(name)
+		if err != nil {
+			jsonError(w, err.Error())
+			return
+		}
+		if !found {
+			http.Error(w, "找不到帳號", 404)
+			return
+		}
+		p.resetSession(name)
+		fmt.Printf("🗑️ 已移除 Sora 帳號: %s\n", name)
+	}
+	list := []SoraAccountStatus{}
+	for _, a := range p.snapshot() {
+		s := SoraAccountStatus{Name: a.Name, Remaining: a.Remaining, Disabled: a.Disabled, Session: p.sessionStatus(a)}
+		if !a.UpdatedAt.IsZero() {
+			s.UpdatedAt = a.UpdatedAt.In(st.Config().Loc).Format("2006-01-02 15:04")
+		}
+		list = append(list, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSoraPickOrder(t *testing.T) {
+	p := newSoraAccountPool("")
+	now := time.Now()
+	p.accounts = []*SoraAccount{
+		{Name: "low", Creds: &SoraCredentials{BearerToken: "Bearer a"}, Remaining: 3, UpdatedAt: now},
+		{Name: "high", Creds: &SoraCredentials{BearerToken: "Bearer b"}, Remaining: 9, UpdatedAt: now},
+		{Name: "empty", Creds: &SoraCredentials{BearerToken: "Bearer c"}, Remaining: 0, UpdatedAt: now},
+		{Name: "off", Creds: &SoraCredentials{BearerToken: "Bearer d"}, Remaining: -1, Disabled: true},
+	}
+	if acc, err := p.pick(); err != nil || acc.Name != "high" {
+		t.Fatalf("應挑選剩餘額度最多的帳號: %v %v", acc.Name, err)
+	}
+
+	p.accounts = append(p.accounts, &SoraAccount{Name: "new", Creds: &SoraCredentials{BearerToken: "Bearer e"}, Remaining: -1})
+	if acc, _ := p.pick(); acc.Name != "new" {
+		t.Fatalf("額度未知的帳號應優先: %v", acc.Name)
+	}
+
+	// 只剩用完額度的帳號：冷卻期內不可用，過了 soraQuotaRecheck 後重新嘗試
+	p.accounts = p.accounts[2:3]
+	if _, err := p.pick(); err == nil {
+		t.Fatal("額度用完的帳號在冷卻期內不應被挑選")
+	}
+	p.accounts[0].UpdatedAt = now.Add(-soraQuotaRecheck - time.Minute)
+	if acc, err := p.pick(); err != nil || acc.Name != "empty" {
+		t.Fatalf("冷卻期過後應重新嘗試: %v %v", acc.Name, err)
+	}
+}
+
+func TestSoraFailoverAndTaskRouting(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	st := newTestState(t, func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		mu.Lock()
+		calls = append(calls, r.URL.Path+" "+auth)
+		mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/create") && auth == "Bearer tok-a":
+			http.Error(w, `{"error":"rate limited"}`, http.StatusTooManyRequests)
+		case strings.HasSuffix(r.URL.Path, "/create"):
+			w.Write([]byte(`{"id":"task_b","rate_limit_and_credit_balance":{"estimated_num_videos_remaining":4}}`))
+		case strings.HasSuffix(r.URL.Path, "/pending"):
+			w.Write([]byte(`[]`))
+		case strings.HasSuffix(r.URL.Path, "/mailbox") && auth == "Bearer tok-b":
+			w.Write([]byte(`{"items":[{"kind":"sora_gen_complete","display_str":"S9_1 story","object":{"draft":{"id":"d1","task_id":"task_b","downloadable_url":"https://videos.example/files/abc/raw"}}}]}`))
+		default:
+			w.Write([]byte(`{"items":[]}`))
+		}
+	})
+	st.sora.upsert("a", &SoraCredentials{BearerToken: "Bearer tok-a"})
+	st.sora.upsert("b", &SoraCredentials{BearerToken: "Bearer tok-b"})
+	st.sora.setRemaining("a", 10)
+	st.sora.setRemaining("b", 5)
+
+	resp, err := st.createSoraTask("prompt")
+	if err != nil || resp["account"] != "b" {
+		t.Fatalf("429 時應改用下一個帳號: %v %v", resp, err)
+	}
+	if a, _ := st.sora.get("a"); a.Remaining != 0 {
+		t.Fatalf("429 的帳號應標記為額度用完: %d", a.Remaining)
+	}
+	if b, _ := st.sora.get("b"); b.Remaining != 4 {
+		t.Fatalf("應依回應更新剩餘額度: %d", b.Remaining)
+	}
+
+	mu.Lock()
+	calls = nil
+	mu.Unlock()
+	if _, done, err := st.pollSoraTask("task_b", ""); err != nil || !done {
+		t.Fatalf("poll 失敗: %v %v", done, err)
+	}
+	mu.Lock()
+	for _, c := range calls {
+		if !strings.HasSuffix(c, "tok-b") {
+			t.Errorf("任務應在送出它的帳號查詢: %s", c)
+		}
+	}
+	mu.Unlock()
+
+	// 下載補檔時由 mailbox 找到影片的帳號回傳
+	url, found, err := st.fetchSoraURLFromHistory("S9_1", "a")
+	if err != nil || found != "b" || !strings.Contains(url, "abc") {
+		t.Fatalf("應回傳影片所在的帳號: %q %q %v", url, found, err)
+	}
+}
+
+func TestSoraAccountsSharedFile(t *testing.T) {
+	// serve 與 CLI 各自持有一份帳號清單，彼此的修改不可被覆蓋
+	file := filepath.Join(t.TempDir(), SoraAccountsFile)
+	serve, cli := newSoraAccountPool(file), newSoraAccountPool(file)
+	if err := serve.upsert("a", &SoraCredentials{BearerToken: "Bearer a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.upsert("b", &SoraCredentials{BearerToken: "Bearer b"}); err != nil {
+		t.Fatal(err)
+	}
+	serve.setRemaining("a", 7)
+
+	check := newSoraAccountPool(file)
+	list, err := check.readStored()
+	if err != nil || len(list) != 2 {
+		t.Fatalf("兩個行程新增的帳號都應保留: %+v %v", list, err)
+	}
+	if a, _ := serve.get("a"); a.Remaining != 7 {
+		t.Fatalf("額度更新遺失: %+v", a)
+	}
+}
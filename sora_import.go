@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ==========================================
+// Sora 憑證匯入 (cURL / HAR / fetch) (v31)
+// ==========================================
+
+// DefaultUserAgent 僅在匯入內容沒有 user-agent 時使用
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/142.0.0.0 Safari/537.36"
+
+// ImportReport 說明匯入時找到哪些欄位
+type ImportReport struct {
+	Format          string   `json:"format"` // curl-bash / curl-cmd / har / fetch
+	URL             string   `json:"url,omitempty"`
+	Found           []string `json:"found"`
+	Missing         []string `json:"missing"`
+	ExtraHeaders    []string `json:"extra_headers,omitempty"`
+	Validated       bool     `json:"validated"`
+	ValidationError string   `json:"validation_error,omitempty"`
+}
+
+// 除了主要四個欄位外，這些前綴的 header 也會一併保存並隨請求送出
+var soraExtraHeaderPrefixes = []string{"oai-", "openai-", "sec-ch-ua", "accept-language"}
+
+// parseCurlContent 保留舊介面：解析任何支援的格式並回傳憑證
+func parseCurlContent(content string) (*SoraCredentials, error) {
+	creds, _, err := importSoraCredentials(content)
+	return creds, err
+}
+
+// importSoraCredentials 自動判斷格式並抽出 Sora 所需的 header
+func importSoraCredentials(content string) (*SoraCredentials, *ImportReport, error) {
+	content = strings.TrimSpace(strings.TrimPrefix(content, "\ufeff"))
+	if content == "" {
+		return nil, nil, fmt.Errorf("內容是空的")
+	}
+
+	var (
+		headers map[string]string
+		url     string
+		format  string
+		err     error
+	)
+	switch {
+	case strings.HasPrefix(content, "{") && strings.Contains(content, `"log"`):
+		format = "har"
+		headers, url, err = parseHARHeaders(content)
+	case strings.HasPrefix(content, "fetch(") || strings.HasPrefix(content, "await fetch("):
+		format = "fetch"
+		headers, url, err = parseFetchHeaders(content)
+	case strings.HasPrefix(strings.ToLower(content), "curl"):
+		var tokens []string
+		if isCmdCurl(content) {
+			format = "curl-cmd"
+			tokens = tokenizeCmd(content)
+		} else {
+			format = "curl-bash"
+			tokens = tokenizeBash(content)
+		}
+		headers, url = curlHeaders(tokens)
+	default:
+		return nil, nil, fmt.Errorf("無法辨識格式 (支援 cURL bash/cmd、HAR、Copy as fetch)")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &ImportReport{Format: format, URL: url, Found: []string{}, Missing: []string{}}
+	creds := &SoraCredentials{ExtraHeaders: map[string]string{}}
+	for name, value := range headers {
+		switch name {
+		case "authorization":
+			token := strings.TrimSpace(value)
+			if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+				token = strings.TrimSpace(token[7:])
+			}
+			if token != "" {
+				creds.BearerToken = "Bearer " + token
+			}
+		case "cookie":
+			creds.Cookie = value
+		case "oai-device-id":
+			creds.DeviceID = value
+		case "user-agent":
+			creds.UserAgent = value
+		default:
+			for _, p := range soraExtraHeaderPrefixes {
+				if strings.HasPrefix(name, p) {
+					creds.ExtraHeaders[name] = value
+					report.ExtraHeaders = append(report.ExtraHeaders, name)
+					break
+				}
+			}
+		}
+	}
+
+	fields := []struct {
+		name string
+		ok   bool
+	}{
+		{"authorization", creds.BearerToken != ""},
+		{"cookie", creds.Cookie != ""},
+		{"oai-device-id", creds.DeviceID != ""},
+		{"user-agent", creds.UserAgent != ""},
+	}
+	for _, f := range fields {
+		if f.ok {
+			report.Found = append(report.Found, f.name)
+		} else {
+			report.Missing = append(report.Missing, f.name)
+		}
+	}
+	sort.Strings(report.ExtraHeaders)
+	if creds.UserAgent == "" {
+		creds.UserAgent = DefaultUserAgent
+	}
+	if creds.BearerToken == "" {
+		return nil, report, fmt.Errorf("Token 解析失敗 (找不到 authorization header)")
+	}
+	return creds, report, nil
+}
+
+// ---------- cURL ----------
+
+// isCmdCurl 判斷是否為 Chrome「Copy as cURL (cmd)」格式
+func isCmdCurl(s string) bool {
+	return strings.Contains(s, `^"`) || regexp.MustCompile(`\^\r?\n`).MatchString(s)
+}
+
+// tokenizeBash 以 POSIX shell 規則切割參數 ('…'、"…"、$'…'、反斜線與換行接續)
+func tokenizeBash(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inToken := false
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case c == '\\' && i+1 < len(rs):
+			i++
+			if rs[i] == '\n' || (rs[i] == '\r' && i+1 < len(rs) && rs[i+1] == '\n') {
+				if rs[i] == '\r' {
+					i++
+				}
+				continue
+			}
+			cur.WriteRune(rs[i])
+			inToken = true
+		case c == '\'':
+			inToken = true
+			for i++; i < len(rs) && rs[i] != '\''; i++ {
+				cur.WriteRune(rs[i])
+			}
+		case c == '$' && i+1 < len(rs) && rs[i+1] == '\'':
+			inToken = true
+			for i += 2; i < len(rs) && rs[i] != '\''; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+					switch rs[i] {
+					case 'n':
+						cur.WriteRune('\n')
+					case 't':
+						cur.WriteRune('\t')
+					case 'r':
+						cur.WriteRune('\r')
+					case 'x':
+						if i+2 < len(rs) {
+							if v, err := strconv.ParseUint(string(rs[i+1:i+3]), 16, 8); err == nil {
+								cur.WriteByte(byte(v))
+								i += 2
+								continue
+							}
+						}
+						cur.WriteRune('x')
+					default:
+						cur.WriteRune(rs[i])
+					}
+					continue
+				}
+				cur.WriteRune(rs[i])
+			}
+		case c == '"':
+			inToken = true
+			for i++; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) && strings.ContainsRune("\"\\$`\n", rs[i+1]) {
+					i++
+					if rs[i] == '\n' {
+						continue
+					}
+				}
+				cur.WriteRune(rs[i])
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inToken {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteRune(c)
+			inToken = true
+		}
+	}
+	if inToken {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// tokenizeCmd 切割 Chrome「Copy as cURL (cmd)」：先還原 cmd 的 ^ 跳脫 (^X 為字面上的 X，
+// 行尾的 ^ 為接續；cmd 引號內的 ^ 不是跳脫字元)，再以 Windows 命令列規則切割參數。
+// Chrome 把值裡的 " 寫成 ^\^"，還原後為 \"，由第二層解讀為字面上的雙引號
+func tokenizeCmd(s string) []string {
+	var b strings.Builder
+	inQuote := false
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+		case c == '^' && !inQuote && i+1 < len(rs):
+			i++
+			if rs[i] == '\r' && i+1 < len(rs) && rs[i+1] == '\n' {
+				i++
+			}
+			if rs[i] == '\n' {
+				continue
+			}
+			c = rs[i]
+		}
+		b.WriteRune(c)
+	}
+	return splitWindowsArgs(b.String())
+}
+
+// splitWindowsArgs 以 Windows 程式切割命令列的規則 (CommandLineToArgvW) 切割參數：
+// "…" 為引號；緊接在 " 前的 2n 個反斜線為 n 個反斜線，2n+1 個時另加字面上的 "
+func splitWindowsArgs(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inToken, inQuote := false, false
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case c == '\\':
+			n := 0
+			for ; i < len(rs) && rs[i] == '\\'; i++ {
+				n++
+			}
+			if i < len(rs) && rs[i] == '"' {
+				cur.WriteString(strings.Repeat(`\`, n/2))
+				if n%2 == 1 {
+					cur.WriteRune('"')
+					inToken = true
+					continue
+				}
+			} else {
+				cur.WriteString(strings.Repeat(`\`, n))
+			}
+			i-- // 交給下一輪處理反斜線之後的字元
+			inToken = true
+		case c == '"':
+			inQuote = !inQuote
+			inToken = true
+		case !inQuote && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			if inToken {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteRune(c)
+			inToken = true
+		}
+	}
+	if inToken {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// curlHeaders 由 cURL 參數取出 header (名稱一律小寫) 與網址
+func curlHeaders(tokens []string) (map[string]string, string) {
+	headers := map[string]string{}
+	url := ""
+	// 需要帶值但與 header 無關的參數
+	skipValue := map[string]bool{
+		"-X": true, "--request": true, "-d": true, "--data": true, "--data-raw": true,
+		"--data-binary": true, "--data-urlencode": true, "-u": true, "--user": true,
+		"-o": true, "--output": true,
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		next := func() string {
+			if i+1 < len(tokens) {
+				i++
+				return tokens[i]
+			}
+			return ""
+		}
+		switch {
+		case i == 0 && strings.EqualFold(t, "curl"):
+		case t == "-H" || t == "--header":
+			addHeaderLine(headers, next())
+		case t == "-b" || t == "--cookie":
+			headers["cookie"] = next()
+		case t == "-A" || t == "--user-agent":
+			headers["user-agent"] = next()
+		case t == "-e" || t == "--referer":
+			headers["referer"] = next()
+		case t == "--url":
+			url = next()
+		case skipValue[t]:
+			next()
+		case strings.HasPrefix(t, "http://") || strings.HasPrefix(t, "https://"):
+			if url == "" {
+				url = t
+			}
+		}
+	}
+	return headers, url
+}
+
+func addHeaderLine(headers map[string]string, line string) {
+	idx := strings.Index(line, ":")
+	if idx <= 0 {
+		return
+	}
+	name := strings.ToLower(strings.TrimSpace(line[:idx]))
+	headers[name] = strings.TrimSpace(line[idx+1:])
+}
+
+// ---------- HAR ----------
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				Cookies []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"cookies"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// parseHARHeaders 取 HAR 中最後一筆帶 authorization 的 Sora backend 請求
+func parseHARHeaders(content string) (map[string]string, string, error) {
+	var har harFile
+	if err := json.Unmarshal([]byte(content), &har); err != nil {
+		return nil, "", fmt.Errorf("HAR 格式錯誤: %w", err)
+	}
+	for i := len(har.Log.Entries) - 1; i >= 0; i-- {
+		req := har.Log.Entries[i].Request
+		if !strings.Contains(req.URL, "sora.chatgpt.com/backend") {
+			continue
+		}
+		headers := map[string]string{}
+		for _, h := range req.Headers {
+			name := strings.ToLower(h.Name)
+			if strings.HasPrefix(name, ":") { // HTTP/2 pseudo header
+				continue
+			}
+			headers[name] = h.Value
+		}
+		if headers["authorization"] == "" {
+			continue
+		}
+		if headers["cookie"] == "" && len(req.Cookies) > 0 {
+			var parts []string
+			for _, c := range req.Cookies {
+				parts = append(parts, c.Name+"="+c.Value)
+			}
+			headers["cookie"] = strings.Join(parts, "; ")
+		}
+		return headers, req.URL, nil
+	}
+	return nil, "", fmt.Errorf("HAR 中找不到帶 authorization 的 sora.chatgpt.com/backend 請求")
+}
+
+// ---------- fetch() ----------
+
+var fetchRe = regexp.MustCompile(`(?s)fetch\(\s*"([^"]*)"\s*,\s*(\{.*\})\s*\)\s*;?\s*$`)
+
+// parseFetchHeaders 解析 DevTools「Copy as fetch」：第二個參數為合法 JSON 物件
+func parseFetchHeaders(content string) (map[string]string, string, error) {
+	m := fetchRe.FindStringSubmatch(content)
+	if len(m) < 3 {
+		return nil, "", fmt.Errorf("fetch() 格式無法解析")
+	}
+	var opts struct {
+		Headers map[string]string `json:"headers"`
+	}
+	if err := json.Unmarshal([]byte(m[2]), &opts); err != nil {
+		return nil, "", fmt.Errorf("fetch() 參數不是合法 JSON: %w", err)
+	}
+	headers := map[string]string{}
+	for k, v := range opts.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	return headers, m[1], nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// Sora Session 到期追蹤 (v31)
+// ==========================================
+
+// 到期前多久開始警告
+const soraExpiryWarnBefore = 24 * time.Hour
+
+// errSoraSessionDead 表示 Sora session 已失效 (過期或 401)，需重新貼上憑證
+var errSoraSessionDead = errors.New("Sora 憑證已失效，請重新貼上 cURL")
+
+// SoraTokenClaims 為 bearer token (JWT) 中我們關心的欄位
+type SoraTokenClaims struct {
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	UserID    string
+	Audience  []string
+}
+
+// SoraSessionStatus 為 /api/sora/session 的回應
+type SoraSessionStatus struct {
+	Account          string   `json:"account,omitempty"`
+	LoggedIn         bool     `json:"logged_in"`
+	State            string   `json:"state"` // ok / expiring / expired / dead / unknown / missing
+	ExpiresAt        string   `json:"expires_at,omitempty"`
+	ExpiresInSeconds int64    `json:"expires_in_seconds,omitempty"`
+	UserID           string   `json:"user_id,omitempty"`
+	Audience         []string `json:"audience,omitempty"`
+	Message          string   `json:"message"`
+	// Accounts 只出現在彙整狀態中，列出每個帳號各自的狀態
+	Accounts []SoraSessionStatus `json:"accounts,omitempty"`
+}
+
+var soraExpiryWatcher sync.Once
+
+// decodeSoraToken 解析 JWT payload (不驗證簽章，只用來讀取到期時間等資訊)
+func decodeSoraToken(bearer string) (*SoraTokenClaims, error) {
+	token := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(bearer), "Bearer "))
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token 不是 JWT 格式")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("JWT payload 解碼失敗: %w", err)
+	}
+	var raw struct {
+		Exp  int64           `json:"exp"`
+		Iat  int64           `json:"iat"`
+		Sub  string          `json:"sub"`
+		Aud  json.RawMessage `json:"aud"`
+		Auth struct {
+			UserID string `json:"user_id"`
+		} `json:"https://api.openai.com/auth"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("JWT payload 格式錯誤: %w", err)
+	}
+	claims := &SoraTokenClaims{UserID: raw.Auth.UserID}
+	if claims.UserID == "" {
+		claims.UserID = raw.Sub
+	}
+	if raw.Exp > 0 {
+		claims.ExpiresAt = time.Unix(raw.Exp, 0)
+	}
+	if raw.Iat > 0 {
+		claims.IssuedAt = time.Unix(raw.Iat, 0)
+	}
+	// aud 可能是字串或字串陣列
+	var single string
+	if json.Unmarshal(raw.Aud, &single) == nil && single != "" {
+		claims.Audience = []string{single}
+	} else {
+		json.Unmarshal(raw.Aud, &claims.Audience)
+	}
+	return claims, nil
+}
+
+// markDead 標記帳號 session 失效，暫停該帳號的 Sora 請求直到重新貼上憑證
+func (p *soraAccountPool) markDead(account, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.dead[account] == "" {
+		fmt.Printf("⛔ Sora 帳號 %s session 已失效: %s (請在網頁重新貼上 cURL)\n", account, reason)
+	}
+	p.dead[account] = reason
+}
+
+// resetSession 於更新憑證後清除該帳號的失效與警告狀態
+func (p *soraAccountPool) resetSession(account string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.dead, account)
+	delete(p.warned, account)
+}
+
+func (p *soraAccountPool) deadReason(account string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dead[account]
+}
+
+// check 在送出請求前檢查帳號 session 是否可用
+func (p *soraAccountPool) check(acc SoraAccount) error {
+	if reason := p.deadReason(acc.Name); reason != "" {
+		return fmt.Errorf("%w (%s)", errSoraSessionDead, reason)
+	}
+	if acc.Creds == nil {
+		return fmt.Errorf("未登入")
+	}
+	if claims, err := decodeSoraToken(acc.Creds.BearerToken); err == nil && !claims.ExpiresAt.IsZero() && time.Now().After(claims.ExpiresAt) {
+		p.markDead(acc.Name, "token 已於 "+claims.ExpiresAt.In(p.location()).Format("2006-01-02 15:04")+" 過期")
+		return errSoraSessionDead
+	}
+	return nil
+}
+
+func (p *soraAccountPool) sessionStatus(acc SoraAccount) SoraSessionStatus {
+	if acc.Creds == nil {
+		return SoraSessionStatus{Account: acc.Name, State: "missing", Message: "尚未設定 Sora 憑證，請貼上 cURL"}
+	}
+	st := SoraSessionStatus{Account: acc.Name, LoggedIn: true, State: "unknown", Message: "無法解析 token 到期時間"}
+	claims, err := decodeSoraToken(acc.Creds.BearerToken)
+	if err == nil {
+		st.UserID = claims.UserID
+		st.Audience = claims.Audience
+		if !claims.ExpiresAt.IsZero() {
+			left := time.Until(claims.ExpiresAt)
+			st.ExpiresAt = claims.ExpiresAt.In(p.location()).Format("2006-01-02 15:04")
+			st.ExpiresInSeconds = int64(left.Seconds())
+			switch {
+			case left <= 0:
+				st.State, st.Message = "expired", "Sora token 已過期，請重新貼上 cURL"
+			case left < soraExpiryWarnBefore:
+				st.State, st.Message = "expiring", fmt.Sprintf("Sora token 將在 %s 後過期", left.Round(time.Minute))
+			default:
+				st.State, st.Message = "ok", "Sora 憑證有效"
+			}
+		}
+	}
+	if reason := p.deadReason(acc.Name); reason != "" {
+		st.State, st.Message = "dead", "Sora 憑證已失效 ("+reason+")，請重新貼上 cURL"
+	}
+	return st
+}
+
+// overallStatus 彙整所有帳號：只要還有一個帳號可用就不算失效
+func (p *soraAccountPool) overallStatus() SoraSessionStatus {
+	accounts := p.snapshot()
+	if len(accounts) == 0 {
+		return SoraSessionStatus{State: "missing", Message: "尚未設定 Sora 憑證，請貼上 cURL"}
+	}
+	var overall *SoraSessionStatus
+	var all []SoraSessionStatus
+	for _, acc := range accounts {
+		st := p.sessionStatus(acc)
+		all = append(all, st)
+		usable := !acc.Disabled && st.State != "dead" && st.State != "expired"
+		if overall == nil || (usable && (overall.State == "dead" || overall.State == "expired")) {
+			c := st
+			overall = &c
+		}
+	}
+	overall.Accounts = all
+	if overall.State == "dead" || overall.State == "expired" {
+		overall.Message = "所有 Sora 帳號皆已失效，請重新貼上 cURL"
+	}
+	return *overall
+}
+
+// handleSoraSession 回傳目前 Sora session 狀態
+func (st *AppState) handleSoraSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st.sora.overallStatus())
+}
+
+// startSoraExpiryWatcher 每 10 分鐘檢查一次，每個帳號到期前在 console 提醒一次
+func (st *AppState) startSoraExpiryWatcher() {
+	p := st.sora
+	soraExpiryWatcher.Do(func() {
+		go func() {
+			for {
+				for _, acc := range p.snapshot() {
+					status := p.sessionStatus(acc)
+					p.mu.Lock()
+					warn := (status.State == "expiring" || status.State == "expired") && !p.warned[acc.Name]
+					if warn {
+						p.warned[acc.Name] = true
+					}
+					p.mu.Unlock()
+					if warn {
+						fmt.Printf("⏰ [%s] %s (到期時間: %s)\n", acc.Name, status.Message, status.ExpiresAt)
+					}
+				}
+				time.Sleep(10 * time.Minute)
+			}
+		}()
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJWT 以 payload 組出未簽章的 JWT
+func testJWT(payload string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return "Bearer " + enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte(payload)) + ".sig"
+}
+
+func TestDecodeSoraToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		bearer  string
+		want    *SoraTokenClaims
+		wantErr string
+	}{
+		{"完整欄位", testJWT(`{"exp":1767225600,"iat":1767139200,"sub":"auth0|x","aud":"https://api.openai.com/v1","https://api.openai.com/auth":{"user_id":"user-1"}}`),
+			&SoraTokenClaims{ExpiresAt: time.Unix(1767225600, 0), IssuedAt: time.Unix(1767139200, 0), UserID: "user-1", Audience: []string{"https://api.openai.com/v1"}}, ""},
+		{"aud 陣列且以 sub 為使用者", testJWT(`{"sub":"auth0|x","aud":["a","b"]}`),
+			&SoraTokenClaims{UserID: "auth0|x", Audience: []string{"a", "b"}}, ""},
+		{"payload 帶 = 補位", "Bearer h." + base64.URLEncoding.EncodeToString([]byte(`{"exp":1}`)) + ".s",
+			&SoraTokenClaims{ExpiresAt: time.Unix(1, 0)}, ""},
+		{"不是 JWT", "Bearer opaque-token", nil, "不是 JWT"},
+		{"payload 不是 base64", "Bearer a.!!!.c", nil, "解碼失敗"},
+		{"payload 不是 JSON", "Bearer a." + base64.RawURLEncoding.EncodeToString([]byte("nope")) + ".c", nil, "格式錯誤"},
+	}
+	for _, tt := range tests {
+		got, err := decodeSoraToken(tt.bearer)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: 應回傳含 %q 的錯誤，實際為 %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v (%v)\nwant %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestSoraSessionExpiry(t *testing.T) {
+	now := time.Now()
+	exp := func(d time.Duration) string {
+		return testJWT(`{"exp":` + strconv.FormatInt(now.Add(d).Unix(), 10) + `}`)
+	}
+	tests := []struct {
+		name   string
+		bearer string
+		state  string
+		dead   bool
+	}{
+		{"已過期", exp(-time.Minute), "dead", true},
+		{"即將到期", exp(time.Hour), "expiring", false},
+		{"仍有效", exp(72 * time.Hour), "ok", false},
+		{"無法解析", "Bearer opaque-token", "unknown", false},
+		{"沒有 exp", testJWT(`{"sub":"x"}`), "unknown", false},
+	}
+	for _, tt := range tests {
+		p := newSoraAccountPool("")
+		p.upsert("acc", &SoraCredentials{BearerToken: tt.bearer})
+		acc, _ := p.get("acc")
+		err := p.check(acc)
+		if errors.Is(err, errSoraSessionDead) != tt.dead || (!tt.dead && err != nil) {
+			t.Errorf("%s: check 回傳 %v", tt.name, err)
+		}
+		if got := p.sessionStatus(acc).State; got != tt.state {
+			t.Errorf("%s: 狀態應為 %s，實際為 %s", tt.name, tt.state, got)
+		}
+		// 過期的帳號不再被挑選，其餘照常可用
+		if _, err := p.pick(); (err != nil) != tt.dead {
+			t.Errorf("%s: pick 回傳 %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ==========================================
+// 執行期共用狀態 (v31)
+// ==========================================
+
+// AppState 集中保存會被多個 handler 並行讀寫的狀態。
+// 設定以不可變快照 (RuntimeConfig) 存放在 atomic.Pointer，更新時建立新快照整份替換；
+// Sora 帳號與 session 狀態由 soraAccountPool 自行加鎖。
+type AppState struct {
+	config  atomic.Pointer[RuntimeConfig]
+	roles   atomic.Pointer[[]RoleProfile]
+	sora    *soraAccountPool
+	stories *storyLibrary
+	client  *http.Client // 呼叫 Sora API 用，測試時可替換 Transport
+}
+
+// RuntimeConfig 為 env.json 補齊預設值並載入時區後的快照，建立後不可修改
+type RuntimeConfig struct {
+	GlobalConfig
+	Loc      *time.Location
+	LoadedAt time.Time
+	channels []*ChannelProfile // 至少一個，第一個為主頻道
+}
+
+// app 為伺服器使用的狀態，handler 皆掛在它上面
+var app = newAppState(SoraAccountsFile, StoryLibraryFile)
+
+// newAppState 建立狀態物件；accountsFile / storiesFile 為空時 Sora 帳號 / 故事庫只存在記憶體
+func newAppState(accountsFile, storiesFile string) *AppState {
+	st := &AppState{
+		sora:    newSoraAccountPool(accountsFile),
+		stories: newStoryLibrary(storiesFile),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	rc, err := buildRuntimeConfig(defaultGlobalConfig())
+	if err != nil {
+		panic(err)
+	}
+	st.config.Store(rc)
+	st.sora.loc = func() *time.Location { return st.Config().Loc }
+	return st
+}
+
+func defaultGlobalConfig() GlobalConfig {
+	return GlobalConfig{
+		ScheduleSlots: []string{"00:00", "08:00", "12:00", "16:00"},
+		Timezone:      "Asia/Taipei",
+		ArchiveFolder: "_uploaded_videos",
+		Port:          9999,
+		Listen:        "127.0.0.1",
+		LLM:           LLMConfig{PromptDir: "prompts"},
+	}
+}
+
+// Config 回傳目前的設定快照，呼叫端在單次操作中應重複使用同一份快照
+func (st *AppState) Config() *RuntimeConfig {
+	return st.config.Load()
+}
+
+// SetConfig 驗證並建立新快照後一次替換；失敗時保留舊設定
+func (st *AppState) SetConfig(g GlobalConfig) (*RuntimeConfig, error) {
+	rc, err := buildRuntimeConfig(g)
+	if err != nil {
+		return nil, err
+	}
+	st.config.Store(rc)
+	return rc, nil
+}
+
+// buildRuntimeConfig 補齊預設值、驗證後載入時區與各頻道設定；不修改傳入的 g
+func buildRuntimeConfig(g GlobalConfig) (*RuntimeConfig, error) {
+	g = g.withDefaults()
+	if err := validateGlobalConfig(g); err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(g.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Timezone %q 無效: %w", g.Timezone, err)
+	}
+	channels, err := buildChannels(&g, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &RuntimeConfig{GlobalConfig: g, Loc: loc, LoadedAt: time.Now(), channels: channels}, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rewriteTransport 將所有 Sora API 請求導向測試伺服器
+type rewriteTransport struct{ target *url.URL }
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme, r.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newTestState(t *testing.T, handler http.HandlerFunc) *AppState {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	st := newAppState("", "")
+	st.client = &http.Client{Transport: rewriteTransport{target}, Timeout: 5 * time.Second}
+	return st
+}
+
+func TestConcurrentCredentialUpdatesDuringPoll(t *testing.T) {
+	var seen sync.Map
+	st := newTestState(t, func(w http.ResponseWriter, r *http.Request) {
+		seen.Store(r.Header.Get("Authorization"), true)
+		if strings.HasSuffix(r.URL.Path, "/pending") {
+			w.Write([]byte(`[{"id":"task_1"}]`))
+			return
+		}
+		w.Write([]byte(`{"items":[]}`))
+	})
+	st.sora.upsert("a", &SoraCredentials{BearerToken: "Bearer tok-0", UserAgent: DefaultUserAgent})
+
+	const updates = 20
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				rec := httptest.NewRecorder()
+				st.handleSoraPoll(rec, httptest.NewRequest("GET", "/api/sora/poll?task_id=task_1&account=a", nil))
+				if !strings.Contains(rec.Body.String(), `"running"`) {
+					t.Errorf("poll 回應異常: %s", rec.Body.String())
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 1; j <= updates; j++ {
+			form := url.Values{
+				"curl":          {fmt.Sprintf("curl 'https://sora.chatgpt.com/backend/nf/pending' -H 'authorization: Bearer tok-%d'", j)},
+				"account":       {"a"},
+				"skip_validate": {"1"},
+			}
+			req := httptest.NewRequest("POST", "/api/auth/manual", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			st.handleManualAuth(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("更新憑證失敗: %d %s", rec.Code, rec.Body.String())
+				return
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 20; j++ {
+			st.sora.overallStatus()
+			st.handleSoraAccounts(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/sora/accounts", nil))
+		}
+	}()
+	wg.Wait()
+
+	acc, ok := st.sora.get("a")
+	if !ok || acc.Creds.BearerToken != fmt.Sprintf("Bearer tok-%d", updates) {
+		t.Fatalf("最後的憑證應為 tok-%d，實際為 %+v", updates, acc.Creds)
+	}
+	valid := regexp.MustCompile(`^Bearer tok-\d+$`)
+	seen.Range(func(k, _ interface{}) bool {
+		if !valid.MatchString(k.(string)) {
+			t.Errorf("送出了不完整的 Authorization: %q", k)
+		}
+		return true
+	})
+}
+
+func TestSendSoraRequestWithoutCredentials(t *testing.T) {
+	st := newAppState("", "")
+	if _, err := st.sendSoraRequest(SoraAccount{Name: "empty"}, "GET", SoraPendingEndpoint, nil); err == nil {
+		t.Fatal("沒有憑證時應回傳錯誤")
+	}
+	rec := httptest.NewRecorder()
+	st.handleSoraPoll(rec, httptest.NewRequest("GET", "/api/sora/poll?task_id=x", nil))
+	if !strings.Contains(rec.Body.String(), "未登入") {
+		t.Fatalf("未登入時 poll 應回傳錯誤，實際為 %s", rec.Body.String())
+	}
+}
+
+func TestConfigSwapDuringScheduling(t *testing.T) {
+	st := newAppState("", "")
+	morning, evening := defaultGlobalConfig(), defaultGlobalConfig()
+	morning.ScheduleSlots = []string{"08:00"}
+	evening.ScheduleSlots = []string{"20:00"}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			cfg := morning
+			if i%2 == 1 {
+				cfg = evening
+			}
+			if _, err := st.SetConfig(cfg); err != nil {
+				t.Errorf("SetConfig: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				rc := st.Config()
+				base := time.Date(2025, 1, 1, 0, 30, 0, 0, rc.Loc)
+				next := rc.resolveChannel("").nextSlot(base)
+				if h := next.In(rc.Loc).Hour(); h != 8 && h != 20 {
+					t.Errorf("排程時段 %v 不屬於任何一份設定", next)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	before := st.Config()
+	bad := defaultGlobalConfig()
+	bad.Timezone = "Mars/Olympus_Mons"
+	if _, err := st.SetConfig(bad); err == nil {
+		t.Fatal("無效時區應回傳錯誤")
+	}
+	if st.Config() != before {
+		t.Fatal("設定驗證失敗時不應替換快照")
+	}
+}
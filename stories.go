@@ -0,0 +1,521 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"SoraYT_Studio/filelock"
+	"SoraYT_Studio/storygen"
+)
+
+// ==========================================
+// 故事庫 (v31)
+// ==========================================
+
+// StoryLibraryFile 保存所有 AI 生成的故事；story.json 只放目前要送進 Sora 流水線的那一個
+const StoryLibraryFile = "stories.json"
+
+// 故事狀態：生成後為 draft，採用後為 queued，送出 Sora 任務後為 used
+const (
+	StoryDraft    = "draft"
+	StoryQueued   = "queued"
+	StoryUsed     = "used"
+	StoryRejected = "rejected"
+)
+
+var storyStatuses = []string{StoryDraft, StoryQueued, StoryUsed, StoryRejected}
+
+func validStoryStatus(s string) bool {
+	for _, v := range storyStatuses {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// StoryRecord 為故事庫中的一筆故事
+type StoryRecord struct {
+	ID        string       `json:"id"` // 與 metadata.unique_id 相同
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at,omitempty"`
+	Provider  string       `json:"provider"` // LLM 提供者名稱；手動新增為 manual
+	Template  string       `json:"template,omitempty"`
+	Batch     string       `json:"batch,omitempty"` // 同一次生成的候選共用，單一故事為空
+	Status    string       `json:"status"`
+	Story     StoryContent `json:"story"`
+}
+
+// StoryFilter 為故事庫的搜尋條件，空白欄位不篩選
+type StoryFilter struct {
+	Query  string // 比對標題、標籤、主題與 ID (不分大小寫)
+	Status string
+	Batch  string
+}
+
+func (f StoryFilter) match(rec StoryRecord) bool {
+	if f.Status != "" && rec.Status != f.Status {
+		return false
+	}
+	if f.Batch != "" && rec.Batch != f.Batch {
+		return false
+	}
+	q := strings.ToLower(strings.TrimSpace(f.Query))
+	if q == "" {
+		return true
+	}
+	m := rec.Story.Metadata
+	if strings.Contains(strings.ToLower(m.Title), q) || strings.Contains(strings.ToLower(m.Topic), q) || strings.Contains(strings.ToLower(rec.ID), q) {
+		return true
+	}
+	for _, tag := range m.Tags {
+		if strings.Contains(strings.ToLower(strings.TrimPrefix(tag, "#")), strings.TrimPrefix(q, "#")) {
+			return true
+		}
+	}
+	return false
+}
+
+// storyLibrary 管理故事庫；對外一律回傳複本
+type storyLibrary struct {
+	file string // 存檔路徑，空字串代表只存在記憶體
+
+	mu      sync.Mutex
+	records []StoryRecord
+	modTime time.Time // 最後一次讀寫時檔案的修改時間與大小，用來偵測其他行程的修改
+	size    int64
+}
+
+func newStoryLibrary(file string) *storyLibrary {
+	return &storyLibrary{file: file}
+}
+
+// load 讀取故事庫檔案
+func (l *storyLibrary) load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.readLocked()
+}
+
+// readLocked 讀取故事庫檔案；檔案不存在時為空，舊資料沒有狀態時視為 draft
+func (l *storyLibrary) readLocked() error {
+	if l.file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(l.file)
+	if os.IsNotExist(err) {
+		l.records, l.modTime, l.size = nil, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []StoryRecord
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s 格式錯誤: %w", l.file, err)
+	}
+	for i := range list {
+		if list[i].Status == "" {
+			list[i].Status = StoryDraft
+		}
+	}
+	l.records = list
+	l.stampLocked()
+	return nil
+}
+
+// stampLocked 記下目前檔案的修改時間與大小
+func (l *storyLibrary) stampLocked() {
+	if info, err := os.Stat(l.file); err == nil {
+		l.modTime, l.size = info.ModTime(), info.Size()
+	}
+}
+
+// refreshLocked 檔案被其他行程 (例如 CLI) 修改過時重新讀取；讀取失敗時保留記憶體中的內容
+func (l *storyLibrary) refreshLocked() {
+	if l.file == "" {
+		return
+	}
+	info, err := os.Stat(l.file)
+	if err != nil || (info.ModTime().Equal(l.modTime) && info.Size() == l.size) {
+		return
+	}
+	if err := l.readLocked(); err != nil {
+		fmt.Printf("⚠️ 無法重新讀取故事庫: %v\n", err)
+	}
+}
+
+// mutate 在檔案鎖內重新讀取最新內容後執行 fn 並存檔，避免覆蓋 serve 與 CLI 彼此的修改；
+// fn 回傳錯誤或存檔失敗時不修改故事庫
+func (l *storyLibrary) mutate(fn func() error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != "" {
+		unlock, err := filelock.Lock(l.file)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if err := l.readLocked(); err != nil {
+			return err
+		}
+	}
+	old := append([]StoryRecord(nil), l.records...)
+	if err := fn(); err != nil {
+		l.records = old
+		return err
+	}
+	if err := l.saveLocked(); err != nil {
+		l.records = old
+		return err
+	}
+	return nil
+}
+
+// add 新增故事並存檔 (未指定狀態時為 draft)；ID 重複時回傳錯誤且不修改故事庫
+func (l *storyLibrary) add(recs ...StoryRecord) error {
+	return l.mutate(func() error {
+		for i := range recs {
+			if recs[i].ID == "" {
+				return fmt.Errorf("故事缺少 ID")
+			}
+			if l.indexLocked(recs[i].ID) >= 0 {
+				return fmt.Errorf("故事 ID 重複: %s", recs[i].ID)
+			}
+			if recs[i].Status == "" {
+				recs[i].Status = StoryDraft
+			}
+			if recs[i].UpdatedAt.IsZero() {
+				recs[i].UpdatedAt = recs[i].CreatedAt
+			}
+		}
+		l.records = append(l.records, recs...)
+		return nil
+	})
+}
+
+// freeID 回傳故事庫中尚未使用的 storygen.NewID (同一秒已有故事或候選批次時往後順延)
+func (l *storyLibrary) freeID(now time.Time) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refreshLocked()
+	for {
+		id := storygen.NewID(now)
+		taken := false
+		for _, rec := range l.records {
+			if rec.ID == id || rec.Batch == id {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return id
+		}
+		now = now.Add(time.Second)
+	}
+}
+
+// get 依 ID 取得故事
+func (l *storyLibrary) get(id string) (StoryRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refreshLocked()
+	if i := l.indexLocked(id); i >= 0 {
+		return l.records[i], true
+	}
+	return StoryRecord{}, false
+}
+
+// update 以 fn 修改故事的複本，fn 回傳錯誤時不修改；成功後更新 UpdatedAt 並存檔
+func (l *storyLibrary) update(id string, fn func(*StoryRecord) error) (StoryRecord, error) {
+	var rec StoryRecord
+	err := l.mutate(func() error {
+		i := l.indexLocked(id)
+		if i < 0 {
+			return fmt.Errorf("找不到故事 %s", id)
+		}
+		rec = l.records[i]
+		rec.Story.Metadata.Tags = append([]string(nil), rec.Story.Metadata.Tags...)
+		if err := fn(&rec); err != nil {
+			return err
+		}
+		rec.UpdatedAt = time.Now()
+		l.records[i] = rec
+		return nil
+	})
+	if err != nil {
+		return StoryRecord{}, err
+	}
+	return rec, nil
+}
+
+// setStatus 更新故事狀態
+func (l *storyLibrary) setStatus(id, status string) (StoryRecord, error) {
+	return l.update(id, func(rec *StoryRecord) error {
+		rec.Status = status
+		return nil
+	})
+}
+
+// remove 刪除故事並存檔
+func (l *storyLibrary) remove(id string) error {
+	return l.mutate(func() error {
+		i := l.indexLocked(id)
+		if i < 0 {
+			return fmt.Errorf("找不到故事 %s", id)
+		}
+		l.records = append(l.records[:i:i], l.records[i+1:]...)
+		return nil
+	})
+}
+
+// list 依建立時間由新到舊回傳符合條件的故事
+func (l *storyLibrary) list(f StoryFilter) []StoryRecord {
+	l.mu.Lock()
+	l.refreshLocked()
+	list := []StoryRecord{}
+	for _, rec := range l.records {
+		if f.match(rec) {
+			list = append(list, rec)
+		}
+	}
+	l.mu.Unlock()
+	sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+func (l *storyLibrary) indexLocked(id string) int {
+	for i := range l.records {
+		if l.records[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *storyLibrary) saveLocked() error {
+	if l.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(l.file, data, 0644); err != nil {
+		return err
+	}
+	l.stampLocked()
+	return nil
+}
+
+// importStoryFile 將故事庫中沒有的 story.json (舊版流程或手動編輯) 加入故事庫，狀態為 queued
+func (st *AppState) importStoryFile() {
+	data, err := os.ReadFile(StoryFile)
+	if err != nil {
+		return
+	}
+	story, err := storygen.Parse(string(data), storygen.Request{})
+	if err != nil {
+		return
+	}
+	if _, ok := st.stories.get(story.Metadata.UniqueID); ok {
+		return
+	}
+	created := time.Now()
+	if info, err := os.Stat(StoryFile); err == nil {
+		created = info.ModTime()
+	}
+	rec := StoryRecord{ID: story.Metadata.UniqueID, CreatedAt: created, Provider: StoryFile, Status: StoryQueued, Story: *storyContentFrom(story)}
+	if err := st.stories.add(rec); err != nil {
+		fmt.Printf("⚠️ 無法將 %s 加入故事庫: %v\n", StoryFile, err)
+		return
+	}
+	fmt.Printf("📚 已將 %s 加入故事庫 (%s)\n", StoryFile, rec.ID)
+}
+
+// markStoryUsed 在送出 Sora 任務後，將提示詞中 ID 對應的故事標記為 used
+func (st *AppState) markStoryUsed(prompt string) {
+	id := storygen.IDPattern.FindString(prompt)
+	if id == "" {
+		return
+	}
+	if rec, ok := st.stories.get(id); !ok || rec.Status == StoryUsed {
+		return
+	}
+	if _, err := st.stories.setStatus(id, StoryUsed); err != nil {
+		fmt.Printf("⚠️ 無法更新故事狀態 %s: %v\n", id, err)
+	}
+}
+
+// promoteStory 將故事庫中的故事寫入 story.json，交給 Sora 流水線 (網頁的讀取按鈕與 CLI `create`) 使用
+func (st *AppState) promoteStory(id string) (StoryRecord, error) {
+	rec, ok := st.stories.get(id)
+	if !ok {
+		return StoryRecord{}, fmt.Errorf("找不到故事 %s", id)
+	}
+	if err := storyFromContent(rec.Story).WriteFile(StoryFile); err != nil {
+		return StoryRecord{}, fmt.Errorf("無法寫入 %s: %w", StoryFile, err)
+	}
+	if rec.Status != StoryUsed {
+		if updated, err := st.stories.setStatus(id, StoryQueued); err == nil {
+			rec = updated
+		}
+	}
+	fmt.Printf("✅ 已採用故事 %s (%s 已更新)\n", id, StoryFile)
+	return rec, nil
+}
+
+// handleStories GET 依 q / status / batch 搜尋故事庫；POST 以 JSON (StoryContent) 手動新增故事
+func (st *AppState) handleStories(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		// 與 /api/roles 一樣只接受同源 JSON，避免其他網站替使用者新增故事
+		if err := checkJSONRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var content StoryContent
+		if err := json.NewDecoder(r.Body).Decode(&content); err != nil {
+			http.Error(w, "JSON 格式錯誤: "+err.Error(), 400)
+			return
+		}
+		if content.Metadata.UniqueID == "" {
+			content.Metadata.UniqueID = st.stories.freeID(time.Now())
+		}
+		if role, ok := st.roleForPrompt(content.Prompt); ok {
+			role.applyDefaults(&content.Metadata)
+		}
+		if problems := validateStoryContent(content); len(problems) > 0 {
+			http.Error(w, "故事格式錯誤: "+strings.Join(problems, "; "), 400)
+			return
+		}
+		now := time.Now()
+		rec := StoryRecord{ID: content.Metadata.UniqueID, CreatedAt: now, UpdatedAt: now, Provider: "manual", Status: StoryDraft, Story: content}
+		if err := st.stories.add(rec); err != nil {
+			jsonError(w, err.Error())
+			return
+		}
+		fmt.Printf("📚 已新增故事 %s\n", rec.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rec)
+		return
+	}
+	q := r.URL.Query()
+	list := st.stories.list(StoryFilter{Query: q.Get("q"), Status: q.Get("status"), Batch: q.Get("batch")})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// StoryUpdate 為 PUT /api/stories/item 的內容，未提供的欄位不修改
+type StoryUpdate struct {
+	Status *string       `json:"status,omitempty"`
+	Story  *StoryContent `json:"story,omitempty"`
+}
+
+// handleStoryItem 以 id= 讀取 (GET)、修改 (PUT，JSON 為 StoryUpdate) 或刪除 (DELETE) 單一故事
+func (st *AppState) handleStoryItem(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	var rec StoryRecord
+	var err error
+	switch r.Method {
+	case "GET":
+		var ok bool
+		if rec, ok = st.stories.get(id); !ok {
+			http.Error(w, "找不到故事 "+id, 404)
+			return
+		}
+	case "PUT":
+		if err := checkJSONRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var req StoryUpdate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "JSON 格式錯誤: "+err.Error(), 400)
+			return
+		}
+		rec, err = st.stories.update(id, func(rec *StoryRecord) error { return applyStoryUpdate(rec, req) })
+	case "DELETE":
+		if err := checkSameOrigin(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err = st.stories.remove(id); err == nil {
+			fmt.Printf("🗑️ 已刪除故事 %s\n", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+			return
+		}
+	default:
+		http.Error(w, "405 Method Not Allowed", 405)
+		return
+	}
+	if err != nil {
+		jsonError(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// applyStoryUpdate 套用修改；狀態必須是已知值，故事內容需通過格式檢查且不可變更 unique_id
+func applyStoryUpdate(rec *StoryRecord, req StoryUpdate) error {
+	if req.Status != nil {
+		if !validStoryStatus(*req.Status) {
+			return fmt.Errorf("未知的狀態 %q (可用: %s)", *req.Status, strings.Join(storyStatuses, ", "))
+		}
+		rec.Status = *req.Status
+	}
+	if req.Story != nil {
+		if req.Story.Metadata.UniqueID != rec.ID {
+			return fmt.Errorf("不可變更 unique_id (%s)", rec.ID)
+		}
+		if problems := validateStoryContent(*req.Story); len(problems) > 0 {
+			return fmt.Errorf("故事格式錯誤: %s", strings.Join(problems, "; "))
+		}
+		rec.Story = *req.Story
+	}
+	return nil
+}
+
+// validateStoryContent 以 storygen 的規則檢查手動新增或修改的故事 (不檢查場景數)
+func validateStoryContent(c StoryContent) []string {
+	return storygen.Validate(storyFromContent(c), storygen.Request{})
+}
+
+// storyFromContent 將 StoryContent 轉回 storygen.Story (寫入 story.json 與驗證用)
+func storyFromContent(c StoryContent) *storygen.Story {
+	m := c.Metadata
+	return &storygen.Story{
+		Prompt: c.Prompt,
+		Metadata: storygen.Metadata{
+			UniqueID: m.UniqueID, FileName: m.FileName, Title: m.Title, Description: m.Description,
+			Tags: m.Tags, CategoryID: m.CategoryID, Privacy: m.Privacy, Topic: m.Topic, Channel: m.Channel,
+			DefaultLanguage: m.DefaultLanguage, Localizations: m.Localizations,
+		},
+	}
+}
+
+// handlePromoteStory 採用指定的故事 (POST id=)，回傳故事內容供前端填入
+func (st *AppState) handlePromoteStory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "405 Method Not Allowed", 405)
+		return
+	}
+	if err := checkSameOrigin(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	rec, err := st.promoteStory(r.FormValue("id"))
+	if err != nil {
+		jsonError(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
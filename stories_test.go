@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testStory(id, title string, tags ...string) StoryRecord {
+	return StoryRecord{
+		ID:        id,
+		CreatedAt: time.Now(),
+		Story: StoryContent{
+			Prompt:   "prompt " + id,
+			Metadata: VideoConfig{UniqueID: id, FileName: id + ".mp4", Title: title, Tags: tags},
+		},
+	}
+}
+
+func TestStoryLibraryCRUD(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "stories.json")
+	lib := newStoryLibrary(file)
+	a, b := testStory("S2_1", "Pancake Tower", "Cooking"), testStory("S2_2", "Snow Day", "Winter")
+	b.CreatedAt = a.CreatedAt.Add(time.Minute)
+	if err := lib.add(a, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.add(testStory("S2_1", "dup")); err == nil {
+		t.Fatal("重複的 ID 應回傳錯誤")
+	}
+
+	if list := lib.list(StoryFilter{}); len(list) != 2 || list[0].ID != "S2_2" || list[0].Status != StoryDraft {
+		t.Fatalf("應由新到舊列出且預設為 draft: %+v", list)
+	}
+	if list := lib.list(StoryFilter{Query: "#cook"}); len(list) != 1 || list[0].ID != "S2_1" {
+		t.Fatalf("標籤搜尋錯誤: %+v", list)
+	}
+	if list := lib.list(StoryFilter{Query: "snow"}); len(list) != 1 || list[0].ID != "S2_2" {
+		t.Fatalf("標題搜尋錯誤: %+v", list)
+	}
+
+	bad := "archived"
+	if _, err := lib.update("S2_1", func(rec *StoryRecord) error { return applyStoryUpdate(rec, StoryUpdate{Status: &bad}) }); err == nil {
+		t.Fatal("未知的狀態應被拒絕")
+	}
+	moved := a.Story
+	moved.Metadata.UniqueID = "S2_9"
+	if _, err := lib.update("S2_1", func(rec *StoryRecord) error { return applyStoryUpdate(rec, StoryUpdate{Story: &moved}) }); err == nil {
+		t.Fatal("不可變更 unique_id")
+	}
+	if _, err := lib.setStatus("S2_1", StoryRejected); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.remove("S2_2"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newStoryLibrary(file)
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	list := reloaded.list(StoryFilter{Status: StoryRejected})
+	if len(list) != 1 || list[0].ID != "S2_1" || len(reloaded.list(StoryFilter{})) != 1 {
+		t.Fatalf("重新載入後內容錯誤: %+v", reloaded.list(StoryFilter{}))
+	}
+}
+
+func TestStoryLibrarySharedFile(t *testing.T) {
+	// serve 與 CLI 各自持有一份故事庫，彼此的修改不可被覆蓋
+	file := filepath.Join(t.TempDir(), "stories.json")
+	serve, cli := newStoryLibrary(file), newStoryLibrary(file)
+	if err := serve.add(testStory("S1", "one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.add(testStory("S2", "two")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := serve.update("S1", func(r *StoryRecord) error { r.Status = StoryUsed; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	check := newStoryLibrary(file)
+	if err := check.load(); err != nil {
+		t.Fatal(err)
+	}
+	if rec, ok := check.get("S1"); !ok || rec.Status != StoryUsed {
+		t.Fatalf("serve 的修改遺失: %+v", rec)
+	}
+	if _, ok := check.get("S2"); !ok {
+		t.Fatal("CLI 新增的故事被 serve 覆蓋")
+	}
+	if _, ok := serve.get("S2"); !ok {
+		t.Fatal("讀取時應看到其他行程的修改")
+	}
+}
+
+func TestStoryEndpointsRequireSameOriginJSON(t *testing.T) {
+	t.Chdir(t.TempDir())
+	st := newAppState("", "")
+	if err := st.stories.add(testStory("S1", "one")); err != nil {
+		t.Fatal(err)
+	}
+	do := func(h http.HandlerFunc, method, target, body string, header map[string]string) int {
+		req := httptest.NewRequest(method, "http://localhost:9999"+target, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+	evil := map[string]string{"Content-Type": "application/json", "Origin": "http://evil.example"}
+	if code := do(st.handleStories, "POST", "/api/stories", `{"prompt":"x"}`, map[string]string{"Content-Type": "text/plain"}); code != 403 {
+		t.Fatalf("text/plain 新增應被拒絕: %d", code)
+	}
+	if code := do(st.handleStoryItem, "PUT", "/api/stories/item?id=S1", `{"status":"used"}`, evil); code != 403 {
+		t.Fatalf("跨來源修改應被拒絕: %d", code)
+	}
+	if code := do(st.handleStoryItem, "DELETE", "/api/stories/item?id=S1", "", evil); code != 403 {
+		t.Fatalf("跨來源刪除應被拒絕: %d", code)
+	}
+	if rec, ok := st.stories.get("S1"); !ok || rec.Status != StoryDraft {
+		t.Fatalf("被拒絕的請求不應修改故事: %+v", rec)
+	}
+	same := map[string]string{"Content-Type": "application/json", "Origin": "http://localhost:9999"}
+	if code := do(st.handleStoryItem, "PUT", "/api/stories/item?id=S1", `{"status":"used"}`, same); code != 200 {
+		t.Fatalf("同源 JSON 修改應成功: %d", code)
+	}
+}
@@ -0,0 +1,89 @@
+package storygen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Fixture 不呼叫任何 API，回傳固定的故事；用於測試與離線執行流水線。
+// 內容中的 {{ID}} 會替換成本次的 ID，因此每次產生的 unique_id / file_name 都不同。
+type Fixture struct {
+	File string // 空白時使用內建故事
+}
+
+// fixturePrompt 依 req 的場景數與長度產生符合時間軸格式的提示詞 (未指定時為單一 8 秒場景)
+func fixturePrompt(req Request) string {
+	v := PromptVars{SceneCount: req.SceneCount, Duration: req.Duration}
+	if v.SceneCount <= 0 {
+		v.SceneCount = 1
+	}
+	if v.Duration <= 0 {
+		v.Duration = 8
+	}
+	var b strings.Builder
+	b.WriteString("@jeremy202.whiskbunbu\n{{ID}} Pancake Tower Surprise\nA Sora2 Cinematic Style, Disney Pixar, 8k\nWith Camera Timeline + Music Cues\n🎬 English Version\n")
+	for _, sc := range scenes(v) {
+		fmt.Fprintf(&b, "\nScene %d — Breakfast Rush\n%s–%s — Wide Shot\n", sc.N, sc.Start, sc.End)
+		b.WriteString("Sir Whiskers flips pancakes higher and higher while Sunny Bun stacks them.\nMusic: Bouncy ukulele\nCamera: Slow push-in\n")
+	}
+	b.WriteString("\nEND — The tower wobbles, holds, and both cheer.")
+	return b.String()
+}
+
+// fixtureLocalizations 為每個要求的語言產生標示語言代碼的翻譯
+func fixtureLocalizations(req Request) string {
+	if len(req.Localizations) == 0 {
+		return ""
+	}
+	locs := map[string]Localization{}
+	for _, code := range req.Localizations {
+		locs[code] = Localization{
+			Title:       fmt.Sprintf("[%s] The Tallest Pancake Tower Ever! 🥞", code),
+			Description: fmt.Sprintf("[%s] Sir Whiskers and Sunny Bun attempt a record-breaking pancake tower.", code),
+			Tags:        []string{"Sora", code},
+		}
+	}
+	data, _ := json.Marshal(locs)
+	return `,
+    "localizations": ` + string(data)
+}
+
+const fixtureStory = `{
+  "prompt": "{{PROMPT}}",
+  "metadata": {
+    "unique_id": "{{ID}}",
+    "file_name": "{{ID}}_PancakeTower.mp4",
+    "title": "Sora AI: The Tallest Pancake Tower Ever! 🥞",
+    "description": "Sir Whiskers and Sunny Bun attempt a record-breaking pancake tower.",
+    "tags": ["Sora", "SoraAI", "Cute", "Cooking"],
+    "category_id": "24",
+    "privacy": "private"{{LOCALIZATIONS}}
+  }
+}`
+
+// Generate 回傳固定內容，結果只取決於 req 的 ID、場景數與長度
+func (f *Fixture) Generate(ctx context.Context, req Request) (*Story, error) {
+	prompt, _ := json.Marshal(fixturePrompt(req))
+	text := strings.Replace(fixtureStory, "{{PROMPT}}", strings.Trim(string(prompt), `"`), 1)
+	text = strings.Replace(text, "{{LOCALIZATIONS}}", fixtureLocalizations(req), 1)
+	if f.File != "" {
+		data, err := os.ReadFile(f.File)
+		if err != nil {
+			return nil, fmt.Errorf("無法讀取 fixture %s: %w", f.File, err)
+		}
+		text = string(data)
+	}
+	// ID 以 JSON 字串跳脫後再替換，避免特殊字元破壞格式
+	quoted, _ := json.Marshal(req.ID)
+	text = strings.ReplaceAll(text, "{{ID}}", strings.Trim(string(quoted), `"`))
+	// 模擬串流輸出，每行送出一段
+	if req.Progress != nil {
+		for _, line := range strings.SplitAfter(text, "\n") {
+			req.Emit(Event{Stage: StageDelta, Text: line})
+		}
+	}
+	return Parse(text, req)
+}
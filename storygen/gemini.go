@@ -0,0 +1,66 @@
+package storygen
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+const DefaultGeminiModel = "gemini-2.5-flash"
+
+// Gemini 以 Google Gemini API 產生故事
+type Gemini struct {
+	APIKey      string
+	Model       string  // 空白時使用 DefaultGeminiModel
+	Temperature float32 // 0 時使用 DefaultTemperature
+}
+
+// Generate 請求 Gemini 產生一個新故事
+func (g *Gemini) Generate(ctx context.Context, req Request) (*Story, error) {
+	if g.APIKey == "" {
+		return nil, ErrMissingAPIKey
+	}
+	client, err := genai.NewClient(ctx, option.WithAPIKey(g.APIKey))
+	if err != nil {
+		return nil, &APIError{Provider: "Gemini", Err: err}
+	}
+	defer client.Close()
+
+	modelName := g.Model
+	if modelName == "" {
+		modelName = DefaultGeminiModel
+	}
+	temperature := g.Temperature
+	if temperature == 0 {
+		temperature = DefaultTemperature
+	}
+	model := client.GenerativeModel(modelName)
+	model.SetTemperature(temperature)
+	model.ResponseMIMEType = "application/json"
+
+	// v31: 以串流 API 取得回應，每段文字即時送到 req.Progress
+	iter := model.GenerateContentStream(ctx, genai.Text(req.Prompt))
+	var text strings.Builder
+	for {
+		resp, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, &APIError{Provider: "Gemini", Err: err}
+		}
+		if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+			continue
+		}
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if txt, ok := part.(genai.Text); ok {
+				text.WriteString(string(txt))
+				req.Emit(Event{Stage: StageDelta, Text: string(txt)})
+			}
+		}
+	}
+	return Parse(text.String(), req)
+}
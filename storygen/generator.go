@@ -0,0 +1,97 @@
+package storygen
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultTemperature 為未指定 Temperature 時的取樣溫度
+const DefaultTemperature = 0.7
+
+// StoryGenerator 為各家 LLM 的共同介面
+type StoryGenerator interface {
+	Generate(ctx context.Context, req Request) (*Story, error)
+}
+
+// Request 為一次生成的輸入；ID 由程式決定並要求模型照抄。
+// SceneCount / Duration 為驗證提示詞時間軸的預期值，0 代表不檢查
+type Request struct {
+	ID            string
+	Prompt        string
+	SceneCount    int
+	Duration      int
+	Topic         string       // 本次使用的主題，呼叫端記錄到 Metadata.Topic
+	Language      string       // 主要語言代碼 (無法判斷時為空)
+	Localizations []string     // 必須提供翻譯的語言代碼
+	Progress      ProgressFunc // 接收生成進度 (可為 nil)；設定時提供者以串流方式呼叫模型
+}
+
+// NewRequest 以模板資料夾 dir 中的模板 name (空白為 default) 產生提示詞；
+// vars.ID 空白時以 now 產生
+func NewRequest(dir, name string, vars PromptVars, now time.Time) (Request, error) {
+	prompt, vars, err := RenderPrompt(dir, name, vars, now)
+	if err != nil {
+		return Request{}, err
+	}
+	return Request{ID: vars.ID, Prompt: prompt, SceneCount: vars.SceneCount, Duration: vars.Duration, Topic: vars.Topic,
+		Language: LanguageCode(vars.Language), Localizations: vars.Localizations}, nil
+}
+
+// 提供者類型 (ProviderConfig.Type)
+const (
+	TypeGemini  = "gemini"
+	TypeOpenAI  = "openai" // OpenAI 相容的 /chat/completions (Ollama、LM Studio、vLLM 等本機伺服器皆可)
+	TypeFixture = "fixture"
+)
+
+// ProviderConfig 為 env.json LLM.Providers 中的一個提供者
+type ProviderConfig struct {
+	Name        string  `json:"Name"`
+	Type        string  `json:"Type"`
+	Model       string  `json:"Model,omitempty"`
+	BaseURL     string  `json:"BaseURL,omitempty"`
+	ApiKey      string  `json:"ApiKey,omitempty"`
+	Temperature float32 `json:"Temperature,omitempty"`
+	FixtureFile string  `json:"FixtureFile,omitempty"` // fixture 類型：回傳此檔案的內容 (空白時使用內建故事)
+}
+
+// Validate 檢查設定是否足以建立提供者，回傳問題描述 (無問題時為空)
+func (p ProviderConfig) Validate() []string {
+	var problems []string
+	if strings.TrimSpace(p.Name) == "" {
+		problems = append(problems, "Name 不可為空")
+	}
+	switch p.Type {
+	case TypeGemini, TypeFixture:
+	case TypeOpenAI:
+		if p.BaseURL == "" {
+			problems = append(problems, "openai 類型需要 BaseURL (例如 http://localhost:11434/v1)")
+		}
+		if p.Model == "" {
+			problems = append(problems, "openai 類型需要 Model")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("Type %q 無效 (可用: %s、%s、%s)", p.Type, TypeGemini, TypeOpenAI, TypeFixture))
+	}
+	if p.Temperature < 0 || p.Temperature > 2 {
+		problems = append(problems, fmt.Sprintf("Temperature %.2f 超出範圍 (0-2)", p.Temperature))
+	}
+	return problems
+}
+
+// New 依設定建立提供者
+func New(p ProviderConfig) (StoryGenerator, error) {
+	if problems := p.Validate(); len(problems) > 0 {
+		return nil, fmt.Errorf("LLM 提供者 %q 設定錯誤: %s", p.Name, strings.Join(problems, "; "))
+	}
+	switch p.Type {
+	case TypeGemini:
+		return &Gemini{APIKey: p.ApiKey, Model: p.Model, Temperature: p.Temperature}, nil
+	case TypeOpenAI:
+		return &OpenAI{BaseURL: p.BaseURL, APIKey: p.ApiKey, Model: p.Model, Temperature: p.Temperature}, nil
+	default:
+		return &Fixture{File: p.FixtureFile}, nil
+	}
+}
@@ -0,0 +1,60 @@
+package storygen
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Localization 為單一語言的影片標題、說明與標籤 (對應 YouTube 的 localizations)
+type Localization struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// languageNames 為常用語言代碼在提示詞中使用的名稱
+var languageNames = map[string]string{
+	"en":    "English",
+	"zh-TW": "Traditional Chinese (Taiwan)",
+	"zh-CN": "Simplified Chinese",
+	"ja":    "Japanese",
+	"ko":    "Korean",
+	"es":    "Spanish",
+	"fr":    "French",
+	"de":    "German",
+	"pt":    "Portuguese",
+	"it":    "Italian",
+	"th":    "Thai",
+	"vi":    "Vietnamese",
+	"id":    "Indonesian",
+	"hi":    "Hindi",
+}
+
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ValidLanguageCode 判斷是否為 BCP-47 形式的語言代碼 (例如 en、ja、zh-TW)
+func ValidLanguageCode(code string) bool {
+	return languageCodePattern.MatchString(code)
+}
+
+// LanguageName 回傳語言代碼的英文名稱，未知的代碼原樣回傳
+func LanguageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// LanguageCode 由語言名稱 (例如 English) 或代碼取得代碼；無法判斷時回傳空字串
+func LanguageCode(s string) string {
+	s = strings.TrimSpace(s)
+	for code, name := range languageNames {
+		if strings.EqualFold(s, code) || strings.EqualFold(s, name) {
+			return code
+		}
+	}
+	if ValidLanguageCode(s) {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package storygen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAI 呼叫 OpenAI 相容的 Chat Completions API，可接本機模型伺服器
+type OpenAI struct {
+	BaseURL     string // 例如 https://api.openai.com/v1 或 http://localhost:11434/v1
+	APIKey      string // 本機伺服器通常不需要
+	Model       string
+	Temperature float32
+	Client      *http.Client // nil 時使用 http.DefaultClient (逾時由 ctx 控制)
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string            `json:"model"`
+	Messages       []chatMessage     `json:"messages"`
+	Temperature    float32           `json:"temperature"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+	Stream         bool              `json:"stream,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// chatStreamChunk 為 stream=true 時每個 data: 行的內容
+type chatStreamChunk struct {
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Generate 送出單一 user 訊息並要求 JSON 物件輸出；req.Progress 有設定時以串流方式接收
+func (o *OpenAI) Generate(ctx context.Context, req Request) (*Story, error) {
+	temperature := o.Temperature
+	if temperature == 0 {
+		temperature = DefaultTemperature
+	}
+	body, _ := json.Marshal(chatRequest{
+		Model:          o.Model,
+		Messages:       []chatMessage{{Role: "user", Content: req.Prompt}},
+		Temperature:    temperature,
+		ResponseFormat: map[string]string{"type": "json_object"},
+		Stream:         req.Progress != nil,
+	})
+
+	url := strings.TrimRight(o.BaseURL, "/") + "/chat/completions"
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, &APIError{Provider: "OpenAI", Err: err}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, &APIError{Provider: "OpenAI", Err: err}
+	}
+	defer resp.Body.Close()
+	// 伺服器不支援串流時會忽略 stream，照一般回應處理
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		text, err := readChatStream(resp.Body, req)
+		if err != nil {
+			return nil, &APIError{Provider: "OpenAI", Err: err}
+		}
+		return Parse(text, req)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+
+	var parsed chatResponse
+	jsonErr := json.Unmarshal(respBody, &parsed)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(respBody))
+		if jsonErr == nil && parsed.Error != nil {
+			msg = parsed.Error.Message
+		}
+		if len(msg) > 300 {
+			msg = msg[:300] + "..."
+		}
+		return nil, &APIError{Provider: "OpenAI", Err: fmt.Errorf("HTTP %d: %s", resp.StatusCode, msg)}
+	}
+	if jsonErr != nil {
+		return nil, &APIError{Provider: "OpenAI", Err: fmt.Errorf("回應格式錯誤: %w", jsonErr)}
+	}
+	if len(parsed.Choices) == 0 {
+		return nil, ErrEmptyResponse
+	}
+	return Parse(parsed.Choices[0].Message.Content, req)
+}
+
+// readChatStream 讀取 server-sent events 格式的串流回應，每段文字送到 req.Progress
+func readChatStream(r io.Reader, req Request) (string, error) {
+	var text strings.Builder
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk chatStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("串流格式錯誤: %w", err)
+		}
+		if chunk.Error != nil {
+			return "", errors.New(chunk.Error.Message)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			text.WriteString(chunk.Choices[0].Delta.Content)
+			req.Emit(Event{Stage: StageDelta, Text: chunk.Choices[0].Delta.Content})
+		}
+	}
+	return text.String(), sc.Err()
+}
@@ -0,0 +1,35 @@
+package storygen
+
+// 生成進度的階段 (Event.Stage)
+const (
+	StageStarted    = "started"    // 呼叫端準備好請求 (Text 為主題)
+	StageModelCall  = "model_call" // 開始呼叫模型，Attempt 為第幾次嘗試
+	StageDelta      = "delta"      // 模型串流輸出的一段文字 (Text)
+	StageValidating = "validating" // 輸出完畢，開始解析與檢查格式
+	StageRetry      = "retry"      // 格式不符，回饋 Problems 後重試
+	StageSaved      = "saved"      // 呼叫端已存檔
+	StageFailed     = "failed"     // 此請求失敗 (Text 為錯誤訊息)
+)
+
+// Event 為一筆生成進度；ID 為請求的 unique_id，同時生成多個候選時用來區分
+type Event struct {
+	Stage    string   `json:"stage"`
+	ID       string   `json:"id"`
+	Attempt  int      `json:"attempt,omitempty"`
+	Text     string   `json:"text,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// ProgressFunc 接收生成進度；同時生成多個候選時可能被並行呼叫
+type ProgressFunc func(Event)
+
+// Emit 送出 req 的進度 (未設定 Progress 時忽略)，ev.ID 空白時填入 req.ID
+func (req Request) Emit(ev Event) {
+	if req.Progress == nil {
+		return
+	}
+	if ev.ID == "" {
+		ev.ID = req.ID
+	}
+	req.Progress(ev)
+}
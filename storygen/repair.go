@@ -0,0 +1,81 @@
+package storygen
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxAttempts 為 GenerateWithRepair 未指定次數時的最多嘗試次數
+const DefaultMaxAttempts = 3
+
+// maxRepairEcho 為回饋給模型的上一次輸出長度上限
+const maxRepairEcho = 4000
+
+// GenerateWithRepair 呼叫 gen 產生故事；輸出無法解析或不符合格式時，
+// 把錯誤清單與上一次的輸出附加到提示詞後重試，最多 maxAttempts 次。
+// API 錯誤 (網路、額度、權限) 不會重試，直接回傳。
+func GenerateWithRepair(ctx context.Context, gen StoryGenerator, req Request, maxAttempts int) (*Story, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	attempt := req
+	var lastErr error
+	for i := 1; i <= maxAttempts; i++ {
+		req.Emit(Event{Stage: StageModelCall, Attempt: i})
+		story, err := gen.Generate(ctx, attempt)
+		if err == nil {
+			return story, nil
+		}
+		raw, problems, ok := repairable(err)
+		if !ok {
+			return nil, err
+		}
+		lastErr = err
+		if i == maxAttempts || ctx.Err() != nil {
+			break
+		}
+		req.Emit(Event{Stage: StageRetry, Attempt: i, Problems: problems})
+		attempt.Prompt = repairPrompt(req.Prompt, raw, problems)
+	}
+	return nil, lastErr
+}
+
+// repairable 判斷錯誤是否可以請模型修正，並取出原始輸出與錯誤清單
+func repairable(err error) (raw string, problems []string, ok bool) {
+	var parseErr *ParseError
+	var validErr *ValidationError
+	switch {
+	case errors.As(err, &validErr):
+		return validErr.Raw, validErr.Problems, true
+	case errors.As(err, &parseErr):
+		return parseErr.Raw, []string{"JSON 無法解析: " + parseErr.Err.Error()}, true
+	case errors.Is(err, ErrEmptyResponse):
+		return "", []string{"沒有輸出任何內容"}, true
+	}
+	return "", nil, false
+}
+
+// repairPrompt 在原本的提示詞後附上上一次的輸出與需要修正的問題
+func repairPrompt(prompt, raw string, problems []string) string {
+	if len(raw) > maxRepairEcho {
+		// 往前退到字元邊界，避免把多位元組的中文字切成一半
+		n := maxRepairEcho
+		for n > 0 && !utf8.RuneStart(raw[n]) {
+			n--
+		}
+		raw = raw[:n] + "..."
+	}
+	var b strings.Builder
+	b.WriteString(prompt)
+	b.WriteString("\n\n【Correction Required】\nYour previous answer was rejected for these reasons:\n")
+	for _, p := range problems {
+		b.WriteString("- " + p + "\n")
+	}
+	if raw != "" {
+		b.WriteString("\nPrevious answer:\n" + raw + "\n")
+	}
+	b.WriteString("\nFix every problem above and output ONLY the corrected Single JSON Object.")
+	return b.String()
+}
@@ -0,0 +1,114 @@
+// Package storygen 以 LLM 產生 Sora 影片故事 (提示詞 + YouTube metadata)。
+//
+// 伺服器與獨立的 gemini_gen.go 共用這裡的邏輯；結果以 Story 回傳，
+// 失敗時回傳可用 errors.Is / errors.As 判斷的錯誤。
+package storygen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Story 為 story.json 的內容
+type Story struct {
+	Prompt   string   `json:"prompt"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// Metadata 為上傳 YouTube 用的影片資訊，欄位名稱與 videos.json 相同
+type Metadata struct {
+	UniqueID    string   `json:"unique_id"`
+	FileName    string   `json:"file_name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	CategoryID  string   `json:"category_id"`
+	Privacy     string   `json:"privacy"`
+	Topic       string   `json:"topic,omitempty"`   // 生成時使用的主題，由程式填入
+	Channel     string   `json:"channel,omitempty"` // 目標頻道 ID，由角色預設值填入
+	// 主要語言代碼與其他語言的翻譯 (上傳時設定 YouTube 的 defaultLanguage 與 localizations)
+	DefaultLanguage string                  `json:"default_language,omitempty"`
+	Localizations   map[string]Localization `json:"localizations,omitempty"`
+}
+
+var (
+	// ErrMissingAPIKey 表示未設定 LLM.ApiKey
+	ErrMissingAPIKey = errors.New("未設定 LLM.ApiKey")
+	// ErrEmptyResponse 表示模型沒有回傳任何文字
+	ErrEmptyResponse = errors.New("沒有收到回應")
+)
+
+// APIError 表示呼叫 LLM 服務失敗 (網路、額度、權限等)
+type APIError struct {
+	Provider string
+	Err      error
+}
+
+func (e *APIError) Error() string { return fmt.Sprintf("%s 生成失敗: %v", e.Provider, e.Err) }
+func (e *APIError) Unwrap() error { return e.Err }
+
+// ParseError 表示模型回傳的內容無法解析成 Story，Raw 保留原始輸出以便除錯
+type ParseError struct {
+	Raw string
+	Err error
+}
+
+func (e *ParseError) Error() string { return fmt.Sprintf("AI 回傳的 JSON 格式錯誤: %v", e.Err) }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// NewID 產生影片唯一 ID，格式為 S2_YYYYMMDD_HH_MM_SS (由程式決定，不讓 AI 亂猜)
+func NewID(now time.Time) string {
+	return fmt.Sprintf("S2_%s_%s", now.Format("20060102"), now.Format("15_04_05"))
+}
+
+// IDPattern 從提示詞或 Sora mailbox 的文字中找出 NewID 產生的完整 ID (含多個候選時的 _vN 後綴)
+var IDPattern = regexp.MustCompile(`(S2_\d+(?:_\d+)+(?:_v\d+)?)`)
+
+// Parse 去除 Markdown code fence 後解析模型輸出，並以 Validate 檢查是否符合 req。
+// 模型回傳只有一個元素的陣列時取出該物件；其他格式問題回傳 *ParseError 或 *ValidationError
+func Parse(text string, req Request) (*Story, error) {
+	req.Emit(Event{Stage: StageValidating})
+	raw := strings.TrimSpace(text)
+	raw = strings.ReplaceAll(raw, "```json", "")
+	raw = strings.ReplaceAll(raw, "```", "")
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, ErrEmptyResponse
+	}
+
+	var s Story
+	if strings.HasPrefix(raw, "[") {
+		var list []Story
+		if err := json.Unmarshal([]byte(raw), &list); err != nil {
+			return nil, &ParseError{Raw: raw, Err: err}
+		}
+		if len(list) != 1 {
+			return nil, &ParseError{Raw: raw, Err: fmt.Errorf("必須是單一 JSON 物件，收到 %d 個元素的陣列", len(list))}
+		}
+		s = list[0]
+	} else if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return nil, &ParseError{Raw: raw, Err: err}
+	}
+	if problems := Validate(&s, req); len(problems) > 0 {
+		return nil, &ValidationError{Raw: raw, Problems: problems}
+	}
+	return &s, nil
+}
+
+// WriteFile 將故事存成 JSON (先寫暫存檔再改名，避免前端讀到寫一半的檔案)
+func (s *Story) WriteFile(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,265 @@
+package storygen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFixtureIsDeterministic(t *testing.T) {
+	req, err := NewRequest("", "", PromptVars{}, time.Date(2025, 11, 27, 14, 30, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ID != "S2_20251127_14_30_05" {
+		t.Fatalf("ID 格式錯誤: %s", req.ID)
+	}
+	a, err := (&Fixture{}).Generate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := (&Fixture{}).Generate(context.Background(), req)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("相同的 Request 應產生相同的故事")
+	}
+	if a.Metadata.UniqueID != req.ID || a.Metadata.FileName != req.ID+"_PancakeTower.mp4" {
+		t.Fatalf("fixture 應套用 ID: %+v", a.Metadata)
+	}
+}
+
+func TestOpenAICompatible(t *testing.T) {
+	var got chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("請求錯誤: %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		content := "```json\n[{\"prompt\":\"hello\",\"metadata\":{\"unique_id\":\"S2_X\",\"file_name\":\"S2_X.mp4\",\"title\":\"T\"}}]\n```"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+	defer srv.Close()
+
+	gen, err := New(ProviderConfig{Name: "local", Type: TypeOpenAI, BaseURL: srv.URL + "/v1/", Model: "llama3", ApiKey: "sk-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	story, err := gen.Generate(context.Background(), Request{ID: "S2_X", Prompt: "write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Model != "llama3" || got.Messages[0].Content != "write" || got.Temperature != DefaultTemperature {
+		t.Fatalf("送出的內容錯誤: %+v", got)
+	}
+	// 單一元素的陣列會自動取出
+	if story.Prompt != "hello" || story.Metadata.UniqueID != "S2_X" || story.Metadata.FileName != "S2_X.mp4" {
+		t.Fatalf("解析結果錯誤: %+v", story)
+	}
+}
+
+func TestOpenAIStreaming(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got chatRequest
+		json.NewDecoder(r.Body).Decode(&got)
+		if !got.Stream {
+			t.Error("設定 Progress 時應要求串流")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{`{\"prompt\":\"hi\",`, `\"metadata\":{\"unique_id\":\"S2_X\",\"file_name\":\"S2_X.mp4\",\"title\":\"T\"}}`} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"%s\"}}]}\n\n", part)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var stages []string
+	var text strings.Builder
+	req := Request{ID: "S2_X", Prompt: "write", Progress: func(ev Event) {
+		stages = append(stages, ev.Stage)
+		text.WriteString(ev.Text)
+	}}
+	story, err := GenerateWithRepair(context.Background(), &OpenAI{BaseURL: srv.URL, Model: "m"}, req, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{StageModelCall, StageDelta, StageDelta, StageValidating}
+	if !reflect.DeepEqual(stages, want) || story.Prompt != "hi" || !strings.HasPrefix(text.String(), `{"prompt":"hi",`) {
+		t.Fatalf("串流進度錯誤: %q %q", stages, text.String())
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 帶錯誤的 key 時回 401，否則回傳不是 JSON 的內容
+		if r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"invalid key"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"content": "not json"}}},
+		})
+	}))
+	defer srv.Close()
+
+	_, err := (&OpenAI{BaseURL: srv.URL, Model: "m", APIKey: "x"}).Generate(context.Background(), Request{ID: "a"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("HTTP 401 應回傳 APIError，實際為 %v", err)
+	}
+	_, err = (&OpenAI{BaseURL: srv.URL, Model: "m"}).Generate(context.Background(), Request{ID: "a"})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Raw != "not json" {
+		t.Fatalf("非 JSON 內容應回傳 ParseError，實際為 %v", err)
+	}
+}
+
+func TestGenerateWithRepair(t *testing.T) {
+	req, err := NewRequest("", "", PromptVars{SceneCount: 2, Duration: 10}, time.Date(2025, 11, 27, 14, 30, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := (&Fixture{}).Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("fixture 應通過驗證: %v", err)
+	}
+	wrongID := *good
+	wrongID.Metadata.UniqueID = "S2_19990101_00_00_00"
+	answers := []interface{}{"not json", wrongID, good}
+
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cr chatRequest
+		json.NewDecoder(r.Body).Decode(&cr)
+		prompts = append(prompts, cr.Messages[0].Content)
+		content, _ := answers[len(prompts)-1].(string)
+		if content == "" {
+			data, _ := json.Marshal(answers[len(prompts)-1])
+			content = string(data)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer srv.Close()
+	gen := &OpenAI{BaseURL: srv.URL, Model: "m"}
+
+	if _, err := GenerateWithRepair(context.Background(), gen, req, 2); err == nil {
+		t.Fatal("兩次都不符合格式時應回傳錯誤")
+	} else if !strings.Contains(err.Error(), "unique_id") {
+		t.Fatalf("最後的錯誤應指出 unique_id: %v", err)
+	}
+	if !strings.Contains(prompts[1], "【Correction Required】") || !strings.Contains(prompts[1], "not json") {
+		t.Fatalf("重試時應附上錯誤與上一次輸出: %q", prompts[1])
+	}
+
+	prompts = nil
+	story, err := GenerateWithRepair(context.Background(), gen, req, 3)
+	if err != nil || !reflect.DeepEqual(story, good) || len(prompts) != 3 {
+		t.Fatalf("第三次應成功: %v (%d 次)", err, len(prompts))
+	}
+
+	bad := &Story{Prompt: "Scene 1 — A\n00:00–00:20 — Wide\nScene 3 — B", Metadata: Metadata{UniqueID: req.ID, FileName: "x.mov", Privacy: "secret"}}
+	if problems := Validate(bad, req); len(problems) < 5 {
+		t.Fatalf("應找出檔名、標題、隱私、場景編號與時間軸問題: %q", problems)
+	}
+
+	// 截斷上一次輸出時不可切開多位元組字元
+	long := "x" + strings.Repeat("貓", maxRepairEcho)
+	if p := repairPrompt("p", long, []string{"too long"}); !utf8.ValidString(p) || !strings.Contains(p, "貓...") {
+		t.Fatal("截斷後應為合法的 UTF-8")
+	}
+}
+
+func TestTrendsSampling(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "trends.csv")
+	os.WriteFile(csvFile, []byte("keyword,weight\n# 註解\nSnow Day,3\nPumpkin Pie\nOld Meme,0\n"), 0644)
+	trends, err := LoadTrends(csvFile)
+	if err != nil || len(trends) != 2 || trends[0] != (Trend{"Snow Day", 3}) || trends[1].Weight != 1 {
+		t.Fatalf("CSV 解析錯誤: %+v %v", trends, err)
+	}
+	jsonFile := filepath.Join(dir, "trends.json")
+	os.WriteFile(jsonFile, []byte(`{"Snow Day": 2, "Pumpkin Pie": 1}`), 0644)
+	if trends, err := LoadTrends(jsonFile); err != nil || len(trends) != 2 {
+		t.Fatalf("JSON 解析錯誤: %+v %v", trends, err)
+	}
+
+	got := SampleTopics(trends, 3, rand.New(rand.NewPCG(1, 2)))
+	if len(got) != 3 || got[0] == got[1] {
+		t.Fatalf("前兩個應不重複，第三個重新抽一輪: %q", got)
+	}
+
+	prompt, _, err := RenderPrompt("", "", PromptVars{Topic: "Snow Day", Brief: "Make it about sledding."}, time.Now())
+	if err != nil || !strings.Contains(prompt, `about "Snow Day"`) || !strings.Contains(prompt, "Make it about sledding.") || strings.Contains(prompt, "trending topics") {
+		t.Fatalf("主題與簡介應出現在提示詞中: %v\n%s", err, prompt)
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	if _, err := New(ProviderConfig{Name: "x", Type: "claude"}); err == nil {
+		t.Fatal("未知的 Type 應回傳錯誤")
+	}
+	if _, err := New(ProviderConfig{Name: "x", Type: TypeOpenAI}); err == nil {
+		t.Fatal("openai 缺少 BaseURL / Model 應回傳錯誤")
+	}
+	if _, err := (&Gemini{}).Generate(context.Background(), Request{}); !errors.Is(err, ErrMissingAPIKey) {
+		t.Fatalf("Gemini 沒有 API Key 應回傳 ErrMissingAPIKey，實際為 %v", err)
+	}
+}
+
+func TestRenderPromptTemplates(t *testing.T) {
+	now := time.Date(2025, 11, 27, 14, 30, 5, 0, time.UTC)
+	prompt, vars, err := RenderPrompt("", "", PromptVars{SceneCount: 2, Duration: 20}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"S2_20251127_14_30_05"`, `"November 2025" trending topics`, "Scene 2 — [Scene Title]\n00:10–00:20", "in English"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("內建模板缺少 %q", want)
+		}
+	}
+	if vars.ID != "S2_20251127_14_30_05" || vars.Characters == "" {
+		t.Fatalf("應回傳補齊後的變數: %+v", vars)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "holiday.tmpl"), []byte("{{/* 節日特輯 */}}{{.Theme}} in {{.Language}} ({{.ID}})"), 0644)
+	prompt, _, err = RenderPrompt(dir, "holiday", PromptVars{ID: "S2_X", Theme: "Christmas", Language: "Japanese"}, now)
+	if err != nil || prompt != "Christmas in Japanese (S2_X)" {
+		t.Fatalf("自訂模板結果錯誤: %q %v", prompt, err)
+	}
+
+	// 模板沒有引用候選、翻譯與簡介時由程式補上；內建模板已自行處理則不重複
+	vars = PromptVars{ID: "S2_X", Brief: "Sledding.", Localizations: []string{"ja", "zh-TW"}, Variant: 2, Variants: 3}
+	prompt, _, err = RenderPrompt(dir, "holiday", vars, now)
+	for _, want := range []string{"candidate 2 of 3", `- "ja": Japanese`, `"ja": {"title"`, "【Creative Brief】\nSledding."} {
+		if err != nil || !strings.Contains(prompt, want) {
+			t.Errorf("自訂模板應補上 %q: %v\n%s", want, err, prompt)
+		}
+	}
+	prompt, _, _ = RenderPrompt("", "", vars, now)
+	if strings.Count(prompt, "【Localized Metadata】") != 1 || strings.Count(prompt, "Sledding.") != 1 || strings.Count(prompt, "candidate 2 of 3") != 1 {
+		t.Errorf("內建模板的區塊不應重複:\n%s", prompt)
+	}
+
+	list, err := ListTemplates(dir)
+	if err != nil || len(list) != 2 || list[0].Name != DefaultTemplate || list[1].Description != "節日特輯" {
+		t.Fatalf("模板清單錯誤: %+v %v", list, err)
+	}
+	if _, _, err := RenderPrompt(dir, "../secret", PromptVars{}, now); err == nil {
+		t.Fatal("含路徑的模板名稱應被拒絕")
+	}
+}
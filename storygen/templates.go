@@ -0,0 +1,231 @@
+package storygen
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate 為未指定模板時使用的名稱；模板資料夾沒有 default.tmpl 時使用內建版本
+const DefaultTemplate = "default"
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// PromptVars 為模板可使用的變數，空白欄位由 withDefaults 補齊
+type PromptVars struct {
+	ID            string // 由程式決定的 unique_id
+	Role          string // 提示詞第一行的 Sora 角色 (Role.txt)
+	Characters    string
+	Style         string // 畫面風格，空白時由模板決定
+	Theme         string
+	Topic         string   // 本次故事的主題 (來自主題清單或趨勢檔)，空白時使用 Month + Theme
+	Brief         string   // 自由填寫的創作簡介
+	Month         string   // 例如 "November 2025"
+	Language      string   // 主要語言名稱；也可填語言代碼 (例如 ja)，會轉成名稱
+	Localizations []string // 需要另外翻譯標題、說明與標籤的語言代碼
+	SceneCount    int
+	Duration      int // 影片秒數
+	Variant       int // 一次產生多個候選時為第幾個 (從 1 開始)
+	Variants      int // 候選總數，0 或 1 代表只產生一個
+}
+
+// Scene 為模板中 {{range scenes .}} 的單一場景時間軸
+type Scene struct {
+	N          int
+	Start, End string // mm:ss
+}
+
+// TemplateInfo 為模板清單的項目；Description 取自模板開頭的 {{/* ... */}} 註解
+type TemplateInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Builtin     bool   `json:"builtin"`
+}
+
+func (v PromptVars) withDefaults(now time.Time) PromptVars {
+	if v.ID == "" {
+		v.ID = NewID(now)
+	}
+	if v.Role == "" {
+		v.Role = "@jeremy202.whiskbunbu"
+	}
+	if v.Characters == "" {
+		v.Characters = "Sir Whiskers (Cat Chef) & Sunny Bun (Rabbit Assistant)"
+	}
+	if v.Theme == "" {
+		v.Theme = "trending topics"
+	}
+	if v.Month == "" {
+		v.Month = now.Format("January 2006")
+	}
+	if v.Language == "" {
+		v.Language = "English"
+	} else if _, ok := languageNames[v.Language]; ok {
+		v.Language = LanguageName(v.Language)
+	}
+	if v.SceneCount <= 0 {
+		v.SceneCount = 3
+	}
+	if v.Duration <= 0 {
+		v.Duration = 15
+	}
+	return v
+}
+
+// scenes 將影片長度平均切成 SceneCount 段
+func scenes(v PromptVars) []Scene {
+	list := make([]Scene, v.SceneCount)
+	for i := range list {
+		start := v.Duration * i / v.SceneCount
+		end := v.Duration * (i + 1) / v.SceneCount
+		list[i] = Scene{N: i + 1, Start: clock(start), End: clock(end)}
+	}
+	return list
+}
+
+func clock(sec int) string {
+	return fmt.Sprintf("%02d:%02d", sec/60, sec%60)
+}
+
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// readTemplate 先找 dir/<name>.tmpl，找不到再用內建模板
+func readTemplate(dir, name string) (string, error) {
+	if !templateNamePattern.MatchString(name) {
+		return "", fmt.Errorf("模板名稱 %q 無效 (只能使用英數字、- 與 _)", name)
+	}
+	if dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	data, err := builtinTemplates.ReadFile("templates/" + name + ".tmpl")
+	if err != nil {
+		return "", fmt.Errorf("找不到 %s", filepath.Join(dir, name+".tmpl"))
+	}
+	return string(data), nil
+}
+
+// RenderPrompt 以模板產生提示詞，回傳補齊預設值後的變數 (含 ID)
+func RenderPrompt(dir, name string, vars PromptVars, now time.Time) (string, PromptVars, error) {
+	if name == "" {
+		name = DefaultTemplate
+	}
+	vars = vars.withDefaults(now)
+	text, err := readTemplate(dir, name)
+	if err != nil {
+		return "", vars, &TemplateError{Name: name, Err: err}
+	}
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"scenes": scenes, "langName": LanguageName}).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", vars, &TemplateError{Name: name, Err: fmt.Errorf("語法錯誤: %w", err)}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", vars, &TemplateError{Name: name, Err: fmt.Errorf("執行失敗: %w", err)}
+	}
+	// v31: 模板沒有處理候選、翻譯或簡介時由程式補上，不依賴每個模板各自實作
+	for _, b := range extraBlocks {
+		if !strings.Contains(text, b.field) && b.needed(vars) {
+			if err := b.tmpl.Execute(&buf, vars); err != nil {
+				return "", vars, &TemplateError{Name: name, Err: fmt.Errorf("執行失敗: %w", err)}
+			}
+		}
+	}
+	return buf.String(), vars, nil
+}
+
+// extraBlocks 為模板未引用對應欄位時附加在提示詞後的說明
+var extraBlocks = []struct {
+	field  string // 模板文字含此欄位時視為已自行處理
+	needed func(PromptVars) bool
+	tmpl   *template.Template
+}{
+	{".Variants", func(v PromptVars) bool { return v.Variants > 1 }, template.Must(template.New("variants").Parse(`
+
+【Candidate】
+This is candidate {{.Variant}} of {{.Variants}} for the same video slot. Give it a clearly different angle, setting or gag so the candidates can be compared.`))},
+	{".Localizations", func(v PromptVars) bool { return len(v.Localizations) > 0 }, template.Must(template.New("localizations").Funcs(template.FuncMap{"langName": LanguageName}).Parse(`
+
+【Localized Metadata】
+Also translate the title, description and tags into each language below and put them in metadata.localizations, keyed by the language code.
+Keep the prompt text and the main title / description in {{.Language}}.
+{{- range .Localizations}}
+- "{{.}}": {{langName .}}
+{{- end}}
+Format: "localizations": {"{{index .Localizations 0}}": {"title": "Translated title", "description": "Translated description...", "tags": ["Translated tag"]}}`))},
+	{".Brief", func(v PromptVars) bool { return v.Brief != "" }, template.Must(template.New("brief").Parse(`
+
+【Creative Brief】
+{{.Brief}}`))},
+}
+
+// TemplateError 表示提示詞模板不存在或無法套用
+type TemplateError struct {
+	Name string
+	Err  error
+}
+
+func (e *TemplateError) Error() string { return fmt.Sprintf("提示詞模板 %s: %v", e.Name, e.Err) }
+func (e *TemplateError) Unwrap() error { return e.Err }
+
+var descriptionPattern = regexp.MustCompile(`^\{\{-?\s*/\*\s*(.*?)\s*\*/`)
+
+// ListTemplates 列出資料夾中的模板與內建模板 (同名時以資料夾為準)
+func ListTemplates(dir string) ([]TemplateInfo, error) {
+	found := map[string]TemplateInfo{}
+	entries, _ := builtinTemplates.ReadDir("templates")
+	for _, e := range entries {
+		data, _ := builtinTemplates.ReadFile("templates/" + e.Name())
+		name := strings.TrimSuffix(e.Name(), ".tmpl")
+		found[name] = TemplateInfo{Name: name, Description: describe(data), Builtin: true}
+	}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			name := strings.TrimSuffix(filepath.Base(f), ".tmpl")
+			if !templateNamePattern.MatchString(name) {
+				continue
+			}
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			found[name] = TemplateInfo{Name: name, Description: describe(data)}
+		}
+	}
+	list := make([]TemplateInfo, 0, len(found))
+	for _, t := range found {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		// default 排第一，其餘依名稱
+		if (list[i].Name == DefaultTemplate) != (list[j].Name == DefaultTemplate) {
+			return list[i].Name == DefaultTemplate
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+func describe(data []byte) string {
+	if m := descriptionPattern.FindSubmatch(bytes.TrimSpace(data)); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
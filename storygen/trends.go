@@ -0,0 +1,151 @@
+package storygen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Trend 為趨勢檔中的一個關鍵字，Weight 越大越容易被抽中
+type Trend struct {
+	Keyword string  `json:"keyword"`
+	Weight  float64 `json:"weight"`
+}
+
+// LoadTrends 讀取本機趨勢檔：.json 可為 [{"keyword","weight"}]、{"關鍵字": 權重} 或 ["關鍵字"]；
+// 其他副檔名視為 CSV (keyword,weight，可有標題列，# 開頭為註解，未填權重為 1)。權重 <= 0 的項目會略過
+func LoadTrends(path string) ([]Trend, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []Trend
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		list, err = parseTrendsJSON(data)
+	} else {
+		list, err = parseTrendsCSV(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("趨勢檔 %s 格式錯誤: %w", path, err)
+	}
+	var out []Trend
+	for _, t := range list {
+		t.Keyword = strings.TrimSpace(t.Keyword)
+		if t.Keyword != "" && t.Weight > 0 {
+			out = append(out, t)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("趨勢檔 %s 沒有任何關鍵字", path)
+	}
+	return out, nil
+}
+
+func parseTrendsJSON(data []byte) ([]Trend, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		var m map[string]float64
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		list := make([]Trend, 0, len(m))
+		for k, w := range m {
+			list = append(list, Trend{Keyword: k, Weight: w})
+		}
+		return list, nil
+	}
+	var keywords []string
+	if err := json.Unmarshal(data, &keywords); err == nil {
+		return Topics(keywords), nil
+	}
+	var list []Trend
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Weight == 0 {
+			list[i].Weight = 1
+		}
+	}
+	return list, nil
+}
+
+func parseTrendsCSV(data []byte) ([]Trend, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	var list []Trend
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := Trend{Keyword: rec[0], Weight: 1}
+		if len(rec) > 1 && strings.TrimSpace(rec[1]) != "" {
+			w, err := strconv.ParseFloat(strings.TrimSpace(rec[1]), 64)
+			if err != nil {
+				if line == 1 {
+					continue // 標題列
+				}
+				return nil, fmt.Errorf("第 %d 行的權重 %q 不是數字", line, rec[1])
+			}
+			t.Weight = w
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// Topics 將使用者輸入的主題清單轉成權重相同的 Trend
+func Topics(keywords []string) []Trend {
+	var list []Trend
+	for _, k := range keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			list = append(list, Trend{Keyword: k, Weight: 1})
+		}
+	}
+	return list
+}
+
+// SampleTopics 依權重不重複地抽出 n 個關鍵字；n 超過關鍵字數時重新抽一輪。r 為 nil 時使用全域亂數
+func SampleTopics(pool []Trend, n int, r *rand.Rand) []string {
+	if len(pool) == 0 || n <= 0 {
+		return nil
+	}
+	float := rand.Float64
+	if r != nil {
+		float = r.Float64
+	}
+	var out []string
+	var left []Trend
+	for len(out) < n {
+		if len(left) == 0 {
+			left = append([]Trend(nil), pool...)
+		}
+		total := 0.0
+		for _, t := range left {
+			total += t.Weight
+		}
+		x := float() * total
+		i := 0
+		for ; i < len(left)-1; i++ {
+			if x -= left[i].Weight; x < 0 {
+				break
+			}
+		}
+		out = append(out, left[i].Keyword)
+		left = append(left[:i], left[i+1:]...)
+	}
+	return out
+}
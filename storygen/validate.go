@@ -0,0 +1,153 @@
+package storygen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError 表示 JSON 可以解析，但內容不符合格式要求
+type ValidationError struct {
+	Raw      string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "AI 回傳的故事不符合格式: " + strings.Join(e.Problems, "; ")
+}
+
+var (
+	sceneHeaderPattern = regexp.MustCompile(`(?m)^\s*Scene\s+(\d+)\b`)
+	timestampPattern   = regexp.MustCompile(`(?m)^\s*(\d{1,2}):(\d{2})\s*[–—-]\s*(\d{1,2}):(\d{2})`)
+	categoryPattern    = regexp.MustCompile(`^\d+$`)
+)
+
+// YouTube 的欄位限制
+const (
+	maxTitleLength       = 100
+	maxDescriptionLength = 5000
+)
+
+// Validate 檢查必要欄位、unique_id 是否為發出的 ID，以及提示詞的場景 / 時間軸格式。
+// req 為零值時只檢查欄位 (例如讀取既有的 story.json)
+func Validate(s *Story, req Request) []string {
+	var problems []string
+	m := s.Metadata
+	if strings.TrimSpace(s.Prompt) == "" {
+		problems = append(problems, "缺少 prompt")
+	}
+	switch {
+	case m.UniqueID == "":
+		problems = append(problems, "缺少 metadata.unique_id")
+	case req.ID != "" && m.UniqueID != req.ID:
+		problems = append(problems, fmt.Sprintf("metadata.unique_id 必須是 %q，收到 %q", req.ID, m.UniqueID))
+	}
+	switch {
+	case m.FileName == "":
+		problems = append(problems, "缺少 metadata.file_name")
+	case !strings.HasSuffix(strings.ToLower(m.FileName), ".mp4"):
+		problems = append(problems, "metadata.file_name 必須以 .mp4 結尾")
+	case strings.ContainsAny(m.FileName, `/\:*?"<>|`):
+		problems = append(problems, "metadata.file_name 含有不可用於檔名的字元")
+	}
+	if strings.TrimSpace(m.Title) == "" {
+		problems = append(problems, "缺少 metadata.title")
+	} else if n := utf8.RuneCountInString(m.Title); n > maxTitleLength {
+		problems = append(problems, fmt.Sprintf("metadata.title 超過 %d 字 (%d 字)", maxTitleLength, n))
+	}
+	if n := utf8.RuneCountInString(m.Description); n > maxDescriptionLength {
+		problems = append(problems, fmt.Sprintf("metadata.description 超過 %d 字 (%d 字)", maxDescriptionLength, n))
+	}
+	if m.CategoryID != "" && !categoryPattern.MatchString(m.CategoryID) {
+		problems = append(problems, fmt.Sprintf("metadata.category_id 必須是數字，收到 %q", m.CategoryID))
+	}
+	switch m.Privacy {
+	case "", "private", "unlisted", "public":
+	default:
+		problems = append(problems, fmt.Sprintf("metadata.privacy 必須是 private / unlisted / public，收到 %q", m.Privacy))
+	}
+	problems = append(problems, validateLocalizations(m.Localizations, req.Localizations)...)
+	if req.SceneCount > 0 {
+		problems = append(problems, validateTimeline(s.Prompt, req.SceneCount, req.Duration)...)
+	}
+	return problems
+}
+
+// validateTimeline 檢查 Scene 1..N 依序出現，且每個場景都有遞增的 mm:ss–mm:ss 時間軸
+func validateTimeline(prompt string, sceneCount, duration int) []string {
+	var problems []string
+	headers := sceneHeaderPattern.FindAllStringSubmatch(prompt, -1)
+	if len(headers) != sceneCount {
+		problems = append(problems, fmt.Sprintf("prompt 必須有 %d 個場景 (Scene 1 — ...)，收到 %d 個", sceneCount, len(headers)))
+	}
+	for i, h := range headers {
+		if n, _ := strconv.Atoi(h[1]); n != i+1 {
+			problems = append(problems, fmt.Sprintf("場景編號必須依序為 1..%d，第 %d 個為 Scene %d", sceneCount, i+1, n))
+			break
+		}
+	}
+
+	stamps := timestampPattern.FindAllStringSubmatch(prompt, -1)
+	if len(stamps) < sceneCount {
+		problems = append(problems, fmt.Sprintf("每個場景都需要 mm:ss–mm:ss 時間軸，只找到 %d 個", len(stamps)))
+		return problems
+	}
+	prevEnd := 0
+	for i, ts := range stamps {
+		start := toSeconds(ts[1], ts[2])
+		end := toSeconds(ts[3], ts[4])
+		if end <= start {
+			problems = append(problems, fmt.Sprintf("時間軸 %s 的結束時間必須晚於開始時間", strings.TrimSpace(ts[0])))
+		} else if start < prevEnd {
+			problems = append(problems, fmt.Sprintf("時間軸 %s 與前一段重疊", strings.TrimSpace(ts[0])))
+		}
+		if duration > 0 && end > duration {
+			problems = append(problems, fmt.Sprintf("時間軸 %s 超過影片長度 %d 秒", strings.TrimSpace(ts[0]), duration))
+		}
+		if i == 0 && start != 0 {
+			problems = append(problems, "第一個時間軸必須從 00:00 開始")
+		}
+		prevEnd = end
+	}
+	return problems
+}
+
+// validateLocalizations 檢查要求的語言都有翻譯，且每個翻譯都符合 YouTube 的長度限制
+func validateLocalizations(locs map[string]Localization, want []string) []string {
+	var problems []string
+	for _, code := range want {
+		if _, ok := locs[code]; !ok {
+			problems = append(problems, fmt.Sprintf("metadata.localizations 缺少 %q (%s)", code, LanguageName(code)))
+		}
+	}
+	codes := make([]string, 0, len(locs))
+	for code := range locs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		l := locs[code]
+		field := fmt.Sprintf("metadata.localizations[%q]", code)
+		switch {
+		case !ValidLanguageCode(code):
+			problems = append(problems, fmt.Sprintf("%s: 不是有效的語言代碼", field))
+		case strings.TrimSpace(l.Title) == "":
+			problems = append(problems, field+".title 不可為空")
+		case utf8.RuneCountInString(l.Title) > maxTitleLength:
+			problems = append(problems, fmt.Sprintf("%s.title 超過 %d 字", field, maxTitleLength))
+		}
+		if utf8.RuneCountInString(l.Description) > maxDescriptionLength {
+			problems = append(problems, fmt.Sprintf("%s.description 超過 %d 字", field, maxDescriptionLength))
+		}
+	}
+	return problems
+}
+
+func toSeconds(min, sec string) int {
+	m, _ := strconv.Atoi(min)
+	s, _ := strconv.Atoi(sec)
+	return m*60 + s
+}
@@ -0,0 +1,495 @@
+// Package vault 以 AES-256-GCM 加密儲存 SkyForge 的各種憑證
+// (Sora token/cookie、YouTube OAuth token、Gemini API Key)。
+//
+// 金鑰來源依序為：
+//  1. 環境變數 SKYFORGE_VAULT_PASSPHRASE (以 PBKDF2-SHA256 推導)
+//  2. 金鑰檔 (預設 vault.key，可用 SKYFORGE_VAULT_KEYFILE 指定)，內容為 32 bytes 的 hex
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"SoraYT_Studio/filelock"
+)
+
+const (
+	DefaultPath    = "secrets.vault"
+	DefaultKeyFile = "vault.key"
+
+	EnvPassphrase    = "SKYFORGE_VAULT_PASSPHRASE"
+	EnvNewPassphrase = "SKYFORGE_VAULT_NEW_PASSPHRASE"
+	EnvKeyFile       = "SKYFORGE_VAULT_KEYFILE"
+
+	// SecretGeminiKey 由伺服器與獨立的 gemini_gen.go 共用
+	SecretGeminiKey = "gemini/api_key"
+
+	kdfPBKDF2  = "pbkdf2-sha256"
+	kdfKeyFile = "keyfile"
+	pbkdf2Iter = 600000
+	keyLen     = 32
+
+	// pendingKeySuffix 為 Rotate 產生的新金鑰檔暫存名稱 (vault.key.new)
+	pendingKeySuffix = ".new"
+)
+
+// ErrNoKey 表示找不到可用的金鑰 (沒有密碼也沒有金鑰檔)
+var ErrNoKey = errors.New("vault: 找不到金鑰，請設定 " + EnvPassphrase + " 或執行 vault init 建立金鑰檔")
+
+var errDecrypt = errors.New("vault: 解密失敗 (密碼或金鑰檔錯誤)")
+
+// fileFormat 為 secrets.vault 的磁碟格式
+type fileFormat struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt,omitempty"`
+	Iter    int    `json:"iter,omitempty"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Vault 為已解鎖的憑證庫，所有方法皆可並行呼叫。
+// serve 與 CLI 可同時開啟同一個憑證庫：寫入前在檔案鎖內重新讀取磁碟上的內容，
+// 讀取時若檔案已被其他行程修改也會重新讀取。
+type Vault struct {
+	path string
+	kdf  string
+	salt []byte
+	iter int // PBKDF2 次數，寫回時沿用檔案原本的設定
+	key  []byte
+
+	mu      sync.Mutex
+	secrets map[string]string
+	modTime time.Time // 最後一次讀寫時檔案的修改時間與大小
+	size    int64
+}
+
+func keyFilePath() string {
+	if p := os.Getenv(EnvKeyFile); p != "" {
+		return p
+	}
+	return DefaultKeyFile
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != keyLen {
+		return nil, fmt.Errorf("vault: 金鑰檔 %s 格式錯誤 (需為 %d bytes hex)", path, keyLen)
+	}
+	return key, nil
+}
+
+func deriveKey(passphrase string, salt []byte, iter int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, iter, keyLen)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Exists 回傳 path 是否已有加密憑證庫
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Available 回傳目前環境是否有金鑰可用 (密碼或金鑰檔)
+func Available() bool {
+	if os.Getenv(EnvPassphrase) != "" {
+		return true
+	}
+	_, err := os.Stat(keyFilePath())
+	return err == nil
+}
+
+// Open 解鎖 path 的憑證庫；檔案不存在時回傳空的憑證庫 (第一次 Set 時建立)。
+func Open(path string) (*Vault, error) {
+	v := &Vault{path: path, secrets: map[string]string{}}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := v.initKey(); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	unlock, err := v.lockLocked()
+	if err != nil {
+		return nil, err
+	}
+	unlock()
+	return v, nil
+}
+
+// readLocked 讀取並解密磁碟上的憑證庫，取代記憶體中的內容；解密失敗時不修改任何狀態。
+// 檔案不存在時保留目前內容。呼叫前需持有 v.mu
+func (v *Vault) readLocked() error {
+	data, err := os.ReadFile(v.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var ff fileFormat
+	if err := json.Unmarshal(data, &ff); err != nil {
+		return fmt.Errorf("vault: %s 格式錯誤: %w", v.path, err)
+	}
+	var plain []byte
+	iter := 0
+	switch ff.KDF {
+	case kdfPBKDF2:
+		iter = ff.Iter
+		if iter <= 0 {
+			iter = pbkdf2Iter
+		}
+		// salt 與次數不變時沿用已推導的金鑰，避免每次寫入都重新執行 PBKDF2
+		key := v.key
+		if v.kdf != kdfPBKDF2 || !bytes.Equal(v.salt, ff.Salt) || v.iter != iter {
+			pass := os.Getenv(EnvPassphrase)
+			if pass == "" {
+				return fmt.Errorf("vault: %s 以密碼加密，請設定 %s", v.path, EnvPassphrase)
+			}
+			if key, err = deriveKey(pass, ff.Salt, iter); err != nil {
+				return err
+			}
+		}
+		if plain, err = decrypt(key, ff.Nonce, ff.Data); err != nil {
+			return errDecrypt
+		}
+		v.key = key
+	case kdfKeyFile:
+		// 每次都重新讀取金鑰檔：其他行程 rotate 後，舊金鑰不可再用來寫入
+		if plain, err = v.openWithKeyFile(ff); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("vault: 不支援的 kdf %q", ff.KDF)
+	}
+
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return fmt.Errorf("vault: 內容損毀: %w", err)
+	}
+	v.kdf, v.salt, v.iter, v.secrets = ff.KDF, ff.Salt, iter, secrets
+	v.stampLocked()
+	return nil
+}
+
+// stampLocked 記下目前檔案的修改時間與大小
+func (v *Vault) stampLocked() {
+	if info, err := os.Stat(v.path); err == nil {
+		v.modTime, v.size = info.ModTime(), info.Size()
+	}
+}
+
+// lockLocked 取得憑證庫的檔案鎖並重新讀取磁碟上的內容，呼叫前需持有 v.mu。
+// 其他行程已換成目前無法解密的金鑰時回傳錯誤，不會以舊金鑰覆寫
+func (v *Vault) lockLocked() (unlock func(), err error) {
+	unlock, err = filelock.Lock(v.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.readLocked(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// refreshLocked 檔案被其他行程修改過時重新讀取；讀取失敗時保留記憶體中的內容
+func (v *Vault) refreshLocked() {
+	info, err := os.Stat(v.path)
+	if err != nil || (info.ModTime().Equal(v.modTime) && info.Size() == v.size) {
+		return
+	}
+	// 在檔案鎖內讀取，避免讀到 Rotate 換上新金鑰檔之前的中間狀態；
+	// 失敗 (例如密碼已被其他行程更換) 時記下目前狀態，不在每次讀取時重試
+	if unlock, err := v.lockLocked(); err == nil {
+		unlock()
+	} else {
+		v.modTime, v.size = info.ModTime(), info.Size()
+	}
+}
+
+// openWithKeyFile 以金鑰檔解密。Rotate 在寫入憑證庫之後、換上新金鑰檔之前中斷時，
+// 新金鑰仍在 vault.key.new：改用它解密並完成替換；寫入憑證庫之前中斷的則直接丟棄
+func (v *Vault) openWithKeyFile(ff fileFormat) ([]byte, error) {
+	keyPath := keyFilePath()
+	pending := keyPath + pendingKeySuffix
+	key, keyErr := readKeyFile(keyPath)
+	if keyErr == nil {
+		if plain, err := decrypt(key, ff.Nonce, ff.Data); err == nil {
+			os.Remove(pending)
+			v.key = key
+			return plain, nil
+		}
+	}
+	newKey, err := readKeyFile(pending)
+	if err != nil {
+		if keyErr != nil {
+			return nil, fmt.Errorf("vault: 無法讀取金鑰檔: %w", keyErr)
+		}
+		return nil, errDecrypt
+	}
+	plain, err := decrypt(newKey, ff.Nonce, ff.Data)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	if err := os.Rename(pending, keyPath); err != nil {
+		return nil, fmt.Errorf("vault: 無法完成金鑰替換 (新金鑰在 %s): %w", pending, err)
+	}
+	v.key = newKey
+	return plain, nil
+}
+
+// initKey 為新的憑證庫決定金鑰來源
+func (v *Vault) initKey() error {
+	if pass := os.Getenv(EnvPassphrase); pass != "" {
+		salt, err := randomBytes(16)
+		if err != nil {
+			return err
+		}
+		key, err := deriveKey(pass, salt, pbkdf2Iter)
+		if err != nil {
+			return err
+		}
+		v.kdf, v.salt, v.iter, v.key = kdfPBKDF2, salt, pbkdf2Iter, key
+		return nil
+	}
+	key, err := readKeyFile(keyFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoKey
+		}
+		return err
+	}
+	v.kdf, v.key = kdfKeyFile, key
+	return nil
+}
+
+// GenerateKeyFile 產生新的隨機金鑰檔，已存在時回傳錯誤
+func GenerateKeyFile() (string, error) {
+	path := keyFilePath()
+	if _, err := os.Stat(path); err == nil {
+		return path, fmt.Errorf("vault: 金鑰檔 %s 已存在", path)
+	}
+	key, err := randomBytes(keyLen)
+	if err != nil {
+		return path, err
+	}
+	return path, os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600)
+}
+
+// Save 將目前內容寫入磁碟 (用於建立空的憑證庫)
+func (v *Vault) Save() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	unlock, err := v.lockLocked()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return v.saveLocked()
+}
+
+// Get 取得憑證，不存在時 ok 為 false
+func (v *Vault) Get(name string) (string, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.refreshLocked()
+	s, ok := v.secrets[name]
+	return s, ok
+}
+
+// Set 寫入憑證並立即存檔
+func (v *Vault) Set(name, value string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	unlock, err := v.lockLocked()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	v.secrets[name] = value
+	return v.saveLocked()
+}
+
+// Delete 移除憑證並立即存檔
+func (v *Vault) Delete(name string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	unlock, err := v.lockLocked()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	delete(v.secrets, name)
+	return v.saveLocked()
+}
+
+// Names 回傳所有憑證名稱 (已排序)
+func (v *Vault) Names() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.refreshLocked()
+	names := make([]string, 0, len(v.secrets))
+	for k := range v.secrets {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export 回傳所有憑證的明文副本
+func (v *Vault) Export() map[string]string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.refreshLocked()
+	out := make(map[string]string, len(v.secrets))
+	for k, s := range v.secrets {
+		out[k] = s
+	}
+	return out
+}
+
+// Rotate 以新金鑰重新加密。設定 SKYFORGE_VAULT_NEW_PASSPHRASE 時改用新密碼，
+// 否則產生新的隨機金鑰檔取代舊檔：新金鑰先寫入 vault.key.new，憑證庫寫入後才換名，
+// 中途中斷時由 Open 依憑證庫實際使用的金鑰完成或放棄替換。
+func (v *Vault) Rotate() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	unlock, err := v.lockLocked()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	oldKDF, oldSalt, oldIter, oldKey := v.kdf, v.salt, v.iter, v.key
+	restore := func() { v.kdf, v.salt, v.iter, v.key = oldKDF, oldSalt, oldIter, oldKey }
+
+	if pass := os.Getenv(EnvNewPassphrase); pass != "" {
+		salt, err := randomBytes(16)
+		if err != nil {
+			return err
+		}
+		key, err := deriveKey(pass, salt, pbkdf2Iter)
+		if err != nil {
+			return err
+		}
+		v.kdf, v.salt, v.iter, v.key = kdfPBKDF2, salt, pbkdf2Iter, key
+		if err := v.saveLocked(); err != nil {
+			restore()
+			return err
+		}
+		return nil
+	}
+
+	key, err := randomBytes(keyLen)
+	if err != nil {
+		return err
+	}
+	keyPath := keyFilePath()
+	pending := keyPath + pendingKeySuffix
+	if err := writeSynced(pending, []byte(hex.EncodeToString(key)+"\n")); err != nil {
+		return err
+	}
+	v.kdf, v.salt, v.iter, v.key = kdfKeyFile, nil, 0, key
+	if err := v.saveLocked(); err != nil {
+		restore()
+		os.Remove(pending)
+		return err
+	}
+	return os.Rename(pending, keyPath)
+}
+
+// saveLocked 加密並以暫存檔 + rename 寫入，呼叫前需持有 v.mu
+func (v *Vault) saveLocked() error {
+	plain, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	nonce, data, err := encrypt(v.key, plain)
+	if err != nil {
+		return err
+	}
+	ff := fileFormat{Version: 1, KDF: v.kdf, Salt: v.salt, Iter: v.iter, Nonce: nonce, Data: data}
+	b, err := json.MarshalIndent(ff, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := v.path + ".tmp"
+	if err := writeSynced(tmp, b); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		return err
+	}
+	v.stampLocked()
+	return nil
+}
+
+// writeSynced 寫入檔案 (0600) 並 fsync，確保 rename 之前內容已落盤
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func encrypt(key, plain []byte) ([]byte, []byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plain, nil), nil
+}
+
+func decrypt(key, nonce, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, data, nil)
+}
@@ -0,0 +1,178 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setupKeyFile 在暫存資料夾建立金鑰檔並回傳憑證庫路徑
+func setupKeyFile(t *testing.T) (vaultPath, keyPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyPath = filepath.Join(dir, "vault.key")
+	t.Setenv(EnvPassphrase, "")
+	t.Setenv(EnvNewPassphrase, "")
+	t.Setenv(EnvKeyFile, keyPath)
+	if _, err := GenerateKeyFile(); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "secrets.vault"), keyPath
+}
+
+func mustOpen(t *testing.T, path string) *Vault {
+	t.Helper()
+	v, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestRoundTripAndExport(t *testing.T) {
+	path, keyPath := setupKeyFile(t)
+	v := mustOpen(t, path)
+	v.Set("sora/default/bearer", "Bearer abc")
+	v.Set(SecretGeminiKey, "g-key")
+	v.Delete("nope")
+
+	data, _ := os.ReadFile(path)
+	if len(data) == 0 || bytes.Contains(data, []byte("g-key")) {
+		t.Fatalf("憑證庫不應含明文: %s", data)
+	}
+	got := mustOpen(t, path)
+	want := map[string]string{"sora/default/bearer": "Bearer abc", SecretGeminiKey: "g-key"}
+	if !reflect.DeepEqual(got.Export(), want) || !reflect.DeepEqual(got.Names(), []string{SecretGeminiKey, "sora/default/bearer"}) {
+		t.Fatalf("重新開啟後內容不符: %v", got.Export())
+	}
+
+	// 換成另一把金鑰應解密失敗
+	os.Remove(keyPath)
+	GenerateKeyFile()
+	if _, err := Open(path); err == nil {
+		t.Fatal("錯誤的金鑰檔應無法開啟")
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	t.Setenv(EnvKeyFile, filepath.Join(t.TempDir(), "missing.key"))
+	t.Setenv(EnvPassphrase, "correct horse")
+	v := mustOpen(t, path)
+	if err := v.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := mustOpen(t, path).Get("a"); s != "1" {
+		t.Fatalf("密碼解鎖後內容錯誤: %q", s)
+	}
+	t.Setenv(EnvPassphrase, "wrong")
+	if _, err := Open(path); err == nil {
+		t.Fatal("錯誤的密碼應無法開啟")
+	}
+
+	// 改用新密碼後，舊密碼失效
+	t.Setenv(EnvPassphrase, "correct horse")
+	t.Setenv(EnvNewPassphrase, "battery staple")
+	if err := mustOpen(t, path).Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatal("rotate 後舊密碼應失效")
+	}
+	t.Setenv(EnvPassphrase, "battery staple")
+	if s, _ := mustOpen(t, path).Get("a"); s != "1" {
+		t.Fatalf("rotate 後內容錯誤: %q", s)
+	}
+}
+
+func TestRotateKeyFile(t *testing.T) {
+	path, keyPath := setupKeyFile(t)
+	v := mustOpen(t, path)
+	v.Set("a", "1")
+	oldKey, _ := os.ReadFile(keyPath)
+	if err := v.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	newKey, _ := os.ReadFile(keyPath)
+	if bytes.Equal(newKey, oldKey) {
+		t.Fatal("rotate 應產生新的金鑰檔")
+	}
+	if s, _ := mustOpen(t, path).Get("a"); s != "1" {
+		t.Fatalf("rotate 後內容錯誤: %q", s)
+	}
+
+	// 模擬寫入憑證庫後、換上新金鑰檔前中斷：舊金鑰仍在 vault.key，新金鑰在 vault.key.new
+	os.WriteFile(keyPath+pendingKeySuffix, newKey, 0600)
+	os.WriteFile(keyPath, oldKey, 0600)
+	if s, _ := mustOpen(t, path).Get("a"); s != "1" {
+		t.Fatalf("中斷後應以新金鑰開啟: %q", s)
+	}
+	if cur, _ := os.ReadFile(keyPath); !bytes.Equal(cur, newKey) {
+		t.Fatal("開啟時應完成金鑰替換")
+	}
+	if _, err := os.Stat(keyPath + pendingKeySuffix); !os.IsNotExist(err) {
+		t.Fatal("完成替換後不應留下暫存金鑰")
+	}
+
+	// 寫入憑證庫前中斷：暫存金鑰未被使用，直接丟棄
+	os.WriteFile(keyPath+pendingKeySuffix, oldKey, 0600)
+	if s, _ := mustOpen(t, path).Get("a"); s != "1" {
+		t.Fatalf("未使用的暫存金鑰不應影響開啟: %q", s)
+	}
+	if cur, _ := os.ReadFile(keyPath); !bytes.Equal(cur, newKey) {
+		t.Fatal("未使用的暫存金鑰不應取代金鑰檔")
+	}
+}
+
+func TestConcurrentHandles(t *testing.T) {
+	// serve 與 CLI 同時開啟同一個憑證庫，彼此的寫入不可被覆蓋
+	path, _ := setupKeyFile(t)
+	serve, cli := mustOpen(t, path), mustOpen(t, path)
+	if err := serve.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Set("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := serve.Get("b"); s != "2" {
+		t.Fatalf("讀取時應看到其他行程的寫入: %q", s)
+	}
+
+	// CLI rotate 金鑰檔後，serve 的寫入應改用新金鑰而不是以舊金鑰覆寫
+	if err := cli.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := serve.Set("c", "3"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "1", "b": "2", "c": "3"}
+	if got := mustOpen(t, path).Export(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("rotate 後內容不符: %v", got)
+	}
+}
+
+func TestPassphraseKeepsIterations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	t.Setenv(EnvKeyFile, filepath.Join(t.TempDir(), "missing.key"))
+	t.Setenv(EnvPassphrase, "correct horse")
+	v := mustOpen(t, path)
+	v.iter = 1000 // 模擬以其他次數建立的舊憑證庫
+	v.key, _ = deriveKey("correct horse", v.salt, v.iter)
+	if err := v.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mustOpen(t, path).Set("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	var ff fileFormat
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &ff); err != nil || ff.Iter != 1000 {
+		t.Fatalf("寫回時應沿用原本的 PBKDF2 次數: %d %v", ff.Iter, err)
+	}
+	if s, _ := mustOpen(t, path).Get("a"); s != "1" {
+		t.Fatalf("重新開啟後內容錯誤: %q", s)
+	}
+}